@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+}
+
+var configPrintRedacted bool
+
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the effective configuration",
+	Long: `Print the configuration as the server would load it, after applying the
+config file, secret files and environment variables. Problems that would stop
+the server from starting are reported after it.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			return err
+		}
+
+		printed := cfg
+		if configPrintRedacted {
+			printed = cfg.Redacted()
+		}
+		out, err := json.MarshalIndent(printed, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(out))
+
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+			os.Exit(2)
+		}
+		return nil
+	},
+}
+
+func init() {
+	configPrintCmd.Flags().BoolVar(&configPrintRedacted, "redacted", true, "replace passwords, keys and tokens; use --redacted=false to show them")
+	configCmd.AddCommand(configPrintCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/db"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage the database schema",
+	Long: `Apply, revert and inspect the migrations embedded in the binary. The
+database is the one configured for the server.`,
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply every pending migration",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		return withMigrator(func(m *db.Migrator) error {
+			return m.Up()
+		})
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down [N]",
+	Short: "Revert the last N migrations, 1 by default",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		steps := 1
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid number of migrations %q", args[0])
+			}
+			steps = n
+		}
+		return withMigrator(func(m *db.Migrator) error {
+			return m.Down(steps)
+		})
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the applied and pending migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		migrations, err := db.Migrations()
+		if err != nil {
+			return err
+		}
+		return withMigrator(func(m *db.Migrator) error {
+			version, dirty, err := m.Version()
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "version: %d", version)
+			if dirty {
+				fmt.Fprint(out, " (dirty: the last migration failed, repair it and run migrate force)")
+			}
+			fmt.Fprintln(out)
+			for _, migration := range migrations {
+				state := "pending"
+				if migration.Version <= version {
+					state = "applied"
+				}
+				fmt.Fprintf(out, "%06d  %-8s %s\n", migration.Version, state, migration.Name)
+			}
+			return nil
+		})
+	},
+}
+
+var migrateForceCmd = &cobra.Command{
+	Use:   "force VERSION",
+	Short: "Set the schema version without running migrations",
+	Long: `Set the schema version without running migrations and clear the dirty flag.
+Use it after repairing a migration that failed halfway. Version -1 marks the
+database as having no migrations applied.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		version, err := strconv.Atoi(args[0])
+		if err != nil || version < -1 {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		return withMigrator(func(m *db.Migrator) error {
+			return m.Force(version)
+		})
+	},
+}
+
+var migrateVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that every migration can be reverted",
+	Long: `Check that every up migration has a down migration, then apply, revert and
+reapply each migration in turn and finally revert them all. It needs an empty
+database and leaves it empty; run it against a scratch database, for example
+in CI.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		err := withMigrator(func(m *db.Migrator) error {
+			return m.Verify()
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "all migrations can be reverted")
+		return nil
+	},
+}
+
+// withMigrator runs fn with a migrator for the configured database.
+func withMigrator(fn func(m *db.Migrator) error) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	m, err := db.NewMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	return fn(m)
+}
+
+func init() {
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd, migrateForceCmd, migrateVerifyCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
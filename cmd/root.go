@@ -0,0 +1,59 @@
+// Package cmd implements the command line of the service: the API server and
+// the operator commands built into the same binary.
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/logging"
+)
+
+// configPath is the config file given with --config or CONFIG_FILE.
+var configPath string
+
+var rootCmd = &cobra.Command{
+	Use:   "auth-service",
+	Short: "Authentication service for Time Capsule",
+	// Without a subcommand the API is served, as it was before the command line existed.
+	Args:         cobra.NoArgs,
+	Run:          runServe,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", os.Getenv("CONFIG_FILE"), "YAML or TOML config file; environment variables take precedence")
+}
+
+// Execute runs the command given on the command line.
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// loadConfig loads and validates the configuration and sets up logging.
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	if err := logging.Setup(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// mustLoadConfig loads the configuration for the server and exits if it is invalid.
+func mustLoadConfig() config.Config {
+	cfg, err := loadConfig()
+	if err != nil {
+		logging.Fatal("failed to load configuration", err)
+	}
+	return *cfg
+}
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/cobra"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/background"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/db"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/email"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/health"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/logging"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/metrics"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/oidc"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/oidc/oidctest"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/purge"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/redis"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/sms"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/tracing"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/pkg/api/grpcapi"
+	v1 "github.com/time_capsule/Auth-Servic-Timecapsule/pkg/api/v1"
+	"google.golang.org/grpc"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the HTTP and gRPC APIs",
+	Args:  cobra.NoArgs,
+	Run:   runServe,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+}
+
+// runServe runs the API until SIGINT or SIGTERM, then drains it.
+func runServe(_ *cobra.Command, _ []string) {
+	cfg := mustLoadConfig()
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), &cfg)
+	if err != nil {
+		logging.Fatal("failed to set up tracing", err)
+	}
+
+	// Dependencies may come up after the service, so connecting is retried if configured
+	retryBackoff := time.Duration(cfg.StartupRetryBackoff) * time.Second
+
+	// Initialize database connection
+	var dbPool *pgxpool.Pool
+	err = health.Retry(context.Background(), "PostgreSQL", cfg.StartupRetries, retryBackoff, func() (err error) {
+		dbPool, err = db.Connect(&cfg)
+		return err
+	})
+	if err != nil {
+		logging.Fatal("failed to connect to PostgreSQL", err)
+	}
+
+	// Apply pending migrations; replicas starting together wait on the migration lock
+	if cfg.MigrateOnStart {
+		if err := db.Migrate(&cfg); err != nil {
+			logging.Fatal("failed to apply migrations", err)
+		}
+	}
+
+	// Initialize Redis client
+	var redisClient *redis.Client
+	err = health.Retry(context.Background(), "Redis", cfg.StartupRetries, retryBackoff, func() (err error) {
+		redisClient, err = redis.Connect(&cfg)
+		return err
+	})
+	if err != nil {
+		logging.Fatal("failed to connect to Redis", err)
+	}
+
+	// Initialize SMS sender
+	smsSender, err := sms.NewSender(&cfg)
+	if err != nil {
+		logging.Fatal("failed to set up SMS sender", err)
+	}
+
+	// Initialize social login providers
+	providers, err := oidc.NewRegistry(&cfg)
+	if err != nil {
+		logging.Fatal("failed to set up sign-in providers", err)
+	}
+	var mockServer *oidctest.Server
+	if cfg.OAuthMockProvider {
+		mockServer, err = oidctest.NewServer("mock-client", "mock-secret")
+		if err != nil {
+			logging.Fatal("failed to start mock sign-in provider", err)
+		}
+
+		mockProvider, err := oidc.NewOIDCProvider(mockServer.ProviderConfig("mock"), oidc.CallbackURL(cfg.AppBaseURL, "mock"), http.DefaultClient)
+		if err != nil {
+			logging.Fatal("failed to set up mock sign-in provider", err)
+		}
+		providers.Register(mockProvider)
+		slog.Info("mock sign-in provider running", "issuer", mockServer.Issuer())
+	}
+
+	// Export connection pool statistics
+	if err := metrics.RegisterPools(dbPool, redisClient.Client); err != nil {
+		logging.Fatal("failed to register pool metrics", err)
+	}
+
+	// Background work is tracked so that shutdown can wait for it
+	tasks := background.NewGroup()
+	checkTimeout := time.Duration(cfg.HealthCheckTimeout) * time.Second
+	checker := health.NewChecker(
+		health.Check{Name: "postgres", Timeout: checkTimeout, Run: dbPool.Ping},
+		health.Check{Name: "redis", Timeout: checkTimeout, Run: func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		}},
+		health.Check{Name: "smtp", Timeout: checkTimeout, Run: func(ctx context.Context) error {
+			return email.Ping(ctx, &cfg)
+		}},
+		health.Check{Name: "migrations", Timeout: checkTimeout, Run: func(ctx context.Context) error {
+			return db.CheckSchemaVersion(ctx, dbPool)
+		}},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Start background jobs
+	purgeJob := purge.NewJob(dbPool, &cfg)
+	tasks.Go(func() { purgeJob.Run(ctx) })
+
+	// Set up API routes
+	router := v1.SetupRouter(dbPool, redisClient, smsSender, providers, tasks, checker, &cfg)
+
+	srv := &http.Server{
+		Addr:              cfg.HTTPPort,
+		Handler:           router,
+		ReadTimeout:       time.Duration(cfg.HTTPReadTimeout) * time.Second,
+		ReadHeaderTimeout: time.Duration(cfg.HTTPReadHeaderTimeout) * time.Second,
+		WriteTimeout:      time.Duration(cfg.HTTPWriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(cfg.HTTPIdleTimeout) * time.Second,
+		MaxHeaderBytes:    cfg.HTTPMaxHeaderBytes,
+	}
+
+	slog.Info("listening", "addr", cfg.HTTPPort)
+	serverErr := make(chan error, 2)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	// Serve the gRPC API for internal services on its own port
+	var grpcServer *grpc.Server
+	if cfg.GRPCPort != "" {
+		listener, err := net.Listen("tcp", cfg.GRPCPort)
+		if err != nil {
+			logging.Fatal("failed to listen for gRPC", err)
+		}
+		grpcServer = grpcapi.NewServer(dbPool, redisClient, checker, &cfg)
+		slog.Info("listening for gRPC", "addr", cfg.GRPCPort)
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				serverErr <- err
+			}
+		}()
+	}
+
+	// Graceful shutdown
+	quit := make(chan os.Signal, 2)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErr:
+		logging.Fatal("server failed", err)
+	case sig := <-quit:
+		slog.Info("shutting down", "signal", sig.String())
+	}
+
+	// A second signal skips draining
+	go func() {
+		<-quit
+		slog.Warn("forced shutdown")
+		os.Exit(1)
+	}()
+
+	// Readiness fails first so that load balancers stop routing to this instance
+	// before it stops accepting connections.
+	checker.StartDraining()
+	time.Sleep(time.Duration(cfg.ShutdownDelay) * time.Second)
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer shutdownCancel()
+
+	// Stop taking requests and wait for in-flight ones
+	grpcStopped := make(chan struct{})
+	go func() {
+		defer close(grpcStopped)
+		if grpcServer == nil {
+			return
+		}
+		if err := grpcapi.Stop(shutdownCtx, grpcServer); err != nil {
+			slog.Error("gRPC server shutdown failed", "error", err)
+		}
+	}()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("HTTP server shutdown failed", "error", err)
+	}
+	<-grpcStopped
+
+	// Stop workers and wait for background work, which may still use the database and Redis
+	cancel()
+	if err := tasks.Wait(shutdownCtx); err != nil {
+		slog.Error("background work did not finish", "error", err)
+	}
+
+	dbPool.Close()
+	if err := redisClient.Close(); err != nil {
+		slog.Error("failed to close Redis", "error", err)
+	}
+	if mockServer != nil {
+		mockServer.Close()
+	}
+
+	// Flush the spans of the requests that were drained
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+
+	slog.Info("server exiting")
+}
@@ -0,0 +1,575 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	osuser "os/user"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/audit"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/auth"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/db"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/phone"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/redis"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/user"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/validation"
+)
+
+// cliUserAgent is recorded as the user agent of audit events for changes made
+// with these commands. The operator's login name is added to the details.
+const cliUserAgent = "auth-service cli"
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Administer user accounts",
+	Long: `Administer user accounts directly in the database, for example to create the
+first admin. USER is a user ID, email or phone number. Every change is recorded
+in the audit log.`,
+}
+
+var userCreateFlags struct {
+	username      string
+	email         string
+	phone         string
+	fullName      string
+	dateOfBirth   string
+	role          string
+	orgID         string
+	passwordStdin bool
+}
+
+var userCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an approved account",
+	Long: `Create an approved account with the given role. The email and phone are
+trusted and marked verified. The password is read from stdin with
+--password-stdin, or else generated and printed once.`,
+	Example: `  auth-service user create --username ops --email ops@example.com --role admin --date-of-birth 1990-01-31`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		flags := userCreateFlags
+		if !validation.IsUsername(flags.username) {
+			return errors.New("--username must be 3 to 32 letters, digits, dots and underscores")
+		}
+		if flags.email == "" && flags.phone == "" {
+			return errors.New("--email or --phone is required")
+		}
+		if !validation.IsRole(flags.role) {
+			return fmt.Errorf("unknown role %q", flags.role)
+		}
+
+		newUser := &models.User{
+			Username: flags.username,
+			Email:    flags.email,
+			FullName: flags.fullName,
+			Role:     flags.role,
+		}
+		if flags.phone != "" {
+			normalized, err := phone.Normalize(flags.phone)
+			if err != nil {
+				return fmt.Errorf("invalid --phone: %w", err)
+			}
+			newUser.Phone = &normalized
+		}
+		if flags.dateOfBirth != "" {
+			dob, err := time.Parse(time.DateOnly, flags.dateOfBirth)
+			if err != nil {
+				return errors.New("--date-of-birth must be a date like 1990-01-31")
+			}
+			newUser.DateOfBirth = dob
+		}
+		if flags.orgID != "" {
+			if _, err := uuid.Parse(flags.orgID); err != nil {
+				return errors.New("--org must be an organization ID")
+			}
+			newUser.OrgID = &flags.orgID
+		}
+
+		return withUserAdmin(func(ctx context.Context, a *userAdmin) error {
+			if minAge := a.cfg.MinimumAge(newUser.Role); minAge > 0 &&
+				(newUser.DateOfBirth.IsZero() || validation.Age(newUser.DateOfBirth, time.Now()) < minAge) {
+				return fmt.Errorf("the %s role requires a --date-of-birth at least %d years ago", newUser.Role, minAge)
+			}
+
+			password, generated, err := readPassword(cmd.InOrStdin(), flags.passwordStdin)
+			if err != nil {
+				return err
+			}
+			if newUser.PasswordHash, err = auth.HashPassword(ctx, password); err != nil {
+				return err
+			}
+
+			if err := a.users.CreateVerifiedUser(ctx, newUser); err != nil {
+				return err
+			}
+			a.record(ctx, audit.ActionUserCreate, newUser.ID, map[string]interface{}{
+				"role":   newUser.Role,
+				"status": newUser.Status,
+			})
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "created %s user %s (%s)\n", newUser.Role, newUser.Username, newUser.ID)
+			if generated {
+				fmt.Fprintf(out, "password: %s\n", password)
+			}
+			return nil
+		})
+	},
+}
+
+var userSetRoleCmd = &cobra.Command{
+	Use:   "set-role USER ROLE",
+	Short: "Change the role of a user",
+	Long: `Change the role of a user. Tokens carry the role, so the user's sessions are
+revoked and they sign in again with the new one. The user's date of birth must
+meet the minimum age of the role.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		role := args[1]
+		if !validation.IsRole(role) {
+			return fmt.Errorf("unknown role %q", role)
+		}
+
+		return withUserAdmin(func(ctx context.Context, a *userAdmin) error {
+			target, err := a.findUser(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if target.Role == role && !target.RoleSelfAssigned {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s already has the %s role\n", target.Username, role)
+				return nil
+			}
+			if minAge := a.cfg.MinimumAge(role); minAge > 0 &&
+				(target.DateOfBirth.IsZero() || validation.Age(target.DateOfBirth, time.Now()) < minAge) {
+				return fmt.Errorf("the %s role requires a date of birth at least %d years ago", role, minAge)
+			}
+
+			previousRole, err := a.users.SetUserRole(ctx, target.ID, role)
+			if err != nil {
+				return err
+			}
+			a.record(ctx, audit.ActionUserRoleChange, target.ID, map[string]interface{}{
+				"role": map[string]interface{}{"from": previousRole, "to": role},
+			})
+			if err := a.revokeSessions(ctx, target.ID); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "changed the role of %s from %s to %s and revoked their sessions\n", target.Username, previousRole, role)
+			return nil
+		})
+	},
+}
+
+var userSetStatusCmd = &cobra.Command{
+	Use:   "set-status USER STATUS",
+	Short: "Change the account status of a user",
+	Long:  `Change the account status of a user to pending, approved or canceled.`,
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		status := args[1]
+		if !validation.IsUserStatus(status) {
+			return fmt.Errorf("status must be %s, %s or %s", models.UserStatusPending, models.UserStatusApproved, models.UserStatusCanceled)
+		}
+
+		return withUserAdmin(func(ctx context.Context, a *userAdmin) error {
+			target, err := a.findUser(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if target.Status == status {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s is already %s\n", target.Username, status)
+				return nil
+			}
+
+			if err := a.users.UpdateUserStatusByID(ctx, target.ID, status); err != nil {
+				return err
+			}
+			a.record(ctx, audit.ActionUserStatusChange, target.ID, map[string]interface{}{
+				"status": map[string]interface{}{"from": target.Status, "to": status},
+			})
+
+			fmt.Fprintf(cmd.OutOrStdout(), "changed the status of %s from %s to %s\n", target.Username, target.Status, status)
+			return nil
+		})
+	},
+}
+
+var userResetPasswordFlags struct {
+	passwordStdin bool
+	requireReset  bool
+}
+
+var userResetPasswordCmd = &cobra.Command{
+	Use:   "reset-password USER",
+	Short: "Set a new password for a user",
+	Long: `Set a new password for a user and revoke their sessions. The password is read
+from stdin with --password-stdin, or else generated and printed once. With
+--require-reset no password is set; instead the user must choose a new one
+with forgot password before signing in again.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := userResetPasswordFlags
+		if flags.requireReset && flags.passwordStdin {
+			return errors.New("--require-reset and --password-stdin cannot be combined")
+		}
+
+		return withUserAdmin(func(ctx context.Context, a *userAdmin) error {
+			target, err := a.findUser(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			targetID, err := uuid.Parse(target.ID)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.requireReset {
+				if err := a.users.SetPasswordResetRequired(ctx, targetID); err != nil {
+					return err
+				}
+				a.record(ctx, audit.ActionPasswordResetRequest, target.ID, map[string]interface{}{
+					"password_reset_required": true,
+				})
+				if err := a.revokeSessions(ctx, target.ID); err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "%s must reset their password before signing in again; their sessions were revoked\n", target.Username)
+				return nil
+			}
+
+			password, generated, err := readPassword(cmd.InOrStdin(), flags.passwordStdin)
+			if err != nil {
+				return err
+			}
+			hash, err := auth.HashPassword(ctx, password)
+			if err != nil {
+				return err
+			}
+			if err := a.users.UpdateUserPasswordByID(ctx, target.ID, hash); err != nil {
+				return err
+			}
+			a.record(ctx, audit.ActionPasswordReset, target.ID, map[string]interface{}{})
+			if err := a.revokeSessions(ctx, target.ID); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(out, "set a new password for %s and revoked their sessions\n", target.Username)
+			if generated {
+				fmt.Fprintf(out, "password: %s\n", password)
+			}
+			return nil
+		})
+	},
+}
+
+var userRevokeSessionsCmd = &cobra.Command{
+	Use:   "revoke-sessions USER",
+	Short: "Sign a user out everywhere",
+	Long: `Revoke every session of a user, including impersonation sessions. Tokens
+issued before now are rejected; the user can sign in again.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withUserAdmin(func(ctx context.Context, a *userAdmin) error {
+			target, err := a.findUser(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if err := a.revokeSessions(ctx, target.ID); err != nil {
+				return err
+			}
+			a.record(ctx, audit.ActionSessionRevoke, target.ID, map[string]interface{}{
+				"all_sessions": true,
+			})
+
+			fmt.Fprintf(cmd.OutOrStdout(), "revoked the sessions of %s\n", target.Username)
+			return nil
+		})
+	},
+}
+
+var userListFlags struct {
+	filters []string
+	exact   bool
+	limit   int
+	output  string
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List users",
+	Long: `List users, oldest first. Filters are given as KEY=VALUE and combined:
+
+  email, username, full_name   match a substring, or the whole value with --exact
+  role, status                 match exactly
+  deleted                      exclude (default), include or only
+  role_self_assigned           true for elevated roles awaiting an admin review
+  created_from, created_to     an RFC 3339 timestamp or a date like 2024-01-31`,
+	Example: `  auth-service user list --filter role=admin
+  auth-service user list --filter role_self_assigned=true
+  auth-service user list --filter status=pending --filter role=courier --output json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		flags := userListFlags
+		if flags.limit < 1 {
+			return errors.New("--limit must be positive")
+		}
+		if flags.output != "table" && flags.output != "json" {
+			return errors.New("--output must be table or json")
+		}
+
+		filter, err := parseUserListFilter(flags.filters)
+		if err != nil {
+			return err
+		}
+		if flags.exact {
+			filter.Match = models.MatchExact
+		}
+		filter.Limit = flags.limit
+
+		return withUserAdmin(func(ctx context.Context, a *userAdmin) error {
+			list, err := a.users.GetAllUsers(ctx, filter)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if flags.output == "json" {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				return enc.Encode(list.Items)
+			}
+
+			w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tUSERNAME\tEMAIL\tPHONE\tROLE\tSTATUS\tCREATED")
+			for _, u := range list.Items {
+				phoneNumber := ""
+				if u.Phone != nil {
+					phoneNumber = *u.Phone
+				}
+				role := u.Role
+				if u.RoleSelfAssigned {
+					role += " (self-assigned)"
+				}
+				status := u.Status
+				if u.DeletedAt != nil {
+					status += " (deleted)"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", u.ID, u.Username, u.Email, phoneNumber, role, status, u.CreatedAt.UTC().Format(time.DateOnly))
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if list.NextCursor != "" {
+				fmt.Fprintf(cmd.ErrOrStderr(), "only the first %d users are shown; narrow the filter or raise --limit\n", flags.limit)
+			}
+			return nil
+		})
+	},
+}
+
+// parseUserListFilter reads the KEY=VALUE filters of user list.
+func parseUserListFilter(filters []string) (models.GetAllUsers, error) {
+	filter := models.GetAllUsers{
+		Match:     models.MatchPartial,
+		SortBy:    models.SortByCreatedAt,
+		SortOrder: models.SortAsc,
+		Deleted:   models.DeletedExclude,
+	}
+
+	for _, f := range filters {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || value == "" {
+			return filter, fmt.Errorf("invalid filter %q, expected KEY=VALUE", f)
+		}
+		switch key {
+		case "email":
+			filter.Email = value
+		case "username":
+			filter.Username = value
+		case "full_name":
+			filter.FullName = value
+		case "role":
+			if !validation.IsRole(value) {
+				return filter, fmt.Errorf("unknown role %q", value)
+			}
+			filter.Role = value
+		case "status":
+			if !validation.IsUserStatus(value) {
+				return filter, fmt.Errorf("unknown status %q", value)
+			}
+			filter.Status = value
+		case "role_self_assigned":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return filter, fmt.Errorf("role_self_assigned must be a boolean")
+			}
+			filter.SelfAssigned = &b
+		case "deleted":
+			switch value {
+			case models.DeletedExclude, models.DeletedInclude, models.DeletedOnly:
+				filter.Deleted = value
+			default:
+				return filter, fmt.Errorf("deleted must be one of %s, %s, %s", models.DeletedExclude, models.DeletedInclude, models.DeletedOnly)
+			}
+		case "created_from", "created_to":
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				if t, err = time.Parse(time.DateOnly, value); err != nil {
+					return filter, fmt.Errorf("%s must be an RFC 3339 timestamp or a date", key)
+				}
+			}
+			if key == "created_from" {
+				filter.CreatedFrom = &t
+			} else {
+				filter.CreatedTo = &t
+			}
+		default:
+			return filter, fmt.Errorf("unknown filter %q", key)
+		}
+	}
+
+	return filter, nil
+}
+
+// userAdmin holds the connections used by the user commands.
+type userAdmin struct {
+	cfg         *config.Config
+	users       *user.UserRepo
+	auditRepo   *audit.AuditRepo
+	redisClient *redis.Client // Connected on first use, only some commands need it
+}
+
+// withUserAdmin connects to the database and runs fn.
+func withUserAdmin(fn func(ctx context.Context, a *userAdmin) error) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	pool, err := db.Connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	a := &userAdmin{
+		cfg:       cfg,
+		users:     user.NewUserRepo(pool),
+		auditRepo: audit.NewAuditRepo(pool),
+	}
+	defer func() {
+		if a.redisClient != nil {
+			a.redisClient.Close()
+		}
+	}()
+
+	return fn(context.Background(), a)
+}
+
+// findUser looks up a user by ID, email or phone number.
+func (a *userAdmin) findUser(ctx context.Context, ref string) (*models.User, error) {
+	var (
+		found *models.User
+		err   error
+	)
+	if id, parseErr := uuid.Parse(ref); parseErr == nil {
+		found, err = a.users.GetUserByID(ctx, id)
+	} else if strings.Contains(ref, "@") {
+		found, err = a.users.GetUserByEmail(ctx, ref)
+	} else if normalized, parseErr := phone.Normalize(ref); parseErr == nil {
+		found, err = a.users.GetUserByPhone(ctx, normalized)
+	} else {
+		return nil, fmt.Errorf("%q is not a user ID, email or phone number", ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("user %s not found: %w", ref, err)
+	}
+	return found, nil
+}
+
+// revokeSessions revokes every session of the user.
+func (a *userAdmin) revokeSessions(ctx context.Context, userID string) error {
+	if a.redisClient == nil {
+		client, err := redis.Connect(a.cfg)
+		if err != nil {
+			return err
+		}
+		a.redisClient = client
+	}
+	return a.redisClient.RevokeUserSessions(ctx, userID, a.cfg.SessionLifetime())
+}
+
+// record appends a change made with the user commands to the audit log.
+func (a *userAdmin) record(ctx context.Context, action string, targetID string, details map[string]interface{}) {
+	details["operator"] = operatorName()
+	a.auditRepo.Record(ctx, &models.AuditEvent{
+		Action:    action,
+		TargetID:  targetID,
+		UserAgent: cliUserAgent,
+		Diff:      audit.Details(details),
+	})
+}
+
+// operatorName returns the login name of the operator running the command.
+func operatorName() string {
+	if u, err := osuser.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// readPassword reads a password from the first line of in, or generates one if
+// fromStdin is false. generated reports whether it was generated.
+func readPassword(in io.Reader, fromStdin bool) (password string, generated bool, err error) {
+	if !fromStdin {
+		password, err = auth.GeneratePassword()
+		return password, true, err
+	}
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", false, fmt.Errorf("failed to read password: %w", err)
+	}
+	password = strings.TrimRight(line, "\r\n")
+	if len(password) < 8 || len(password) > 72 {
+		return "", false, errors.New("the password must be 8 to 72 characters")
+	}
+	return password, false, nil
+}
+
+func init() {
+	userCreateCmd.Flags().StringVar(&userCreateFlags.username, "username", "", "username (required)")
+	userCreateCmd.Flags().StringVar(&userCreateFlags.email, "email", "", "email address")
+	userCreateCmd.Flags().StringVar(&userCreateFlags.phone, "phone", "", "phone number in international format")
+	userCreateCmd.Flags().StringVar(&userCreateFlags.fullName, "full-name", "", "full name")
+	userCreateCmd.Flags().StringVar(&userCreateFlags.dateOfBirth, "date-of-birth", "", "date of birth as YYYY-MM-DD, required for roles with a minimum age")
+	userCreateCmd.Flags().StringVar(&userCreateFlags.role, "role", models.RoleUser, "role of the account")
+	userCreateCmd.Flags().StringVar(&userCreateFlags.orgID, "org", "", "organization ID, for org owners and staff")
+	userCreateCmd.Flags().BoolVar(&userCreateFlags.passwordStdin, "password-stdin", false, "read the password from stdin instead of generating one")
+	userCreateCmd.MarkFlagRequired("username")
+
+	userResetPasswordCmd.Flags().BoolVar(&userResetPasswordFlags.passwordStdin, "password-stdin", false, "read the password from stdin instead of generating one")
+	userResetPasswordCmd.Flags().BoolVar(&userResetPasswordFlags.requireReset, "require-reset", false, "make the user reset their password with forgot password instead")
+
+	userListCmd.Flags().StringArrayVar(&userListFlags.filters, "filter", nil, "KEY=VALUE filter, may be repeated")
+	userListCmd.Flags().BoolVar(&userListFlags.exact, "exact", false, "match email, username and full name exactly")
+	userListCmd.Flags().IntVar(&userListFlags.limit, "limit", 50, "maximum number of users to list")
+	userListCmd.Flags().StringVarP(&userListFlags.output, "output", "o", "table", "output format: table or json")
+
+	userCmd.AddCommand(userCreateCmd, userSetRoleCmd, userSetStatusCmd, userResetPasswordCmd, userRevokeSessionsCmd, userListCmd)
+	rootCmd.AddCommand(userCmd)
+}
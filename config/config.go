@@ -1,17 +1,58 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/cast"
 )
 
+// Development defaults that must be overridden in production.
+const (
+	DefaultJWTSecretKey     = "your_secret_key"
+	DefaultPostgresPassword = "root"
+	DefaultEmailFromAddress = "your_email@example.com"
+)
+
 // Config struct holds the configuration settings.
 type Config struct {
 	Environment string // Development, Production, etc.
 	HTTPPort    string
+	AppBaseURL  string // Public URL of the API, used to build links sent by email
+	FrontendURL string // Public URL of the web app, whose pages take the tokens of links sent by email
+	LogLevel    string // debug, info, warn or error
+
+	// HTTP Server Configuration
+	HTTPReadTimeout       int // In seconds, how long reading a whole request may take
+	HTTPReadHeaderTimeout int // In seconds, how long reading request headers may take
+	HTTPWriteTimeout      int // In seconds, how long writing a response may take
+	HTTPIdleTimeout       int // In seconds, how long idle keep-alive connections are kept
+	HTTPMaxHeaderBytes    int // Largest accepted request header size
+
+	// gRPC Server Configuration
+	GRPCPort    string   // Empty to disable the gRPC API
+	GRPCAPIKeys []string // Keys internal services present to the gRPC API
+
+	// Shutdown Configuration
+	ShutdownDelay   int // In seconds, how long readiness fails before the server stops accepting connections
+	ShutdownTimeout int // In seconds, how long in-flight requests and background work may take to drain
+
+	// Health Check Configuration
+	HealthCheckTimeout  int // In seconds, how long each readiness check may take
+	StartupRetries      int // How many times connecting to a dependency is retried at startup, 0 to fail at once
+	StartupRetryBackoff int // In seconds, the wait before the first retry; it doubles after each one
+
+	// Tracing Configuration
+	TracingExporter     string  // none, stdout, file or otlp
+	TracingFile         string  // Used by the file exporter
+	TracingOTLPEndpoint string  // OTLP/HTTP endpoint URL; defaults to OTEL_EXPORTER_OTLP_ENDPOINT
+	TracingServiceName  string  // Reported as service.name
+	TracingSampleRatio  float64 // Fraction of new traces recorded, from 0 to 1
 
 	// PostgreSQL Configuration
 	PostgresUser     string
@@ -19,6 +60,7 @@ type Config struct {
 	PostgresHost     string
 	PostgresPort     string
 	PostgresDatabase string
+	MigrateOnStart   bool // Apply pending migrations before serving
 
 	// Redis Configuration
 	RedisAddress  string
@@ -26,8 +68,9 @@ type Config struct {
 	RedisDB       int
 
 	// JWT Configuration
-	JWTSecretKey string
-	JWTExpiry    int // In minutes
+	JWTSecretKey       string
+	JWTExpiry          int // In minutes
+	RefreshTokenExpiry int // In days, how long an unused session stays signed in
 
 	// Email Configuration (if using email OTP)
 	EmailSender      string
@@ -35,13 +78,88 @@ type Config struct {
 	EmailHost        string
 	EmailPort        int
 	EmailFromAddress string
+
+	// SMS Configuration
+	SMSDriver    string // console, file or http
+	SMSFilePath  string // Used by the file driver
+	SMSHTTPURL   string // Used by the http driver
+	SMSHTTPToken string // Bearer token for the http driver, optional
+	SMSFrom      string // Sender name passed to the http driver
+
+	// Invite Configuration
+	InviteExpiry int // In hours
+
+	// Impersonation Configuration
+	ImpersonationExpiry      int  // In minutes
+	ImpersonationAllowWrites bool // Whether impersonated sessions may use non-GET requests
+
+	// Device Configuration
+	DeviceExpiry int // In days, how long a device stays known after its last sign-in
+
+	// User Purge Configuration
+	UserPurgeGracePeriod int    // In days, how long deleted users can be restored
+	UserPurgeMode        string // anonymize or delete
+	UserPurgeInterval    int    // In minutes, how often the purge job runs
+
+	// Data Export Configuration
+	DataExportExpiry int // In hours, how long a personal data export can be downloaded
+
+	// Social Login Configuration
+	OAuthProviders    []OAuthProvider
+	OAuthMockProvider bool // Registers an in-process mock OIDC provider named "mock", outside production only
+
+	// Age Requirement Configuration
+	RoleMinimumAges        map[string]int // In years, by role; roles not listed have no minimum beyond registration's
+	invalidRoleMinimumAges []string       // Entries of ROLE_MINIMUM_AGES that are not role:age pairs, reported by Validate
+}
+
+// OAuth provider types.
+const (
+	OAuthTypeOIDC     = "oidc"
+	OAuthTypeApple    = "apple"
+	OAuthTypeTelegram = "telegram"
+)
+
+// OAuthProvider configures a social login provider. Providers are listed in
+// OAUTH_PROVIDERS and each one is configured by OAUTH_<NAME>_* variables.
+type OAuthProvider struct {
+	Name         string
+	Type         string // oidc, apple or telegram
+	Issuer       string // OIDC issuer, used for discovery
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	// Apple signs the client secret itself with a private key from the developer account
+	AppleTeamID     string
+	AppleKeyID      string
+	ApplePrivateKey string // PEM-encoded
+
+	// Telegram Login Widget
+	BotToken string
 }
 
-// Load loads the configuration from environment variables.
-func Load() Config {
+// Load loads the configuration. Each setting is taken from the first of:
+//   - the environment variable, such as JWT_SECRET_KEY
+//   - the file named by its _FILE variant, such as JWT_SECRET_KEY_FILE, for Docker and Kubernetes secrets
+//   - the YAML or TOML config file at path, if path is not empty
+//   - the built-in default
+//
+// A .env file in the working directory is loaded into the environment first.
+// The result is not validated; call Validate before using it to serve.
+func Load(path string) (Config, error) {
 	// Load environment variables from .env file (if it exists)
-	if err := godotenv.Load(); err != nil {
-		fmt.Println("No .env file found, loading from environment variables")
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Config{}, fmt.Errorf("failed to load .env file: %w", err)
+	}
+
+	fileValues = nil
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		fileValues = values
 	}
 
 	config := Config{}
@@ -49,13 +167,48 @@ func Load() Config {
 	// General Configuration
 	config.Environment = cast.ToString(getOrReturnDefault("ENVIRONMENT", "development"))
 	config.HTTPPort = cast.ToString(getOrReturnDefault("HTTP_PORT", ":8080"))
+	config.AppBaseURL = cast.ToString(getOrReturnDefault("APP_BASE_URL", "http://localhost:8080"))
+	config.FrontendURL = cast.ToString(getOrReturnDefault("FRONTEND_URL", "http://localhost:3000"))
+	config.LogLevel = cast.ToString(getOrReturnDefault("LOG_LEVEL", "info"))
+
+	// HTTP Server Configuration
+	config.HTTPReadTimeout = cast.ToInt(getOrReturnDefault("HTTP_READ_TIMEOUT", 15))
+	config.HTTPReadHeaderTimeout = cast.ToInt(getOrReturnDefault("HTTP_READ_HEADER_TIMEOUT", 5))
+	config.HTTPWriteTimeout = cast.ToInt(getOrReturnDefault("HTTP_WRITE_TIMEOUT", 60))
+	config.HTTPIdleTimeout = cast.ToInt(getOrReturnDefault("HTTP_IDLE_TIMEOUT", 120))
+	config.HTTPMaxHeaderBytes = cast.ToInt(getOrReturnDefault("HTTP_MAX_HEADER_BYTES", 1<<20))
+
+	// gRPC Server Configuration
+	config.GRPCPort = cast.ToString(getOrReturnDefault("GRPC_PORT", ":9090"))
+	for _, key := range strings.Split(cast.ToString(getOrReturnDefault("GRPC_API_KEYS", "")), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			config.GRPCAPIKeys = append(config.GRPCAPIKeys, key)
+		}
+	}
+
+	// Shutdown Configuration
+	config.ShutdownDelay = cast.ToInt(getOrReturnDefault("SHUTDOWN_DELAY", 5))
+	config.ShutdownTimeout = cast.ToInt(getOrReturnDefault("SHUTDOWN_TIMEOUT", 30))
+
+	// Health Check Configuration
+	config.HealthCheckTimeout = cast.ToInt(getOrReturnDefault("HEALTH_CHECK_TIMEOUT", 2))
+	config.StartupRetries = cast.ToInt(getOrReturnDefault("STARTUP_RETRIES", 0))
+	config.StartupRetryBackoff = cast.ToInt(getOrReturnDefault("STARTUP_RETRY_BACKOFF", 1))
+
+	// Tracing Configuration
+	config.TracingExporter = cast.ToString(getOrReturnDefault("TRACING_EXPORTER", "none"))
+	config.TracingFile = cast.ToString(getOrReturnDefault("TRACING_FILE", "traces.json"))
+	config.TracingOTLPEndpoint = cast.ToString(getOrReturnDefault("TRACING_OTLP_ENDPOINT", ""))
+	config.TracingServiceName = cast.ToString(getOrReturnDefault("TRACING_SERVICE_NAME", "auth-service"))
+	config.TracingSampleRatio = cast.ToFloat64(getOrReturnDefault("TRACING_SAMPLE_RATIO", 1.0))
 
 	// PostgreSQL Configuration
 	config.PostgresUser = cast.ToString(getOrReturnDefault("POSTGRES_USER", "sayyidmuhammad"))
-	config.PostgresPassword = cast.ToString(getOrReturnDefault("POSTGRES_PASSWORD", "root"))
+	config.PostgresPassword = cast.ToString(getOrReturnDefault("POSTGRES_PASSWORD", DefaultPostgresPassword))
 	config.PostgresHost = cast.ToString(getOrReturnDefault("POSTGRES_HOST", "localhost"))
 	config.PostgresPort = cast.ToString(getOrReturnDefault("POSTGRES_PORT", "5432"))
 	config.PostgresDatabase = cast.ToString(getOrReturnDefault("POSTGRES_DATABASE", "postgres"))
+	config.MigrateOnStart = cast.ToBool(getOrReturnDefault("MIGRATE_ON_START", false))
 
 	// Redis Configuration
 	config.RedisAddress = cast.ToString(getOrReturnDefault("REDIS_ADDRESS", "localhost:6379"))
@@ -63,24 +216,136 @@ func Load() Config {
 	config.RedisDB = cast.ToInt(getOrReturnDefault("REDIS_DB", 0))
 
 	// JWT Configuration
-	config.JWTSecretKey = cast.ToString(getOrReturnDefault("JWT_SECRET_KEY", "your_secret_key"))
+	config.JWTSecretKey = cast.ToString(getOrReturnDefault("JWT_SECRET_KEY", DefaultJWTSecretKey))
 	config.JWTExpiry = cast.ToInt(getOrReturnDefault("JWT_EXPIRY", 60))
+	config.RefreshTokenExpiry = cast.ToInt(getOrReturnDefault("REFRESH_TOKEN_EXPIRY", 30))
 
 	// Email Configuration (if using email OTP)
-	config.EmailSender = cast.ToString(getOrReturnDefault("EMAIL_SENDER", "qodirovazizbek1129@gmail.com"))
-	config.EmailPassword = cast.ToString(getOrReturnDefault("EMAIL_PASSWORD", "jkzt mtab wvaq ewlm llldsf"))
+	config.EmailSender = cast.ToString(getOrReturnDefault("EMAIL_SENDER", ""))
+	config.EmailPassword = cast.ToString(getOrReturnDefault("EMAIL_PASSWORD", ""))
 	config.EmailHost = cast.ToString(getOrReturnDefault("EMAIL_HOST", "smtp.gmail.com"))
 	config.EmailPort = cast.ToInt(getOrReturnDefault("EMAIL_PORT", 587))
-	config.EmailFromAddress = cast.ToString(getOrReturnDefault("EMAIL_FROM_ADDRESS", "your_email@example.com"))
+	config.EmailFromAddress = cast.ToString(getOrReturnDefault("EMAIL_FROM_ADDRESS", DefaultEmailFromAddress))
+
+	// SMS Configuration
+	config.SMSDriver = cast.ToString(getOrReturnDefault("SMS_DRIVER", "console"))
+	config.SMSFilePath = cast.ToString(getOrReturnDefault("SMS_FILE_PATH", ""))
+	config.SMSHTTPURL = cast.ToString(getOrReturnDefault("SMS_HTTP_URL", ""))
+	config.SMSHTTPToken = cast.ToString(getOrReturnDefault("SMS_HTTP_TOKEN", ""))
+	config.SMSFrom = cast.ToString(getOrReturnDefault("SMS_FROM", "TimeCapsule"))
+
+	// Invite Configuration
+	config.InviteExpiry = cast.ToInt(getOrReturnDefault("INVITE_EXPIRY", 72))
+
+	// Impersonation Configuration
+	config.ImpersonationExpiry = cast.ToInt(getOrReturnDefault("IMPERSONATION_EXPIRY", 15))
+	config.ImpersonationAllowWrites = cast.ToBool(getOrReturnDefault("IMPERSONATION_ALLOW_WRITES", false))
+
+	// Device Configuration
+	config.DeviceExpiry = cast.ToInt(getOrReturnDefault("DEVICE_EXPIRY", 90))
+
+	// User Purge Configuration
+	config.UserPurgeGracePeriod = cast.ToInt(getOrReturnDefault("USER_PURGE_GRACE_PERIOD", 30))
+	config.UserPurgeMode = cast.ToString(getOrReturnDefault("USER_PURGE_MODE", "anonymize"))
+	config.UserPurgeInterval = cast.ToInt(getOrReturnDefault("USER_PURGE_INTERVAL", 60))
+
+	// Data Export Configuration
+	config.DataExportExpiry = cast.ToInt(getOrReturnDefault("DATA_EXPORT_EXPIRY", 24))
 
-	return config
+	// Social Login Configuration
+	for _, name := range strings.Split(cast.ToString(getOrReturnDefault("OAUTH_PROVIDERS", "")), ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			config.OAuthProviders = append(config.OAuthProviders, loadOAuthProvider(name))
+		}
+	}
+	config.OAuthMockProvider = cast.ToBool(getOrReturnDefault("OAUTH_MOCK_PROVIDER", false))
+
+	// Age Requirement Configuration
+	config.RoleMinimumAges, config.invalidRoleMinimumAges = parseRoleMinimumAges(cast.ToString(getOrReturnDefault("ROLE_MINIMUM_AGES", "courier:18,staff:18,support:18,org_owner:18,admin:18")))
+
+	return config, nil
 }
 
-// getOrReturnDefault retrieves the value of an environment variable or returns a default value if it's not set.
+// SessionLifetime returns how long a session can last: until its refresh
+// token expires, or its access token if that lives longer.
+func (c *Config) SessionLifetime() time.Duration {
+	access := time.Duration(c.JWTExpiry) * time.Minute
+	refresh := time.Duration(c.RefreshTokenExpiry) * 24 * time.Hour
+	if access > refresh {
+		return access
+	}
+	return refresh
+}
+
+// MinimumAge returns the minimum age in years for the role, or 0 if it has none.
+func (c *Config) MinimumAge(role string) int {
+	return c.RoleMinimumAges[role]
+}
+
+// parseRoleMinimumAges parses a list of role:age pairs such as "courier:18,staff:18".
+// It also returns the entries that are not valid pairs.
+func parseRoleMinimumAges(value string) (map[string]int, []string) {
+	ages := map[string]int{}
+	var invalid []string
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		role, age, ok := strings.Cut(pair, ":")
+		role = strings.TrimSpace(role)
+		years, err := cast.ToIntE(strings.TrimSpace(age))
+		if !ok || role == "" || err != nil || years < 0 {
+			invalid = append(invalid, pair)
+			continue
+		}
+		ages[role] = years
+	}
+	return ages, invalid
+}
+
+// loadOAuthProvider loads the configuration of the named social login provider.
+// Google and Apple work with just a client ID and secret (or Apple key).
+func loadOAuthProvider(name string) OAuthProvider {
+	prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+
+	defaultType, defaultIssuer, defaultScopes := OAuthTypeOIDC, "", "openid email profile"
+	switch name {
+	case "google":
+		defaultIssuer = "https://accounts.google.com"
+	case OAuthTypeApple:
+		defaultType, defaultIssuer, defaultScopes = OAuthTypeApple, "https://appleid.apple.com", "openid email name"
+	case OAuthTypeTelegram:
+		defaultType = OAuthTypeTelegram
+	}
+
+	return OAuthProvider{
+		Name:            name,
+		Type:            cast.ToString(getOrReturnDefault(prefix+"TYPE", defaultType)),
+		Issuer:          cast.ToString(getOrReturnDefault(prefix+"ISSUER", defaultIssuer)),
+		ClientID:        cast.ToString(getOrReturnDefault(prefix+"CLIENT_ID", "")),
+		ClientSecret:    cast.ToString(getOrReturnDefault(prefix+"CLIENT_SECRET", "")),
+		Scopes:          strings.Fields(cast.ToString(getOrReturnDefault(prefix+"SCOPES", defaultScopes))),
+		AppleTeamID:     cast.ToString(getOrReturnDefault(prefix+"TEAM_ID", "")),
+		AppleKeyID:      cast.ToString(getOrReturnDefault(prefix+"KEY_ID", "")),
+		ApplePrivateKey: cast.ToString(getOrReturnDefault(prefix+"PRIVATE_KEY", "")),
+		BotToken:        cast.ToString(getOrReturnDefault(prefix+"BOT_TOKEN", "")),
+	}
+}
+
+// getOrReturnDefault retrieves the value of a setting from the environment, a
+// secret file or the config file, or returns a default value if it's not set.
 func getOrReturnDefault(key string, defaultValue interface{}) interface{} {
 	val, exists := os.LookupEnv(key)
 	if exists {
 		return val
 	}
+	if path, exists := os.LookupEnv(key + "_FILE"); exists {
+		// Read errors leave the setting empty so that validation reports it.
+		content, _ := os.ReadFile(path)
+		return strings.TrimRight(string(content), "\r\n")
+	}
+	if val, exists := fileValues[key]; exists {
+		return val
+	}
 	return defaultValue
 }
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v3"
+)
+
+// fileValues holds the settings read from the config file, keyed like the
+// environment variables.
+var fileValues map[string]interface{}
+
+// readFile reads a YAML or TOML config file, chosen by extension. Keys are
+// the environment variable names in any case, and sections are joined to
+// their keys with an underscore, so both of these set POSTGRES_HOST:
+//
+//	postgres_host: db
+//
+//	postgres:
+//	  host: db
+//
+// Lists are joined with commas, as in OAUTH_PROVIDERS.
+func readFile(path string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &raw)
+	case ".toml":
+		err = toml.Unmarshal(content, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q, use .yaml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	values := map[string]interface{}{}
+	flatten(values, "", raw)
+	return values, nil
+}
+
+func flatten(values map[string]interface{}, prefix string, raw map[string]interface{}) {
+	for key, value := range raw {
+		key = strings.ToUpper(prefix + key)
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flatten(values, key+"_", v)
+		case []interface{}:
+			values[key] = strings.Join(cast.ToStringSlice(v), ",")
+		default:
+			values[key] = v
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// EnvironmentProduction is the environment in which development defaults are refused.
+const EnvironmentProduction = "production"
+
+// minJWTSecretKeyLength is the shortest JWT signing key accepted in
+// production, 256 bits for HS256.
+const minJWTSecretKeyLength = 32
+
+// minGRPCAPIKeyLength is the shortest gRPC API key accepted in production.
+const minGRPCAPIKeyLength = 32
+
+// Redacted replaces secrets in printed configuration.
+const Redacted = "[REDACTED]"
+
+// IsProduction reports whether the service runs in production.
+func (c *Config) IsProduction() bool {
+	return c.Environment == EnvironmentProduction
+}
+
+// Validate reports every setting that would make the service unsafe or unable
+// to run. In production it also refuses the development defaults.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "LOG_LEVEL %q is not one of debug, info, warn or error", c.LogLevel)
+	check(c.JWTSecretKey != "", "JWT_SECRET_KEY is required")
+	check(c.JWTExpiry > 0, "JWT_EXPIRY must be positive")
+	check(c.RefreshTokenExpiry > 0, "REFRESH_TOKEN_EXPIRY must be positive")
+	check(c.TracingSampleRatio >= 0 && c.TracingSampleRatio <= 1, "TRACING_SAMPLE_RATIO must be between 0 and 1")
+	check(c.UserPurgeMode == "anonymize" || c.UserPurgeMode == "delete", "USER_PURGE_MODE %q is not one of anonymize or delete", c.UserPurgeMode)
+	for _, entry := range c.invalidRoleMinimumAges {
+		check(false, "ROLE_MINIMUM_AGES entry %q is not a role:age pair with a non-negative age", entry)
+	}
+
+	if c.IsProduction() {
+		check(c.JWTSecretKey != DefaultJWTSecretKey, "JWT_SECRET_KEY must not be the default in production")
+		check(len(c.JWTSecretKey) >= minJWTSecretKeyLength, "JWT_SECRET_KEY must be at least %d characters in production", minJWTSecretKeyLength)
+		check(c.PostgresPassword != DefaultPostgresPassword, "POSTGRES_PASSWORD must not be the default in production")
+		check(c.EmailHost != "" && c.EmailPort > 0, "EMAIL_HOST and EMAIL_PORT are required in production")
+		check(c.EmailSender != "" && c.EmailPassword != "", "EMAIL_SENDER and EMAIL_PASSWORD are required in production")
+		check(c.EmailFromAddress != "" && c.EmailFromAddress != DefaultEmailFromAddress, "EMAIL_FROM_ADDRESS must be set in production")
+		check(!c.OAuthMockProvider, "OAUTH_MOCK_PROVIDER must not be enabled in production")
+		// The console and file drivers only write codes out locally, which would lock out phone users.
+		check(c.SMSDriver == "http" && c.SMSHTTPURL != "", "SMS_DRIVER must be http with SMS_HTTP_URL set in production")
+		if c.GRPCPort != "" {
+			check(len(c.GRPCAPIKeys) > 0, "GRPC_API_KEYS is required in production unless GRPC_PORT is empty")
+			for i, key := range c.GRPCAPIKeys {
+				check(len(key) >= minGRPCAPIKeyLength, "GRPC_API_KEYS entry %d must be at least %d characters in production", i+1, minGRPCAPIKeyLength)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the configuration with every secret replaced,
+// for printing.
+func (c Config) Redacted() Config {
+	redact := func(secret *string) {
+		if *secret != "" {
+			*secret = Redacted
+		}
+	}
+
+	redact(&c.PostgresPassword)
+	redact(&c.RedisPassword)
+	redact(&c.JWTSecretKey)
+	redact(&c.EmailPassword)
+	redact(&c.SMSHTTPToken)
+
+	keys := make([]string, len(c.GRPCAPIKeys))
+	for i := range keys {
+		keys[i] = Redacted
+	}
+	c.GRPCAPIKeys = keys
+
+	providers := make([]OAuthProvider, len(c.OAuthProviders))
+	for i, p := range c.OAuthProviders {
+		redact(&p.ClientSecret)
+		redact(&p.ApplePrivateKey)
+		redact(&p.BotToken)
+		providers[i] = p
+	}
+	c.OAuthProviders = providers
+
+	return c
+}
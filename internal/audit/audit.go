@@ -0,0 +1,271 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+)
+
+// chainLockKey is the advisory lock that serializes appends to the hash chain.
+const chainLockKey = 7312001
+
+// AuditRepo is the repository for the append-only audit log.
+type AuditRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewAuditRepo creates a new AuditRepo.
+func NewAuditRepo(db *pgxpool.Pool) *AuditRepo {
+	return &AuditRepo{
+		db: db,
+	}
+}
+
+const auditEventColumns = `
+	id, occurred_at, COALESCE(actor_id::text, ''), COALESCE(target_id::text, ''), action,
+	ip, user_agent, request_id, diff::text, prev_hash, hash
+`
+
+func scanAuditEvent(row pgx.Row) (*models.AuditEvent, error) {
+	var (
+		event models.AuditEvent
+		diff  *string
+	)
+	err := row.Scan(
+		&event.ID,
+		&event.OccurredAt,
+		&event.ActorID,
+		&event.TargetID,
+		&event.Action,
+		&event.IP,
+		&event.UserAgent,
+		&event.RequestID,
+		&diff,
+		&event.PrevHash,
+		&event.Hash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if diff != nil {
+		event.Diff = []byte(*diff)
+	}
+	return &event, nil
+}
+
+// Record appends the event to the audit log. Failures are logged rather than
+// returned so that auditing never breaks the request being audited.
+func (r *AuditRepo) Record(ctx context.Context, event *models.AuditEvent) {
+	// The event is stored even if the request it audits was canceled.
+	ctx = context.WithoutCancel(ctx)
+	if err := r.Append(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "failed to record audit event", "action", event.Action, "error", err)
+	}
+}
+
+// Append links the event to the end of the hash chain and stores it.
+func (r *AuditRepo) Append(ctx context.Context, event *models.AuditEvent) error {
+	actorID, err := normalizeID(event.ActorID)
+	if err != nil {
+		return fmt.Errorf("invalid actor ID: %w", err)
+	}
+	targetID, err := normalizeID(event.TargetID)
+	if err != nil {
+		return fmt.Errorf("invalid target ID: %w", err)
+	}
+	event.ActorID, event.TargetID = actorID, targetID
+	// Postgres keeps microseconds, truncate so the hash can be recomputed from the stored value.
+	event.OccurredAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", chainLockKey); err != nil {
+		return fmt.Errorf("failed to lock audit chain: %w", err)
+	}
+
+	event.PrevHash = genesisHash
+	err = tx.QueryRow(ctx, "SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1").Scan(&event.PrevHash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to get last audit hash: %w", err)
+	}
+
+	if err := tx.QueryRow(ctx, "SELECT nextval('audit_events_id_seq')").Scan(&event.ID); err != nil {
+		return fmt.Errorf("failed to allocate audit event ID: %w", err)
+	}
+	event.Hash = computeHash(event.PrevHash, event)
+
+	var diff *string
+	if event.Diff != nil {
+		s := string(event.Diff)
+		diff = &s
+	}
+
+	query := `
+		INSERT INTO audit_events (id, occurred_at, actor_id, target_id, action, ip, user_agent, request_id, diff, prev_hash, hash)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, NULLIF($4, '')::uuid, $5, $6, $7, $8, $9::text::json, $10, $11)
+	`
+	_, err = tx.Exec(ctx, query,
+		event.ID,
+		event.OccurredAt,
+		event.ActorID,
+		event.TargetID,
+		event.Action,
+		event.IP,
+		event.UserAgent,
+		event.RequestID,
+		diff,
+		event.PrevHash,
+		event.Hash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit event: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit audit event: %w", err)
+	}
+
+	return nil
+}
+
+// GetAllAuditEvents retrieves a page of audit events matching the filter, newest first.
+// The cursor is the ID of the last event of the previous page.
+func (r *AuditRepo) GetAllAuditEvents(ctx context.Context, filter models.GetAllAuditEvents) (*models.AuditEventList, error) {
+	query, args := buildAuditEventQuery(filter)
+	if filter.Cursor > 0 {
+		args = append(args, filter.Cursor)
+		query += fmt.Sprintf(" AND id < $%d", len(args))
+	}
+	args = append(args, filter.Limit+1)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit events: %w", err)
+	}
+	defer rows.Close()
+
+	list := &models.AuditEventList{Items: []*models.AuditEvent{}}
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit event row: %w", err)
+		}
+		list.Items = append(list.Items, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get audit events: %w", err)
+	}
+
+	if len(list.Items) > filter.Limit {
+		list.Items = list.Items[:filter.Limit]
+		list.NextCursor = fmt.Sprintf("%d", list.Items[len(list.Items)-1].ID)
+	}
+
+	return list, nil
+}
+
+// ExportAuditEvents calls fn for every audit event matching the filter, oldest first.
+func (r *AuditRepo) ExportAuditEvents(ctx context.Context, filter models.GetAllAuditEvents, fn func(*models.AuditEvent) error) error {
+	query, args := buildAuditEventQuery(filter)
+	query += " ORDER BY id ASC"
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to export audit events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan audit event row: %w", err)
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// VerifyChain recomputes every hash in the audit log and checks that each event
+// links to its predecessor. It reports the first event where the chain breaks.
+func (r *AuditRepo) VerifyChain(ctx context.Context) (*models.AuditChainStatus, error) {
+	status := &models.AuditChainStatus{Valid: true}
+	prevHash := genesisHash
+
+	err := r.ExportAuditEvents(ctx, models.GetAllAuditEvents{}, func(event *models.AuditEvent) error {
+		status.Checked++
+		if event.PrevHash != prevHash || computeHash(event.PrevHash, event) != event.Hash {
+			status.Valid = false
+			status.FirstInvalidID = event.ID
+			return errChainBroken
+		}
+		prevHash = event.Hash
+		return nil
+	})
+	if err != nil && !errors.Is(err, errChainBroken) {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+var errChainBroken = errors.New("audit chain broken")
+
+func buildAuditEventQuery(filter models.GetAllAuditEvents) (string, []interface{}) {
+	var args []interface{}
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events WHERE 1 = 1`
+
+	if filter.ActorID != "" {
+		args = append(args, filter.ActorID)
+		query += fmt.Sprintf(" AND actor_id = $%d", len(args))
+	}
+	if filter.TargetID != "" {
+		args = append(args, filter.TargetID)
+		query += fmt.Sprintf(" AND target_id = $%d", len(args))
+	}
+	if filter.Action != "" {
+		args = append(args, filter.Action)
+		query += fmt.Sprintf(" AND action = $%d", len(args))
+	}
+	if filter.RequestID != "" {
+		args = append(args, filter.RequestID)
+		query += fmt.Sprintf(" AND request_id = $%d", len(args))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		query += fmt.Sprintf(" AND occurred_at >= $%d", len(args))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		query += fmt.Sprintf(" AND occurred_at < $%d", len(args))
+	}
+
+	return query, args
+}
+
+// normalizeID returns the canonical form of a UUID so that the hashed value
+// matches what Postgres returns when the event is read back.
+func normalizeID(id string) (string, error) {
+	if id == "" {
+		return "", nil
+	}
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return "", err
+	}
+	return parsed.String(), nil
+}
@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+)
+
+// Audit actions.
+const (
+	ActionLogin                = "auth.login"
+	ActionLoginFailed          = "auth.login_failed"
+	ActionNewDevice            = "auth.new_device"
+	ActionSessionRevoke        = "session.revoke"
+	ActionPasswordResetRequest = "auth.password_reset_requested"
+	ActionPasswordReset        = "auth.password_reset"
+	ActionUserCreate           = "user.create"
+	ActionUserStatusChange     = "user.status_change"
+	ActionUserRoleChange       = "user.role_change"
+	ActionUserUpdate           = "user.update"
+	ActionUserDelete           = "user.delete"
+	ActionUserRestore          = "user.restore"
+	ActionUserPurge            = "user.purge"
+	ActionUserDataExport       = "user.data_export"
+	ActionUserErase            = "user.erase"
+	ActionPhoneVerified        = "user.phone_verified"
+	ActionAgeVerification      = "user.age_verification"
+	ActionIdentityLink         = "user.identity_link"
+	ActionIdentityUnlink       = "user.identity_unlink"
+	ActionRoleRequestReject    = "role_request.reject"
+	ActionInviteCreate         = "invite.create"
+	ActionInviteResend         = "invite.resend"
+	ActionInviteRevoke         = "invite.revoke"
+	ActionInviteAccept         = "invite.accept"
+	ActionImpersonationStart   = "impersonation.start"
+	ActionImpersonationRequest = "impersonation.request"
+)
+
+// genesisHash is the previous hash of the first event in the chain.
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// FromContext builds an event for the given action with the request metadata of c filled in.
+// The request ID is the one validated or generated by the request ID middleware.
+// The actor defaults to the authenticated user, or the impersonating user if there is one.
+func FromContext(c *gin.Context, action string) *models.AuditEvent {
+	actorID := c.GetString("actorID")
+	if actorID == "" {
+		actorID = c.GetString("userID")
+	}
+
+	return &models.AuditEvent{
+		ActorID:   actorID,
+		Action:    action,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		RequestID: c.GetString("requestID"),
+	}
+}
+
+// Details encodes arbitrary event data for the Diff field.
+func Details(details map[string]interface{}) json.RawMessage {
+	data, err := json.Marshal(details)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// Changes returns a diff of the form {"field": {"from": ..., "to": ...}} for
+// every field whose value differs between before and after. Personal fields
+// are recorded as {"field": {"changed": true}} without their values, because
+// the log is append-only and outlives the erasure of the user.
+func Changes(before, after map[string]interface{}, personal ...string) json.RawMessage {
+	diff := map[string]interface{}{}
+	for field, to := range after {
+		from := before[field]
+		if reflect.DeepEqual(from, to) {
+			continue
+		}
+		if slices.Contains(personal, field) {
+			diff[field] = map[string]interface{}{"changed": true}
+			continue
+		}
+		diff[field] = map[string]interface{}{"from": from, "to": to}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	return Details(diff)
+}
+
+// computeHash chains the event to prevHash. Every stored column takes part in
+// the hash so that editing any of them breaks the chain from that event on.
+func computeHash(prevHash string, event *models.AuditEvent) string {
+	h := sha256.New()
+	for _, field := range []string{
+		prevHash,
+		strconv.FormatInt(event.ID, 10),
+		event.OccurredAt.UTC().Format(time.RFC3339Nano),
+		event.ActorID,
+		event.TargetID,
+		event.Action,
+		event.IP,
+		event.UserAgent,
+		event.RequestID,
+		string(event.Diff),
+	} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
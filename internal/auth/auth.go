@@ -1,15 +1,31 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
 	"fmt"
-	"math/rand"
+	"math/big"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/metrics"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/tracing"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/validation"
+)
+
+// RestrictedAge is the age the age_over_18 claim attests to, the legal age for
+// restricted items such as alcohol.
+const RestrictedAge = 18
+
+// Types of the session tokens, as counted in metrics. Link tokens carry their
+// type in the "typ" claim.
+const (
+	accessTokenType        = "access"
+	impersonationTokenType = "impersonation"
 )
 
 // JWTManager manages JWT tokens.
@@ -26,21 +42,55 @@ func NewJWTManager(cfg *config.Config) *JWTManager {
 	}
 }
 
-// Generate generates and signs a new JWT token for the given user.
-func (manager *JWTManager) Generate(user *models.User) (string, error) {
+// Generate generates and signs a new JWT token for the given user and login
+// session. authTime is when the user signed in to the session, which tokens
+// issued by a refresh carry over.
+func (manager *JWTManager) Generate(user *models.User, sessionID string, authTime time.Time) (string, error) {
 	claims := jwt.MapClaims{
-		"id":   user.ID,
-		"role": user.Role,
-		"exp":  time.Now().Add(manager.tokenDuration).Unix(),
-		"iat":  time.Now().Unix(),
+		"id":           user.ID,
+		"role":         GrantedRole(user),
+		"sid":          sessionID,
+		"age_verified": user.AgeVerified,
+		"age_over_18":  IsOfAge(user, RestrictedAge),
+		"exp":          time.Now().Add(manager.tokenDuration).Unix(),
+		"iat":          time.Now().Unix(),
+		"auth_time":    authTime.Unix(),
 	}
 
+	return manager.sign(accessTokenType, claims)
+}
+
+// GenerateImpersonation generates a short-lived token that acts as the target user
+// on behalf of the actor. The actor is carried in the "act" claim.
+func (manager *JWTManager) GenerateImpersonation(target *models.User, actorID string, duration time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"id":           target.ID,
+		"role":         GrantedRole(target),
+		"act":          Actor{Subject: actorID},
+		"age_verified": target.AgeVerified,
+		"age_over_18":  IsOfAge(target, RestrictedAge),
+		"exp":          time.Now().Add(duration).Unix(),
+		"iat":          time.Now().Unix(),
+	}
+
+	return manager.sign(impersonationTokenType, claims)
+}
+
+// sign signs the claims and counts the issued token by type.
+func (manager *JWTManager) sign(tokenType string, claims jwt.Claims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(manager.secretKey))
+	signed, err := token.SignedString([]byte(manager.secretKey))
+	if err != nil {
+		return "", err
+	}
+	metrics.TokenIssued(tokenType)
+	return signed, nil
 }
 
 // Verify verifies the signature of the given JWT token and returns the user claims if valid.
-func (manager *JWTManager) Verify(accessToken string) (*UserClaims, error) {
+func (manager *JWTManager) Verify(accessToken string) (claims *UserClaims, err error) {
+	defer func() { metrics.TokenVerified(accessTokenType, err) }()
+
 	token, err := jwt.ParseWithClaims(
 		accessToken,
 		&UserClaims{},
@@ -57,8 +107,9 @@ func (manager *JWTManager) Verify(accessToken string) (*UserClaims, error) {
 		return nil, fmt.Errorf("invalid token: %w", err)
 	}
 
+	// Invite and revoke link tokens share the signing key but carry no user ID.
 	claims, ok := token.Claims.(*UserClaims)
-	if !ok {
+	if !ok || claims.ID == "" {
 		return nil, fmt.Errorf("invalid token claims")
 	}
 
@@ -71,6 +122,19 @@ type UserClaims struct {
 	ID   string `json:"id"`
 	Role string `json:"role"`
 	Iat  int64  `json:"iat"`
+	Sid  string `json:"sid,omitempty"`
+	Act  *Actor `json:"act,omitempty"`
+
+	// AuthTime is when the user signed in (OIDC "auth_time"); iat is renewed by every refresh.
+	AuthTime int64 `json:"auth_time,omitempty"`
+
+	AgeVerified bool `json:"age_verified"`
+	AgeOver18   bool `json:"age_over_18"` // Only set for verified dates of birth
+}
+
+// Actor identifies the user acting on behalf of the token subject (RFC 8693 "act" claim).
+type Actor struct {
+	Subject string `json:"sub"`
 }
 
 // GetUserID returns the user ID from the token claims.
@@ -88,8 +152,56 @@ func (c *UserClaims) GetIat() int64 {
 	return c.Iat
 }
 
+// GetAuthTime returns when the user signed in to the session of the token, or
+// 0 for tokens issued without it.
+func (c *UserClaims) GetAuthTime() int64 {
+	return c.AuthTime
+}
+
+// GetSessionID returns the login session the token was issued for.
+func (c *UserClaims) GetSessionID() string {
+	return c.Sid
+}
+
+// GetActorID returns the ID of the impersonating user, or an empty string for regular tokens.
+func (c *UserClaims) GetActorID() string {
+	if c.Act == nil {
+		return ""
+	}
+	return c.Act.Subject
+}
+
+// GrantedRole returns the role whose rights the user has. A role the user
+// assigned themselves when registration still accepted any role counts as a
+// customer's until an admin reviews it.
+func GrantedRole(user *models.User) string {
+	if user.RoleSelfAssigned {
+		return models.RoleUser
+	}
+	return user.Role
+}
+
+// IsOfAge reports whether the user is at least the given age according to a
+// date of birth that an admin has verified. Unverified dates never count.
+func IsOfAge(user *models.User, years int) bool {
+	if !user.AgeVerified || user.DateOfBirth.IsZero() {
+		return false
+	}
+	return validation.Age(user.DateOfBirth, time.Now()) >= years
+}
+
+// TokenDuration returns the lifetime of access tokens.
+func (manager *JWTManager) TokenDuration() time.Duration {
+	return manager.tokenDuration
+}
+
 // HashPassword hashes the given password using bcrypt.
-func HashPassword(password string) (string, error) {
+func HashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracing.Start(ctx, "bcrypt hash")
+	defer span.End()
+	start := time.Now()
+	defer func() { metrics.ObservePasswordHash("hash", time.Since(start).Seconds()) }()
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return "", fmt.Errorf("failed to hash password: %w", err)
@@ -98,13 +210,22 @@ func HashPassword(password string) (string, error) {
 }
 
 // CheckPasswordHash compares a plain text password with a bcrypt hash.
-func CheckPasswordHash(password, hash string) bool {
+func CheckPasswordHash(ctx context.Context, password, hash string) bool {
+	_, span := tracing.Start(ctx, "bcrypt compare")
+	defer span.End()
+	start := time.Now()
+	defer func() { metrics.ObservePasswordHash("compare", time.Since(start).Seconds()) }()
+
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
 
-// GenerateOTP generates a 6-digit numeric OTP.
-func GenerateOTP() string {
-	rand.Seed(time.Now().UnixNano())
-	return fmt.Sprintf("%06d", rand.Intn(1000000))
+// GenerateOTP generates a 6-digit numeric OTP. The code can be the only
+// sign-in factor, so it is drawn from a cryptographically secure source.
+func GenerateOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate OTP: %w", err)
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
 }
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/metrics"
+)
+
+const deviceRevokeTokenType = "device_revoke"
+
+// DeviceRevokeClaims represents the claims of the link sent in new sign-in
+// notifications, which lets the owner sign out every session of the account.
+// The nonce makes the link single-use, like a passwordless login link.
+type DeviceRevokeClaims struct {
+	jwt.StandardClaims
+	Type      string `json:"typ"`
+	UserID    string `json:"uid"`
+	SessionID string `json:"sid"`
+	DeviceID  string `json:"did"`
+	Nonce     string `json:"nonce"`
+}
+
+// GenerateDeviceRevokeToken signs a token for the alert about the given session and device, valid until expiresAt.
+func (manager *JWTManager) GenerateDeviceRevokeToken(userID string, sessionID string, deviceID string, nonce string, expiresAt time.Time) (string, error) {
+	claims := DeviceRevokeClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expiresAt.Unix(),
+			IssuedAt:  time.Now().Unix(),
+		},
+		Type:      deviceRevokeTokenType,
+		UserID:    userID,
+		SessionID: sessionID,
+		DeviceID:  deviceID,
+		Nonce:     nonce,
+	}
+
+	return manager.sign(deviceRevokeTokenType, claims)
+}
+
+// VerifyDeviceRevokeToken verifies a device revoke token and returns its claims.
+func (manager *JWTManager) VerifyDeviceRevokeToken(revokeToken string) (claims *DeviceRevokeClaims, err error) {
+	defer func() { metrics.TokenVerified(deviceRevokeTokenType, err) }()
+
+	token, err := jwt.ParseWithClaims(
+		revokeToken,
+		&DeviceRevokeClaims{},
+		func(token *jwt.Token) (interface{}, error) {
+			_, ok := token.Method.(*jwt.SigningMethodHMAC)
+			if !ok {
+				return nil, fmt.Errorf("unexpected token signing method")
+			}
+			return []byte(manager.secretKey), nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid revoke token: %w", err)
+	}
+
+	claims, ok := token.Claims.(*DeviceRevokeClaims)
+	if !ok || claims.Type != deviceRevokeTokenType || claims.UserID == "" || claims.SessionID == "" || claims.Nonce == "" {
+		return nil, fmt.Errorf("invalid revoke token claims")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/metrics"
+)
+
+const emailLoginTokenType = "email_login"
+
+// EmailLoginClaims represents the claims of a passwordless login link. The
+// nonce makes the link single-use: only its hash is stored, and it is
+// consumed on the first sign-in.
+type EmailLoginClaims struct {
+	jwt.StandardClaims
+	Type   string `json:"typ"`
+	UserID string `json:"uid"`
+	Nonce  string `json:"nonce"`
+}
+
+// GenerateEmailLoginToken signs a login link token for the user valid until expiresAt.
+func (manager *JWTManager) GenerateEmailLoginToken(userID string, nonce string, expiresAt time.Time) (string, error) {
+	claims := EmailLoginClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expiresAt.Unix(),
+			IssuedAt:  time.Now().Unix(),
+		},
+		Type:   emailLoginTokenType,
+		UserID: userID,
+		Nonce:  nonce,
+	}
+
+	return manager.sign(emailLoginTokenType, claims)
+}
+
+// VerifyEmailLoginToken verifies a login link token and returns its claims.
+func (manager *JWTManager) VerifyEmailLoginToken(loginToken string) (claims *EmailLoginClaims, err error) {
+	defer func() { metrics.TokenVerified(emailLoginTokenType, err) }()
+
+	token, err := jwt.ParseWithClaims(
+		loginToken,
+		&EmailLoginClaims{},
+		func(token *jwt.Token) (interface{}, error) {
+			_, ok := token.Method.(*jwt.SigningMethodHMAC)
+			if !ok {
+				return nil, fmt.Errorf("unexpected token signing method")
+			}
+			return []byte(manager.secretKey), nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid login token: %w", err)
+	}
+
+	claims, ok := token.Claims.(*EmailLoginClaims)
+	if !ok || claims.Type != emailLoginTokenType || claims.UserID == "" || claims.Nonce == "" {
+		return nil, fmt.Errorf("invalid login token claims")
+	}
+
+	return claims, nil
+}
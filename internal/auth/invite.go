@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/metrics"
+)
+
+const inviteTokenType = "invite"
+
+// InviteClaims represents the claims embedded in an invite link token.
+type InviteClaims struct {
+	jwt.StandardClaims
+	Type   string `json:"typ"`
+	Invite string `json:"inv"`
+	Nonce  string `json:"nonce"`
+}
+
+// GenerateInviteToken signs a token that identifies the given invite until expiresAt.
+// The nonce must match the hash stored with the invite for the token to be accepted.
+func (manager *JWTManager) GenerateInviteToken(inviteID string, nonce string, expiresAt time.Time) (string, error) {
+	claims := InviteClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expiresAt.Unix(),
+			IssuedAt:  time.Now().Unix(),
+		},
+		Type:   inviteTokenType,
+		Invite: inviteID,
+		Nonce:  nonce,
+	}
+
+	return manager.sign(inviteTokenType, claims)
+}
+
+// VerifyInviteToken verifies the signature and expiry of an invite token and returns its claims.
+func (manager *JWTManager) VerifyInviteToken(inviteToken string) (claims *InviteClaims, err error) {
+	defer func() { metrics.TokenVerified(inviteTokenType, err) }()
+
+	token, err := jwt.ParseWithClaims(
+		inviteToken,
+		&InviteClaims{},
+		func(token *jwt.Token) (interface{}, error) {
+			_, ok := token.Method.(*jwt.SigningMethodHMAC)
+			if !ok {
+				return nil, fmt.Errorf("unexpected token signing method")
+			}
+			return []byte(manager.secretKey), nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid invite token: %w", err)
+	}
+
+	claims, ok := token.Claims.(*InviteClaims)
+	if !ok || claims.Type != inviteTokenType || claims.Invite == "" {
+		return nil, fmt.Errorf("invalid invite token claims")
+	}
+
+	return claims, nil
+}
@@ -1,22 +1,29 @@
 package auth
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/audit"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/logging"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/problem"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/redis"
 )
 
-// AuthMiddleware is a Gin middleware function that checks for a valid JWT token.
-func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+// AuthMiddleware is a Gin middleware function that checks for a valid JWT token
+// whose session has not been revoked. Requests made with impersonation tokens are
+// recorded in the audit log.
+func AuthMiddleware(cfg *config.Config, redisClient *redis.Client, auditRepo *audit.AuditRepo) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get the Authorization header
 		authHeader := c.GetHeader("Authorization")
 
 		// Check if the header is present and in the correct format
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			problem.Abort(c, problem.Unauthenticated.New("Authorization header required"))
 			return
 		}
 
@@ -29,31 +36,98 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 		// Verify the token
 		claims, err := jwtManager.Verify(tokenString)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			problem.Abort(c, problem.InvalidToken.New("Invalid token"))
+			return
+		}
+
+		// Check that the session has not been revoked
+		revoked, err := IsRevoked(c.Request.Context(), redisClient, claims)
+		if err != nil {
+			problem.Abort(c, problem.Internal.Wrap(err, "Failed to verify session"))
+			return
+		}
+		if revoked {
+			problem.Abort(c, problem.SessionRevoked.New("Session has been revoked"))
 			return
 		}
 
 		// Set the user ID and role in the Gin context
 		c.Set("userID", claims.GetUserID())
 		c.Set("userRole", claims.GetUserRole())
+		c.Set("authTime", claims.GetAuthTime())
+		logging.SetUserID(c.Request.Context(), claims.GetUserID())
+
+		if actorID := claims.GetActorID(); actorID != "" {
+			impersonate(c, cfg, auditRepo, claims)
+			return
+		}
 
 		// Proceed to the next handler
 		c.Next()
 	}
 }
 
+// IsRevoked reports whether the session of the token has been revoked, or all
+// sessions of its user have been since the token was issued.
+func IsRevoked(ctx context.Context, redisClient *redis.Client, claims *UserClaims) (bool, error) {
+	if sessionID := claims.GetSessionID(); sessionID != "" {
+		revoked, err := redisClient.IsSessionRevoked(ctx, sessionID)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+
+	revokedAt, err := redisClient.UserSessionsRevokedAt(ctx, claims.GetUserID())
+	if err != nil {
+		return false, err
+	}
+	return revokedAt > 0 && claims.GetIat() <= revokedAt, nil
+}
+
+// impersonate handles a request made with an impersonation token. Writes are
+// blocked unless enabled in the config, and every request is audit logged.
+func impersonate(c *gin.Context, cfg *config.Config, auditRepo *audit.AuditRepo, claims *UserClaims) {
+	c.Set("actorID", claims.GetActorID())
+
+	event := audit.FromContext(c, audit.ActionImpersonationRequest)
+	event.TargetID = claims.GetUserID()
+	details := map[string]interface{}{
+		"method": c.Request.Method,
+		"path":   c.Request.URL.Path,
+	}
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		if !cfg.ImpersonationAllowWrites {
+			details["status"] = http.StatusForbidden
+			details["blocked"] = true
+			event.Diff = audit.Details(details)
+			auditRepo.Record(c.Request.Context(), event)
+			problem.Abort(c, problem.ImpersonationReadOnly.New("Write requests are not allowed while impersonating"))
+			return
+		}
+	}
+
+	c.Next()
+
+	details["status"] = c.Writer.Status()
+	event.Diff = audit.Details(details)
+	auditRepo.Record(c.Request.Context(), event)
+}
+
 // AuthorizationMiddleware checks if the authenticated user is authorized to access the resource.
 func AuthorizationMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user ID and role from the context
 		userID, ok := c.Get("userID")
 		if !ok {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
+			problem.Abort(c, problem.Internal.New("User ID not found in context"))
 			return
 		}
 		userRole, ok := c.Get("userRole")
 		if !ok {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "User role not found in context"})
+			problem.Abort(c, problem.Internal.New("User role not found in context"))
 			return
 		}
 
@@ -68,6 +142,26 @@ func AuthorizationMiddleware() gin.HandlerFunc {
 		}
 
 		// User is not authorized
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Unauthorized access"})
+		problem.Abort(c, problem.Forbidden.New("Unauthorized access"))
+	}
+}
+
+// RoleMiddleware allows the request only if the authenticated user has one of the given roles.
+func RoleMiddleware(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userRole, ok := c.Get("userRole")
+		if !ok {
+			problem.Abort(c, problem.Internal.New("User role not found in context"))
+			return
+		}
+
+		for _, role := range roles {
+			if userRole == role {
+				c.Next()
+				return
+			}
+		}
+
+		problem.Abort(c, problem.Forbidden.New("Unauthorized access"))
 	}
 }
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/problem"
+)
+
+// Permissions granted to roles.
+const (
+	PermImpersonate = "users:impersonate"
+	PermAuditRead   = "audit:read"
+	PermUserSearch  = "users:search"
+)
+
+// rolePermissions maps each role to the permissions it grants.
+var rolePermissions = map[string][]string{
+	models.RoleAdmin:   {PermImpersonate, PermAuditRead, PermUserSearch},
+	models.RoleSupport: {PermImpersonate, PermUserSearch},
+}
+
+// HasPermission reports whether the given role grants the permission.
+func HasPermission(role string, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionMiddleware allows the request only if the authenticated user's role grants the permission.
+func PermissionMiddleware(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(c.GetString("userRole"), permission) {
+			problem.Abort(c, problem.Forbidden.New("Unauthorized access"))
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// GenerateRefreshToken returns a new refresh token for the session and the
+// hash to store for it. The token names its session so that it can be looked
+// up without storing the token itself.
+func GenerateRefreshToken(sessionID string) (token string, tokenHash string, err error) {
+	secret, err := GenerateNonce()
+	if err != nil {
+		return "", "", err
+	}
+	return sessionID + "." + secret, HashToken(secret), nil
+}
+
+// ParseRefreshToken splits a refresh token into its session ID and the hash of
+// its secret. ok is false if the token is malformed.
+func ParseRefreshToken(token string) (sessionID string, tokenHash string, ok bool) {
+	sessionID, secret, found := strings.Cut(token, ".")
+	if !found || secret == "" {
+		return "", "", false
+	}
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return "", "", false
+	}
+	return sessionID, HashToken(secret), true
+}
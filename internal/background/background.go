@@ -0,0 +1,44 @@
+// Package background tracks work that outlives the request that started it,
+// such as sending emails or building data exports, so that shutdown can wait
+// for it to finish.
+package background
+
+import (
+	"context"
+	"sync"
+)
+
+// Group tracks running background tasks.
+type Group struct {
+	wg sync.WaitGroup
+}
+
+// NewGroup creates a new Group.
+func NewGroup() *Group {
+	return &Group{}
+}
+
+// Go runs fn in a new goroutine tracked by the group.
+func (g *Group) Go(fn func()) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		fn()
+	}()
+}
+
+// Wait blocks until every task has finished or ctx is done, whichever comes first.
+func (g *Group) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,186 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/audit"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/device"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/identity"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/invite"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/rolerequest"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/user"
+)
+
+// buildTimeout bounds how long building a single export may take.
+const buildTimeout = 5 * time.Minute
+
+// loginActions are the audit actions that make up a user's login history.
+var loginActions = map[string]bool{
+	audit.ActionLogin:       true,
+	audit.ActionLoginFailed: true,
+	audit.ActionNewDevice:   true,
+}
+
+// Builder collects the personal data held about a user into an export archive.
+type Builder struct {
+	exportRepo      *ExportRepo
+	userRepo        *user.UserRepo
+	deviceRepo      *device.DeviceRepo
+	auditRepo       *audit.AuditRepo
+	roleRequestRepo *rolerequest.RoleRequestRepo
+	inviteRepo      *invite.InviteRepo
+	identityRepo    *identity.IdentityRepo
+}
+
+// NewBuilder creates a new Builder.
+func NewBuilder(db *pgxpool.Pool) *Builder {
+	return &Builder{
+		exportRepo:      NewExportRepo(db),
+		userRepo:        user.NewUserRepo(db),
+		deviceRepo:      device.NewDeviceRepo(db),
+		auditRepo:       audit.NewAuditRepo(db),
+		roleRequestRepo: rolerequest.NewRoleRequestRepo(db),
+		inviteRepo:      invite.NewInviteRepo(db),
+		identityRepo:    identity.NewIdentityRepo(db),
+	}
+}
+
+// Run builds the archive of a pending export and stores it, or marks the export
+// failed. It is meant to run in the background after the export is created, so
+// ctx should not be canceled when the request that created it ends.
+func (b *Builder) Run(ctx context.Context, e *models.DataExport) {
+	ctx, cancel := context.WithTimeout(ctx, buildTimeout)
+	defer cancel()
+
+	archive, err := b.build(ctx, e)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to build data export", "export_id", e.ID, "error", err)
+		if err := b.exportRepo.FailExport(ctx, e.ID, "failed to collect user data"); err != nil {
+			slog.ErrorContext(ctx, "failed to mark data export failed", "export_id", e.ID, "error", err)
+		}
+		return
+	}
+
+	if err := b.exportRepo.CompleteExport(ctx, e.ID, archive); err != nil {
+		slog.ErrorContext(ctx, "failed to store data export", "export_id", e.ID, "error", err)
+	}
+}
+
+func (b *Builder) build(ctx context.Context, e *models.DataExport) ([]byte, error) {
+	userID, err := uuid.Parse(e.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	data, err := b.Collect(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Format == FormatJSON {
+		return json.MarshalIndent(data, "", "  ")
+	}
+	return zipExport(data)
+}
+
+// Collect gathers everything stored about the user.
+func (b *Builder) Collect(ctx context.Context, userID uuid.UUID) (*models.UserDataExport, error) {
+	profile, err := b.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &models.UserDataExport{
+		ExportedAt:   time.Now().UTC(),
+		Profile:      profile,
+		LoginHistory: []*models.AuditEvent{},
+		AuditEvents:  []*models.AuditEvent{},
+		RoleRequests: []*models.RoleRequest{},
+	}
+
+	if data.Sessions, err = b.deviceRepo.GetUserDevices(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	// Events the user performed and events performed on them, each once.
+	seen := map[int64]bool{}
+	collect := func(event *models.AuditEvent) error {
+		if seen[event.ID] {
+			return nil
+		}
+		seen[event.ID] = true
+		if loginActions[event.Action] && event.TargetID == profile.ID {
+			data.LoginHistory = append(data.LoginHistory, event)
+			return nil
+		}
+		data.AuditEvents = append(data.AuditEvents, event)
+		return nil
+	}
+	for _, filter := range []models.GetAllAuditEvents{{TargetID: profile.ID}, {ActorID: profile.ID}} {
+		if err := b.auditRepo.ExportAuditEvents(ctx, filter, collect); err != nil {
+			return nil, err
+		}
+	}
+
+	requests, err := b.roleRequestRepo.GetAllRoleRequests(ctx, models.GetAllRoleRequests{UserID: profile.ID})
+	if err != nil {
+		return nil, err
+	}
+	if requests != nil {
+		data.RoleRequests = requests
+	}
+
+	if data.Invites, err = b.inviteRepo.GetUserInvites(ctx, profile.ID, profile.Email); err != nil {
+		return nil, err
+	}
+
+	if data.Identities, err = b.identityRepo.GetUserIdentities(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// zipExport writes each section of the export to its own JSON file in a ZIP archive.
+func zipExport(data *models.UserDataExport) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", data.Profile},
+		{"sessions.json", data.Sessions},
+		{"login_history.json", data.LoginHistory},
+		{"audit_events.json", data.AuditEvents},
+		{"role_requests.json", data.RoleRequests},
+		{"invites.json", data.Invites},
+		{"identities.json", data.Identities},
+	}
+	for _, f := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: data.ExportedAt})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s to archive: %w", f.name, err)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.content); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", f.name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
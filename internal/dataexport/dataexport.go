@@ -0,0 +1,166 @@
+package dataexport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+)
+
+// Export formats.
+const (
+	FormatJSON = "json"
+	FormatZIP  = "zip"
+)
+
+var (
+	// ErrExportNotFound is returned when an export does not exist or has expired.
+	ErrExportNotFound = errors.New("data export not found")
+	// ErrExportNotReady is returned when downloading an export that is still being built or failed.
+	ErrExportNotReady = errors.New("data export is not ready")
+)
+
+// ExportRepo is the repository for personal data exports.
+type ExportRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewExportRepo creates a new ExportRepo.
+func NewExportRepo(db *pgxpool.Pool) *ExportRepo {
+	return &ExportRepo{
+		db: db,
+	}
+}
+
+const exportColumns = `id, user_id, requested_by, format, status, error, created_at, completed_at, expires_at`
+
+// scanExport scans a row selected with exportColumns, followed by any extra destinations.
+func scanExport(row pgx.Row, extra ...interface{}) (*models.DataExport, error) {
+	var e models.DataExport
+	dest := []interface{}{
+		&e.ID,
+		&e.UserID,
+		&e.RequestedBy,
+		&e.Format,
+		&e.Status,
+		&e.Error,
+		&e.CreatedAt,
+		&e.CompletedAt,
+		&e.ExpiresAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// CreateExport creates a pending export.
+func (r *ExportRepo) CreateExport(ctx context.Context, e *models.DataExport) error {
+	e.ID = uuid.New().String()
+	query := `
+		INSERT INTO data_exports (id, user_id, requested_by, format, expires_at, created_at)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, $4, $5, NOW())
+		RETURNING status, created_at
+	`
+
+	var requestedBy string
+	if e.RequestedBy != nil {
+		requestedBy = *e.RequestedBy
+	}
+	err := r.db.QueryRow(ctx, query, e.ID, e.UserID, requestedBy, e.Format, e.ExpiresAt).Scan(&e.Status, &e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create data export: %w", err)
+	}
+
+	return nil
+}
+
+// GetLatestExport retrieves the newest unexpired export of the user in the given
+// format that has not failed.
+func (r *ExportRepo) GetLatestExport(ctx context.Context, userID uuid.UUID, format string) (*models.DataExport, error) {
+	query := `
+		SELECT ` + exportColumns + `
+		FROM data_exports
+		WHERE user_id = $1 AND format = $2 AND status <> 'failed' AND expires_at > NOW()
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	e, err := scanExport(r.db.QueryRow(ctx, query, userID, format))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrExportNotFound
+		}
+		return nil, fmt.Errorf("failed to get data export: %w", err)
+	}
+
+	return e, nil
+}
+
+// GetExportArchive retrieves the archive of a ready export of the user.
+func (r *ExportRepo) GetExportArchive(ctx context.Context, userID uuid.UUID, exportID uuid.UUID) (*models.DataExport, []byte, error) {
+	query := `
+		SELECT ` + exportColumns + `, archive
+		FROM data_exports
+		WHERE id = $1 AND user_id = $2 AND expires_at > NOW()
+	`
+
+	var archive []byte
+	e, err := scanExport(r.db.QueryRow(ctx, query, exportID, userID), &archive)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, ErrExportNotFound
+		}
+		return nil, nil, fmt.Errorf("failed to get data export: %w", err)
+	}
+	if e.Status != "ready" {
+		return e, nil, ErrExportNotReady
+	}
+
+	return e, archive, nil
+}
+
+// CompleteExport stores the built archive and marks the export ready.
+func (r *ExportRepo) CompleteExport(ctx context.Context, exportID string, archive []byte) error {
+	query := `
+		UPDATE data_exports
+		SET status = 'ready', archive = $1, completed_at = NOW()
+		WHERE id = $2
+	`
+	if _, err := r.db.Exec(ctx, query, archive, exportID); err != nil {
+		return fmt.Errorf("failed to complete data export: %w", err)
+	}
+	return nil
+}
+
+// FailExport marks the export failed with the given reason.
+func (r *ExportRepo) FailExport(ctx context.Context, exportID string, reason string) error {
+	query := `
+		UPDATE data_exports
+		SET status = 'failed', error = $1, completed_at = NOW()
+		WHERE id = $2
+	`
+	if _, err := r.db.Exec(ctx, query, reason, exportID); err != nil {
+		return fmt.Errorf("failed to mark data export failed: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredExports removes exports past their expiry and returns how many were removed.
+func (r *ExportRepo) DeleteExpiredExports(ctx context.Context) (int64, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM data_exports WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired data exports: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ExpiresAt returns the expiry of an export requested now, given the configured lifetime in hours.
+func ExpiresAt(hours int) time.Time {
+	return time.Now().Add(time.Duration(hours) * time.Hour)
+}
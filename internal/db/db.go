@@ -2,33 +2,84 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
+	"net/url"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/tracing"
 )
 
+// connectTimeout bounds how long Connect waits for the database to answer.
+const connectTimeout = 5 * time.Second
+
 // Connect establishes a connection to the PostgreSQL database.
 func Connect(cfg *config.Config) (*pgxpool.Pool, error) {
-	connString := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		cfg.PostgresUser,
-		cfg.PostgresPassword,
-		cfg.PostgresHost,
-		cfg.PostgresPort,
-		cfg.PostgresDatabase,
-	)
-
-	pool, err := pgxpool.New(context.Background(), connString)
+	poolConfig, err := pgxpool.ParseConfig(connString(cfg, "postgres"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid database configuration: %w", err)
+	}
+	// Record a span for every query
+	poolConfig.ConnConfig.Tracer = tracing.PGXTracer{}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
 
-	// // Test the connection
-	// if err := pool.Ping(context.Background()); err != nil {
-	// 	return nil, fmt.Errorf("database ping failed: %w", err)
-	// }
+	// Test the connection
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("database ping failed: %w", err)
+	}
 
-	log.Println("Connected to PostgreSQL database")
+	slog.Info("connected to PostgreSQL", "host", cfg.PostgresHost, "database", cfg.PostgresDatabase)
 	return pool, nil
 }
+
+// connString returns the URL of the configured database with the given scheme.
+func connString(cfg *config.Config, scheme string) string {
+	u := url.URL{
+		Scheme:   scheme,
+		User:     url.UserPassword(cfg.PostgresUser, cfg.PostgresPassword),
+		Host:     net.JoinHostPort(cfg.PostgresHost, cfg.PostgresPort),
+		Path:     "/" + cfg.PostgresDatabase,
+		RawQuery: "sslmode=disable",
+	}
+	return u.String()
+}
+
+// CheckSchemaVersion verifies that every embedded migration has been applied
+// and that the last one did not fail halfway. A newer schema is accepted so
+// that instances of the previous release keep serving while a rollout
+// migrates the database.
+func CheckSchemaVersion(ctx context.Context, pool *pgxpool.Pool) error {
+	var version int64
+	var dirty bool
+	err := pool.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.New("no migrations applied")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	if dirty {
+		return fmt.Errorf("migration %d is dirty", version)
+	}
+	latest, err := LatestVersion()
+	if err != nil {
+		return err
+	}
+	if uint(version) < latest {
+		return fmt.Errorf("schema version %d is older than %d", version, latest)
+	}
+	return nil
+}
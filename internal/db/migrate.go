@@ -0,0 +1,228 @@
+package db
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5" // Registers the pgx5 scheme
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+)
+
+// migrationFiles holds the SQL migrations, so that the binary can migrate the
+// database without the source tree.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const migrationsDir = "migrations"
+
+// Migration is a pair of embedded up and down migration files.
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string // File name of the up migration
+	Down    string // File name of the down migration, empty if there is none
+}
+
+// Migrations lists the embedded migrations in version order.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := map[uint]*Migration{}
+	for _, entry := range entries {
+		file := entry.Name()
+		prefix, rest, ok := strings.Cut(file, "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid migration file name %q", file)
+		}
+
+		m := byVersion[uint(version)]
+		if m == nil {
+			m = &Migration{Version: uint(version)}
+			byVersion[uint(version)] = m
+		}
+		switch {
+		case strings.HasSuffix(rest, ".up.sql"):
+			m.Name, m.Up = strings.TrimSuffix(rest, ".up.sql"), file
+		case strings.HasSuffix(rest, ".down.sql"):
+			m.Down = file
+		default:
+			return nil, fmt.Errorf("invalid migration file name %q", file)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// LatestVersion returns the version of the newest embedded migration.
+func LatestVersion() (uint, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, errors.New("no migrations embedded")
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// CheckMigrationFiles verifies that every migration has an up and a down
+// file and that neither is empty.
+func CheckMigrationFiles() error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, m := range migrations {
+		for _, file := range []struct{ kind, name string }{{"up", m.Up}, {"down", m.Down}} {
+			if file.name == "" {
+				errs = append(errs, fmt.Errorf("migration %d has no %s file", m.Version, file.kind))
+				continue
+			}
+			content, err := fs.ReadFile(migrationFiles, path.Join(migrationsDir, file.name))
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", file.name, err)
+			}
+			if strings.TrimSpace(string(content)) == "" {
+				errs = append(errs, fmt.Errorf("%s is empty", file.name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Migrator applies the embedded migrations to the configured database. While
+// it migrates it holds a Postgres advisory lock, so replicas that start at the
+// same time apply each migration once.
+type Migrator struct {
+	m *migrate.Migrate
+}
+
+// NewMigrator creates a new Migrator. Close it when done.
+func NewMigrator(cfg *config.Config) (*Migrator, error) {
+	source, err := iofs.New(migrationFiles, migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	m, err := migrate.NewWithSourceInstance("iofs", source, connString(cfg, "pgx5"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database for migrations: %w", err)
+	}
+	m.Log = migrateLogger{}
+	return &Migrator{m: m}, nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up() error {
+	if err := m.m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Down reverts the given number of applied migrations.
+func (m *Migrator) Down(steps int) error {
+	if steps <= 0 {
+		return errors.New("steps must be positive")
+	}
+	if err := m.m.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Force sets the schema version without running migrations and clears the
+// dirty flag, after a failed migration was repaired by hand. Version -1 marks
+// the database as having no migrations applied.
+func (m *Migrator) Force(version int) error {
+	return m.m.Force(version)
+}
+
+// Version returns the applied schema version, 0 if none is, and whether the
+// last migration failed halfway.
+func (m *Migrator) Version() (uint, bool, error) {
+	version, dirty, err := m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// Verify checks that each migration can be reverted and applied again: every
+// migration is applied, reverted and reapplied in turn, and finally all are
+// reverted. It is destructive, so it refuses to run unless no migration has
+// been applied, and is meant for a scratch database.
+func (m *Migrator) Verify() error {
+	if err := CheckMigrationFiles(); err != nil {
+		return err
+	}
+	if version, _, err := m.Version(); err != nil {
+		return err
+	} else if version != 0 {
+		return fmt.Errorf("database is at version %d; verify needs an empty database", version)
+	}
+
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	for _, migration := range migrations {
+		for _, step := range []int{1, -1, 1} {
+			if err := m.m.Steps(step); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Name, err)
+			}
+		}
+	}
+	if err := m.m.Down(); err != nil {
+		return fmt.Errorf("failed to revert all migrations: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connection of the migrator.
+func (m *Migrator) Close() error {
+	sourceErr, dbErr := m.m.Close()
+	return errors.Join(sourceErr, dbErr)
+}
+
+// migrateLogger routes the progress of migrations to the default logger.
+type migrateLogger struct{}
+
+func (migrateLogger) Printf(format string, v ...interface{}) {
+	slog.Info(strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+
+func (migrateLogger) Verbose() bool {
+	return false
+}
+
+// Migrate applies every pending migration, as the server does on start when
+// MIGRATE_ON_START is set.
+func Migrate(cfg *config.Config) error {
+	m, err := NewMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	return m.Up()
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"os"
+	"testing"
+
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+)
+
+// testMigrateDatabaseEnv names a scratch database to migrate up and down. It
+// must have no migrations applied, and is left that way.
+const testMigrateDatabaseEnv = "TEST_MIGRATE_DATABASE"
+
+func TestMigrationFiles(t *testing.T) {
+	if err := CheckMigrationFiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.Version != uint(i+1) {
+			t.Fatalf("migration %d (%s) follows version %d", m.Version, m.Name, i)
+		}
+	}
+
+	latest, err := LatestVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != uint(len(migrations)) {
+		t.Errorf("latest version = %d, want %d", latest, len(migrations))
+	}
+}
+
+func TestMigrationsUpDownUp(t *testing.T) {
+	name := os.Getenv(testMigrateDatabaseEnv)
+	if name == "" {
+		t.Skipf("%s is not set", testMigrateDatabaseEnv)
+	}
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.PostgresDatabase = name
+
+	m, err := NewMigrator(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := migrations[len(migrations)-1].Version
+
+	assertVersion := func(step string, want uint) {
+		t.Helper()
+		version, dirty, err := m.Version()
+		if err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		if version != want || dirty {
+			t.Fatalf("%s: version = %d (dirty %v), want %d", step, version, dirty, want)
+		}
+	}
+	assertVersion("before migrating", 0)
+
+	if err := m.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	assertVersion("up", latest)
+	if err := m.Down(len(migrations)); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	assertVersion("down", 0)
+
+	// Each migration must revert cleanly right after being applied, and apply
+	// again after being reverted.
+	for _, migration := range migrations {
+		for _, step := range []int{1, -1, 1} {
+			if err := m.m.Steps(step); err != nil {
+				t.Fatalf("migration %d (%s), step %d: %v", migration.Version, migration.Name, step, err)
+			}
+		}
+		assertVersion(migration.Name, migration.Version)
+	}
+
+	if err := m.Down(len(migrations)); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	assertVersion("down", 0)
+}
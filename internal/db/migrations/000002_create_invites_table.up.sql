@@ -0,0 +1,20 @@
+ALTER TABLE users ADD COLUMN org_id UUID;
+
+CREATE TABLE invites (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    email VARCHAR(100) NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    org_id UUID,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- accepted, revoked
+    invited_by UUID NOT NULL REFERENCES users(id),
+    accepted_user_id UUID REFERENCES users(id),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_invites_email ON invites (email);
+CREATE INDEX idx_invites_org_id ON invites (org_id);
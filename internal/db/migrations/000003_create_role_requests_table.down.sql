@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS role_requests;
+
+ALTER TABLE users DROP COLUMN IF EXISTS role_self_assigned;
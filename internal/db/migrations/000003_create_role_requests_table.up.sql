@@ -0,0 +1,23 @@
+ALTER TABLE users ADD COLUMN role_self_assigned BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Registration used to accept any role from the client, so elevated roles that
+-- were not granted through an invite cannot be trusted and need an admin review.
+UPDATE users
+SET role_self_assigned = TRUE
+WHERE role NOT IN ('user', 'courier')
+  AND id NOT IN (SELECT accepted_user_id FROM invites WHERE accepted_user_id IS NOT NULL);
+
+CREATE TABLE role_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    requested_role VARCHAR(20) NOT NULL,
+    reason TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- approved, rejected
+    reviewed_by UUID REFERENCES users(id),
+    review_note TEXT,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_role_requests_pending_user ON role_requests (user_id) WHERE status = 'pending';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS known_devices;
+
+ALTER TABLE users DROP COLUMN IF EXISTS password_reset_required;
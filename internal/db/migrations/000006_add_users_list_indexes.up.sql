@@ -0,0 +1,4 @@
+-- Keyset pagination on GET /users orders by the sort column with id as tie-breaker.
+CREATE INDEX IF NOT EXISTS idx_users_created_at_id ON users (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_users_username_id ON users (username, id);
+CREATE INDEX IF NOT EXISTS idx_users_email_id ON users (email, id);
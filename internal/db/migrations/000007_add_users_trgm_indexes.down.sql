@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_users_email_trgm;
+DROP INDEX IF EXISTS idx_users_full_name_trgm;
+DROP INDEX IF EXISTS idx_users_username_trgm;
+
+-- The extension is left installed; other schemas may depend on it.
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_users_deleted_at;
+DROP INDEX IF EXISTS idx_users_email_active;
+DROP INDEX IF EXISTS idx_users_username_active;
+
+-- Deleted rows would violate the restored constraints, so they are removed first.
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE users ADD CONSTRAINT users_username_key UNIQUE (username);
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+ALTER TABLE users DROP COLUMN IF EXISTS purged_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
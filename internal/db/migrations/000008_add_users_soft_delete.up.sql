@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN purged_at TIMESTAMP WITH TIME ZONE;
+
+-- Deleted users no longer reserve their username and email, so the same person
+-- can sign up again. Restoring fails if the name was taken in the meantime.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_username_key;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+CREATE UNIQUE INDEX idx_users_username_active ON users (username) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX idx_users_email_active ON users (email) WHERE deleted_at IS NULL;
+
+CREATE INDEX idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL AND purged_at IS NULL;
@@ -0,0 +1,15 @@
+CREATE TABLE data_exports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    requested_by UUID,
+    format VARCHAR(10) NOT NULL DEFAULT 'zip', -- json, zip
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, ready, failed
+    archive BYTEA,
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_data_exports_user_id ON data_exports (user_id, created_at DESC);
+CREATE INDEX idx_data_exports_expires_at ON data_exports (expires_at);
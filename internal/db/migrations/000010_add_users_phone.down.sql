@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_users_phone_trgm;
+DROP INDEX IF EXISTS idx_users_phone;
+DROP INDEX IF EXISTS idx_users_phone_verified;
+
+-- Phone-only users cannot be kept without an email.
+DELETE FROM users WHERE email IS NULL;
+ALTER TABLE users ALTER COLUMN email SET NOT NULL;
+
+ALTER TABLE users DROP COLUMN IF EXISTS phone_verified_at;
+ALTER TABLE users DROP COLUMN IF EXISTS phone;
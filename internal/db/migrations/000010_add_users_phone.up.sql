@@ -0,0 +1,12 @@
+ALTER TABLE users ADD COLUMN phone VARCHAR(16); -- E.164
+ALTER TABLE users ADD COLUMN phone_verified_at TIMESTAMP WITH TIME ZONE;
+
+-- Users who sign up by phone have no email.
+ALTER TABLE users ALTER COLUMN email DROP NOT NULL;
+
+-- Only a verified number is reserved, so nobody can block a number by
+-- entering it without owning it.
+CREATE UNIQUE INDEX idx_users_phone_verified ON users (phone)
+    WHERE phone_verified_at IS NOT NULL AND deleted_at IS NULL;
+CREATE INDEX idx_users_phone ON users (phone) WHERE phone IS NOT NULL;
+CREATE INDEX idx_users_phone_trgm ON users USING GIN (phone gin_trgm_ops);
@@ -0,0 +1,2 @@
+-- Set by an admin after reviewing an identity document; cleared when the date of birth changes.
+ALTER TABLE users ADD COLUMN age_verified_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,2 @@
+-- Fails while longer request IDs are stored; they are hashed, so they are not truncated.
+ALTER TABLE audit_events ALTER COLUMN request_id TYPE VARCHAR(64);
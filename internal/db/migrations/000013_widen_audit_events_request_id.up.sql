@@ -0,0 +1,2 @@
+-- Request IDs accepted by the API are up to 128 characters long (logging.MaxRequestIDLength).
+ALTER TABLE audit_events ALTER COLUMN request_id TYPE VARCHAR(128);
@@ -0,0 +1,3 @@
+-- Sorting by email orders phone-only users, who have none, as an empty email.
+DROP INDEX IF EXISTS idx_users_email_id;
+CREATE INDEX IF NOT EXISTS idx_users_email_id ON users ((COALESCE(email, '')), id);
@@ -0,0 +1,181 @@
+package device
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+)
+
+// ErrDeviceNotFound is returned when deleting a device that does not exist.
+var ErrDeviceNotFound = errors.New("device not found")
+
+// DeviceRepo is the repository for the devices users have signed in from.
+type DeviceRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewDeviceRepo creates a new DeviceRepo.
+func NewDeviceRepo(db *pgxpool.Pool) *DeviceRepo {
+	return &DeviceRepo{
+		db: db,
+	}
+}
+
+// Fingerprint identifies a device by its user agent and network. Only the IP
+// prefix (/24 for IPv4, /48 for IPv6) is used so that address changes within
+// the same network do not count as a new device.
+func Fingerprint(userAgent string, ip string) (fingerprint string, ipPrefix string) {
+	ipPrefix = IPPrefix(ip)
+	sum := sha256.Sum256([]byte(userAgent + "\x00" + ipPrefix))
+	return hex.EncodeToString(sum[:]), ipPrefix
+}
+
+// IPPrefix returns the network prefix of ip, or ip unchanged if it cannot be parsed.
+func IPPrefix(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+const deviceColumns = `id, user_id, fingerprint, user_agent, ip_prefix, first_seen_at, last_seen_at, expires_at`
+
+func scanDevice(row pgx.Row) (*models.KnownDevice, error) {
+	var d models.KnownDevice
+	err := row.Scan(
+		&d.ID,
+		&d.UserID,
+		&d.Fingerprint,
+		&d.UserAgent,
+		&d.IPPrefix,
+		&d.FirstSeenAt,
+		&d.LastSeenAt,
+		&d.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// TouchDevice records a sign-in from the device and extends its expiry. It reports
+// whether the device was unknown (never seen, or expired) before this sign-in.
+func (r *DeviceRepo) TouchDevice(ctx context.Context, d *models.KnownDevice) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Forget expired devices so they count as new again.
+	query := `DELETE FROM known_devices WHERE user_id = $1 AND expires_at < NOW()`
+	if _, err := tx.Exec(ctx, query, d.UserID); err != nil {
+		return false, fmt.Errorf("failed to delete expired devices: %w", err)
+	}
+
+	query = `
+		INSERT INTO known_devices (id, user_id, fingerprint, user_agent, ip_prefix, first_seen_at, last_seen_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW(), $6)
+		ON CONFLICT (user_id, fingerprint) DO UPDATE
+		SET last_seen_at = NOW(), expires_at = EXCLUDED.expires_at
+		RETURNING ` + deviceColumns + `, (xmax = 0) AS inserted
+	`
+	var inserted bool
+	err = tx.QueryRow(ctx, query,
+		uuid.New().String(),
+		d.UserID,
+		d.Fingerprint,
+		d.UserAgent,
+		d.IPPrefix,
+		d.ExpiresAt,
+	).Scan(
+		&d.ID,
+		&d.UserID,
+		&d.Fingerprint,
+		&d.UserAgent,
+		&d.IPPrefix,
+		&d.FirstSeenAt,
+		&d.LastSeenAt,
+		&d.ExpiresAt,
+		&inserted,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to save device: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit device: %w", err)
+	}
+
+	return inserted, nil
+}
+
+// CountDevices returns how many unexpired devices the user has signed in from.
+func (r *DeviceRepo) CountDevices(ctx context.Context, userID string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM known_devices WHERE user_id = $1 AND expires_at >= NOW()`
+	if err := r.db.QueryRow(ctx, query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count devices: %w", err)
+	}
+	return count, nil
+}
+
+// GetUserDevices retrieves the unexpired devices of a user, most recently used first.
+func (r *DeviceRepo) GetUserDevices(ctx context.Context, userID uuid.UUID) ([]*models.KnownDevice, error) {
+	devices := []*models.KnownDevice{}
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM known_devices
+		WHERE user_id = $1 AND expires_at >= NOW()
+		ORDER BY last_seen_at DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device row: %w", err)
+		}
+		devices = append(devices, d)
+	}
+
+	return devices, nil
+}
+
+// DeleteDevice forgets a device of the user, so the next sign-in from it is treated as new.
+func (r *DeviceRepo) DeleteDevice(ctx context.Context, userID string, deviceID string) error {
+	query := `DELETE FROM known_devices WHERE id = $1 AND user_id = $2`
+
+	tag, err := r.db.Exec(ctx, query, deviceID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete device: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDeviceNotFound
+	}
+
+	return nil
+}
+
+// ExpiresAt returns the expiry of a device seen now, given the configured lifetime in days.
+func ExpiresAt(days int) time.Time {
+	return time.Now().Add(time.Duration(days) * 24 * time.Hour)
+}
@@ -1,33 +1,127 @@
 package email
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/smtp"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/metrics"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/tracing"
 )
 
 // SendOTP sends an OTP (One-Time Password) email to the specified recipient.
-func SendOTP(cfg *config.Config, recipient string, otp string) error {
-	// Construct the email message
+func SendOTP(ctx context.Context, cfg *config.Config, recipient string, otp string) error {
 	subject := "Your OTP Code"
 	body := fmt.Sprintf("Your OTP code is: %s", otp)
+
+	if err := send(ctx, cfg, "otp", recipient, subject, body); err != nil {
+		return fmt.Errorf("failed to send OTP email: %w", err)
+	}
+
+	return nil
+}
+
+// SendLoginLink sends a passwordless sign-in link.
+func SendLoginLink(ctx context.Context, cfg *config.Config, recipient string, link string, expiresIn time.Duration) error {
+	subject := "Your sign-in link"
+	body := fmt.Sprintf("Use this link to sign in. It works once and expires in %d minutes:\r\n%s\r\n\r\nIf you did not request it, you can ignore this email.", int(expiresIn.Minutes()), link)
+
+	if err := send(ctx, cfg, "login_link", recipient, subject, body); err != nil {
+		return fmt.Errorf("failed to send login link email: %w", err)
+	}
+
+	return nil
+}
+
+// SendInvite sends an account invitation email with the acceptance link to the specified recipient.
+func SendInvite(ctx context.Context, cfg *config.Config, recipient string, role string, link string) error {
+	subject := "You have been invited"
+	body := fmt.Sprintf("You have been invited to join as %s.\r\n\r\nSet your password and activate your account here:\r\n%s", role, link)
+
+	if err := send(ctx, cfg, "invite", recipient, subject, body); err != nil {
+		return fmt.Errorf("failed to send invite email: %w", err)
+	}
+
+	return nil
+}
+
+// SendNewDeviceAlert notifies the recipient of a sign-in from a device they have not used before.
+// The revoke link signs out every session of the account and requires a password reset.
+func SendNewDeviceAlert(ctx context.Context, cfg *config.Config, recipient string, userAgent string, ip string, at time.Time, revokeLink string) error {
+	subject := "New sign-in to your account"
+	body := fmt.Sprintf(
+		"New sign-in from %s (IP %s) at %s.\r\n\r\nIf this was you, you can ignore this email.\r\n"+
+			"If it wasn't, sign out of all your sessions and reset your password here:\r\n%s",
+		userAgent, ip, at.UTC().Format("2006-01-02 15:04 MST"), revokeLink,
+	)
+
+	if err := send(ctx, cfg, "new_device", recipient, subject, body); err != nil {
+		return fmt.Errorf("failed to send new device email: %w", err)
+	}
+
+	return nil
+}
+
+// send delivers a plain text email through the configured SMTP server. kind
+// labels the email in metrics.
+func send(ctx context.Context, cfg *config.Config, kind string, recipient string, subject string, body string) (err error) {
+	_, span := tracing.Start(ctx, "smtp send",
+		attribute.String("email.kind", kind),
+		attribute.String("server.address", cfg.EmailHost),
+	)
+	defer func() { tracing.End(span, err) }()
+	start := time.Now()
+	defer func() { metrics.EmailSent(kind, err, time.Since(start).Seconds()) }()
+
+	// Construct the email message
 	message := fmt.Sprintf("Subject: %s\r\n\r\n%s", subject, body)
 
 	// Set up authentication
 	auth := smtp.PlainAuth("", cfg.EmailSender, cfg.EmailPassword, cfg.EmailHost)
 
 	// Send the email
-	err := smtp.SendMail(
+	return smtp.SendMail(
 		fmt.Sprintf("%s:%d", cfg.EmailHost, cfg.EmailPort),
 		auth,
 		cfg.EmailFromAddress,
 		[]string{recipient},
 		[]byte(message),
 	)
+}
+
+// Ping connects to the configured SMTP server and waits for its greeting,
+// without sending anything.
+func Ping(ctx context.Context, cfg *config.Config) error {
+	addr := fmt.Sprintf("%s:%d", cfg.EmailHost, cfg.EmailPort)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
-		return fmt.Errorf("failed to send OTP email: %w", err)
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
 	}
 
-	return nil
+	client, err := smtp.NewClient(conn, cfg.EmailHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP server did not greet: %w", err)
+	}
+	return client.Quit()
+}
+
+// Mask hides all but the first character of the local part of an address, for
+// messages and logs.
+func Mask(address string) string {
+	local, domain, ok := strings.Cut(address, "@")
+	if !ok || local == "" {
+		return strings.Repeat("*", len(address))
+	}
+	return local[:1] + strings.Repeat("*", len(local)-1) + "@" + domain
 }
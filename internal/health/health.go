@@ -0,0 +1,110 @@
+// Package health reports whether the service is alive and ready to take traffic.
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Statuses reported by readiness checks.
+const (
+	StatusReady       = "ready"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+	StatusOK          = "ok"
+	StatusFailed      = "failed"
+)
+
+// Check is a dependency the service needs in order to serve requests.
+type Check struct {
+	Name    string
+	Timeout time.Duration // How long the check may take before it counts as failed
+	Run     func(ctx context.Context) error
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	Status     string `json:"status" example:"ok"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms" example:"3"`
+}
+
+// Report is the outcome of a readiness probe.
+type Report struct {
+	Status string            `json:"status" example:"ready"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Ready reports whether the service should take traffic.
+func (r *Report) Ready() bool {
+	return r.Status == StatusReady
+}
+
+// Checker tracks the readiness of the service.
+type Checker struct {
+	checks   []Check
+	draining atomic.Bool
+}
+
+// NewChecker creates a new Checker that runs the given checks on every readiness probe.
+func NewChecker(checks ...Check) *Checker {
+	return &Checker{checks: checks}
+}
+
+// StartDraining marks the service as shutting down. Readiness fails from then
+// on so that load balancers stop sending new requests.
+func (c *Checker) StartDraining() {
+	c.draining.Store(true)
+}
+
+// Draining reports whether the service is shutting down.
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Check runs every check concurrently, each bounded by its own timeout. The
+// service is ready only if it is not draining and every check passed.
+func (c *Checker) Check(ctx context.Context) *Report {
+	if c.Draining() {
+		return &Report{Status: StatusDraining}
+	}
+
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := &Report{Status: StatusReady, Checks: make(map[string]Result, len(c.checks))}
+	for i, check := range c.checks {
+		report.Checks[check.Name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	return report
+}
+
+func run(ctx context.Context, check Check) Result {
+	if check.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, check.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := check.Run(ctx)
+	result := Result{Status: StatusOK, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+	}
+	return result
+}
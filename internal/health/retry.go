@@ -0,0 +1,35 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// maxBackoff caps the wait between startup attempts.
+const maxBackoff = 30 * time.Second
+
+// Retry calls connect until it succeeds, giving up after retries failed retries.
+// The wait between attempts starts at backoff and doubles each time. It is
+// meant for connecting to dependencies at startup, which may come up after
+// the service does.
+func Retry(ctx context.Context, name string, retries int, backoff time.Duration, connect func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := connect()
+		if err == nil || attempt >= retries {
+			return err
+		}
+
+		slog.WarnContext(ctx, name+" unavailable, retrying", "backoff", backoff.String(), "attempt", attempt+1, "retries", retries, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+)
+
+// uniqueViolation is the Postgres error code for unique constraint violations.
+const uniqueViolation = "23505"
+
+var (
+	// ErrIdentityNotFound is returned when no identity matches.
+	ErrIdentityNotFound = errors.New("identity not found")
+	// ErrIdentityExists is returned when the provider account is already linked
+	// to a user, or the user already has an account of that provider linked.
+	ErrIdentityExists = errors.New("identity already linked")
+	// ErrUserConflict is returned when a user created for an identity clashes with an existing username or email.
+	ErrUserConflict = errors.New("user with this username or email already exists")
+)
+
+// IdentityRepo is the repository for the external sign-in identities linked to users.
+type IdentityRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewIdentityRepo creates a new IdentityRepo.
+func NewIdentityRepo(db *pgxpool.Pool) *IdentityRepo {
+	return &IdentityRepo{
+		db: db,
+	}
+}
+
+const identityColumns = `id, user_id, provider, subject, email, created_at, last_login_at`
+
+func scanIdentity(row pgx.Row) (*models.UserIdentity, error) {
+	var i models.UserIdentity
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Provider,
+		&i.Subject,
+		&i.Email,
+		&i.CreatedAt,
+		&i.LastLoginAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// GetIdentity retrieves the identity of a provider account.
+func (r *IdentityRepo) GetIdentity(ctx context.Context, provider string, subject string) (*models.UserIdentity, error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE provider = $1 AND subject = $2`
+
+	i, err := scanIdentity(r.db.QueryRow(ctx, query, provider, subject))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrIdentityNotFound
+		}
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	return i, nil
+}
+
+// GetUserIdentities retrieves the identities linked to a user.
+func (r *IdentityRepo) GetUserIdentities(ctx context.Context, userID uuid.UUID) ([]*models.UserIdentity, error) {
+	identities := []*models.UserIdentity{}
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE user_id = $1 ORDER BY created_at`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user identities: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i, err := scanIdentity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan identity row: %w", err)
+		}
+		identities = append(identities, i)
+	}
+
+	return identities, rows.Err()
+}
+
+// CreateIdentity links a provider account to an existing user.
+func (r *IdentityRepo) CreateIdentity(ctx context.Context, i *models.UserIdentity) error {
+	return insertIdentity(ctx, r.db, i)
+}
+
+// CreateUserWithIdentity creates a user for a provider account that signs in
+// for the first time, together with its identity. The user has no password
+// and the email is stored as verified when the provider vouches for it.
+func (r *IdentityRepo) CreateUserWithIdentity(ctx context.Context, user *models.User, i *models.UserIdentity, emailVerified bool) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	user.ID = uuid.New().String()
+	query := `
+		INSERT INTO users (id, username, email, email_verified_at, password_hash, full_name, role, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), CASE WHEN $4::boolean THEN NOW() END, '', $5, $6, NOW(), NOW())
+	`
+	_, err = tx.Exec(ctx, query,
+		user.ID,
+		user.Username,
+		user.Email,
+		emailVerified,
+		user.FullName,
+		user.Role,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrUserConflict
+		}
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	i.UserID = user.ID
+	if err := insertIdentity(ctx, tx, i); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit user creation: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteIdentity unlinks the user's identity of the given provider.
+func (r *IdentityRepo) DeleteIdentity(ctx context.Context, userID uuid.UUID, provider string) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM user_identities WHERE user_id = $1 AND provider = $2`, userID, provider)
+	if err != nil {
+		return fmt.Errorf("failed to delete identity: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrIdentityNotFound
+	}
+
+	return nil
+}
+
+// TouchIdentity records a sign-in with the identity and refreshes the email the provider reported.
+func (r *IdentityRepo) TouchIdentity(ctx context.Context, identityID string, email string) error {
+	query := `
+		UPDATE user_identities
+		SET last_login_at = NOW(), email = COALESCE(NULLIF($1, ''), email)
+		WHERE id = $2
+	`
+
+	if _, err := r.db.Exec(ctx, query, email, identityID); err != nil {
+		return fmt.Errorf("failed to update identity: %w", err)
+	}
+
+	return nil
+}
+
+// execer is implemented by both the pool and transactions.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+}
+
+func insertIdentity(ctx context.Context, db execer, i *models.UserIdentity) error {
+	i.ID = uuid.New().String()
+	query := `
+		INSERT INTO user_identities (id, user_id, provider, subject, email, created_at, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+	`
+
+	_, err := db.Exec(ctx, query, i.ID, i.UserID, i.Provider, i.Subject, i.Email)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrIdentityExists
+		}
+		return fmt.Errorf("failed to create identity: %w", err)
+	}
+
+	return nil
+}
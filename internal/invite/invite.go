@@ -0,0 +1,279 @@
+package invite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+)
+
+var (
+	// ErrInviteNotPending is returned when an invite was already accepted, revoked or has expired.
+	ErrInviteNotPending = errors.New("invite is no longer pending")
+	// ErrUserConflict is returned when the account of an accepted invite clashes with an existing username or email.
+	ErrUserConflict = errors.New("username or email is already in use")
+)
+
+// uniqueViolation is the PostgreSQL error code for unique constraint violations.
+const uniqueViolation = "23505"
+
+// InviteRepo is the repository for interacting with invite data.
+type InviteRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewInviteRepo creates a new InviteRepo.
+func NewInviteRepo(db *pgxpool.Pool) *InviteRepo {
+	return &InviteRepo{
+		db: db,
+	}
+}
+
+const inviteColumns = `
+	id, email, role, org_id, token_hash, status, invited_by, accepted_user_id,
+	expires_at, accepted_at, revoked_at, created_at, updated_at
+`
+
+func scanInvite(row pgx.Row) (*models.Invite, error) {
+	var invite models.Invite
+	err := row.Scan(
+		&invite.ID,
+		&invite.Email,
+		&invite.Role,
+		&invite.OrgID,
+		&invite.TokenHash,
+		&invite.Status,
+		&invite.InvitedBy,
+		&invite.AcceptedUserID,
+		&invite.ExpiresAt,
+		&invite.AcceptedAt,
+		&invite.RevokedAt,
+		&invite.CreatedAt,
+		&invite.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if invite.Status == "pending" && invite.ExpiresAt.Before(time.Now()) {
+		invite.Status = "expired"
+	}
+	return &invite, nil
+}
+
+// CreateInvite creates a new invite in the database.
+func (r *InviteRepo) CreateInvite(ctx context.Context, invite *models.Invite) error {
+	invite.ID = uuid.New().String()
+	query := `
+		INSERT INTO invites (id, email, role, org_id, token_hash, invited_by, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+	`
+
+	_, err := r.db.Exec(ctx, query,
+		invite.ID,
+		invite.Email,
+		invite.Role,
+		invite.OrgID,
+		invite.TokenHash,
+		invite.InvitedBy,
+		invite.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create invite: %w", err)
+	}
+
+	invite.Status = "pending"
+	return nil
+}
+
+// GetInviteByID retrieves an invite by its ID.
+func (r *InviteRepo) GetInviteByID(ctx context.Context, inviteID uuid.UUID) (*models.Invite, error) {
+	query := `SELECT ` + inviteColumns + ` FROM invites WHERE id = $1`
+
+	invite, err := scanInvite(r.db.QueryRow(ctx, query, inviteID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invite by ID: %w", err)
+	}
+
+	return invite, nil
+}
+
+// GetAllInvites retrieves invites matching the given filter.
+func (r *InviteRepo) GetAllInvites(ctx context.Context, req models.GetAllInvites) ([]*models.Invite, error) {
+	var (
+		invites []*models.Invite
+		filter  string
+		args    []interface{}
+	)
+	query := `SELECT ` + inviteColumns + ` FROM invites WHERE 1 = 1`
+
+	if req.Email != "" {
+		args = append(args, "%"+req.Email+"%")
+		filter += fmt.Sprintf(" AND email ILIKE $%d", len(args))
+	}
+	if req.OrgID != "" {
+		args = append(args, req.OrgID)
+		filter += fmt.Sprintf(" AND org_id = $%d", len(args))
+	}
+	switch req.Status {
+	case "":
+	case "expired":
+		filter += " AND status = 'pending' AND expires_at < NOW()"
+	case "pending":
+		filter += " AND status = 'pending' AND expires_at >= NOW()"
+	default:
+		args = append(args, req.Status)
+		filter += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	query += filter + " ORDER BY created_at DESC"
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all invites: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invite row: %w", err)
+		}
+		invites = append(invites, invite)
+	}
+
+	return invites, nil
+}
+
+// GetUserInvites retrieves the invites accepted by the user or sent to their email address.
+func (r *InviteRepo) GetUserInvites(ctx context.Context, userID string, email string) ([]*models.Invite, error) {
+	invites := []*models.Invite{}
+	query := `
+		SELECT ` + inviteColumns + `
+		FROM invites
+		WHERE accepted_user_id = $1 OR lower(email) = lower($2)
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userID, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user invites: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invite row: %w", err)
+		}
+		invites = append(invites, invite)
+	}
+
+	return invites, nil
+}
+
+// UpdateInviteToken replaces the token of a pending invite and extends its expiry.
+// Links issued for the previous token stop working.
+func (r *InviteRepo) UpdateInviteToken(ctx context.Context, inviteID string, tokenHash string, expiresAt time.Time) error {
+	query := `
+		UPDATE invites
+		SET token_hash = $1, expires_at = $2, updated_at = NOW()
+		WHERE id = $3 AND status = 'pending'
+	`
+
+	tag, err := r.db.Exec(ctx, query, tokenHash, expiresAt, inviteID)
+	if err != nil {
+		return fmt.Errorf("failed to update invite token: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInviteNotPending
+	}
+
+	return nil
+}
+
+// RevokeInvite marks a pending invite as revoked.
+func (r *InviteRepo) RevokeInvite(ctx context.Context, inviteID string) error {
+	query := `
+		UPDATE invites
+		SET status = 'revoked', revoked_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+	`
+
+	tag, err := r.db.Exec(ctx, query, inviteID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invite: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInviteNotPending
+	}
+
+	return nil
+}
+
+// AcceptInvite consumes a pending invite and creates the invited user in a single transaction.
+// The invite is matched by both ID and token hash so only the latest link can be used, and only once.
+func (r *InviteRepo) AcceptInvite(ctx context.Context, inviteID string, tokenHash string, user *models.User) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		SELECT email, role, org_id
+		FROM invites
+		WHERE id = $1 AND token_hash = $2 AND status = 'pending' AND expires_at >= NOW()
+		FOR UPDATE
+	`
+	err = tx.QueryRow(ctx, query, inviteID, tokenHash).Scan(&user.Email, &user.Role, &user.OrgID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInviteNotPending
+		}
+		return fmt.Errorf("failed to get invite: %w", err)
+	}
+
+	user.ID = uuid.New().String()
+	query = `
+		INSERT INTO users (id, username, email, email_verified_at, password_hash, full_name, date_of_birth, status, role, org_id, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), $4, $5, $6, 'approved', $7, $8, NOW(), NOW())
+	`
+	_, err = tx.Exec(ctx, query,
+		user.ID,
+		user.Username,
+		user.Email,
+		user.PasswordHash,
+		user.FullName,
+		user.DateOfBirth,
+		user.Role,
+		user.OrgID,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrUserConflict
+		}
+		return fmt.Errorf("failed to create invited user: %w", err)
+	}
+
+	query = `
+		UPDATE invites
+		SET status = 'accepted', accepted_at = NOW(), accepted_user_id = $1, updated_at = NOW()
+		WHERE id = $2
+	`
+	if _, err := tx.Exec(ctx, query, user.ID, inviteID); err != nil {
+		return fmt.Errorf("failed to accept invite: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit invite acceptance: %w", err)
+	}
+
+	user.Status = models.UserStatusApproved
+	return nil
+}
@@ -0,0 +1,122 @@
+// Package logging sets up structured JSON logging with log/slog. Every record
+// logged with a request context carries the request ID, the authenticated
+// user ID and the trace ID, and personal data and secrets are redacted before
+// anything is written.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+)
+
+// Setup installs the JSON logger as the default slog logger. Output of the
+// standard log package is routed through it as well.
+func Setup(cfg *config.Config) error {
+	level, err := ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(New(os.Stdout, level))
+	return nil
+}
+
+// New creates a JSON logger that writes records at or above level to w.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	})
+	return slog.New(&contextHandler{Handler: handler})
+}
+
+// ParseLevel parses a level name: debug, info, warn or error.
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", name)
+	}
+	return level, nil
+}
+
+// Fatal logs msg and err at error level and exits.
+func Fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// requestFields are the fields attached to every record logged for a request.
+// The user ID is filled in once the request is authenticated.
+type requestFields struct {
+	requestID string
+	userID    string
+}
+
+type contextKey struct{}
+
+// MaxRequestIDLength is the longest request ID accepted from clients and
+// proxies. The request_id column of the audit log is as wide.
+const MaxRequestIDLength = 128
+
+// validRequestID limits accepted request IDs to short, log-safe values.
+var validRequestID = regexp.MustCompile(fmt.Sprintf(`^[A-Za-z0-9._:\-]{1,%d}$`, MaxRequestIDLength))
+
+// ValidRequestID reports whether a request ID sent by a client or proxy can be used as is.
+func ValidRequestID(requestID string) bool {
+	return validRequestID.MatchString(requestID)
+}
+
+// WithRequestID returns a context that attaches the request ID to every record logged with it.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestFields{requestID: requestID})
+}
+
+// RequestID returns the request ID of the context, if any.
+func RequestID(ctx context.Context) string {
+	if fields, ok := ctx.Value(contextKey{}).(*requestFields); ok {
+		return fields.requestID
+	}
+	return ""
+}
+
+// SetUserID attaches the authenticated user to every record logged for the
+// request from now on, including by middleware that already holds the context.
+func SetUserID(ctx context.Context, userID string) {
+	if fields, ok := ctx.Value(contextKey{}).(*requestFields); ok {
+		fields.userID = userID
+	}
+}
+
+// contextHandler adds the request and trace fields of the context to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if fields, ok := ctx.Value(contextKey{}).(*requestFields); ok {
+		r.AddAttrs(slog.String("request_id", fields.requestID))
+		if fields.userID != "" {
+			r.AddAttrs(slog.String("user_id", fields.userID))
+		}
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		r.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces values that must not be logged.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values are always redacted. A key
+// matches if it contains one of them, so "new_password" and "otp_code" match too.
+var sensitiveKeys = []string{"password", "otp", "token", "secret", "authorization", "cookie", "email", "phone"}
+
+// sensitivePatterns find personal data and secrets inside free text such as
+// messages and error strings.
+var sensitivePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),     // Email addresses
+	regexp.MustCompile(`eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`), // JWTs
+	regexp.MustCompile(`\+[1-9][0-9]{6,14}`),                                   // E.164 phone numbers
+}
+
+// redactAttr is the ReplaceAttr hook of the JSON handler.
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if isSensitiveKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, RedactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, RedactString(err.Error()))
+		}
+	}
+	return a
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactString replaces email addresses, tokens and phone numbers in s.
+func RedactString(s string) string {
+	for _, pattern := range sensitivePatterns {
+		s = pattern.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
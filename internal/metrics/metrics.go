@@ -0,0 +1,155 @@
+// Package metrics defines the Prometheus metrics the service exports on /metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// namespace prefixes every metric name.
+const namespace = "auth"
+
+// Results used as label values.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	grpcRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_requests_total",
+		Help:      "gRPC calls by full method name and status code.",
+	}, []string{"method", "code"})
+
+	grpcRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "gRPC call latency by full method name.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Sign-in attempts by result and, for failures, the reason they were rejected.",
+	}, []string{"result", "reason"})
+
+	otps = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "otp_total",
+		Help:      "One-time codes by scope and event: issued, verified or failed.",
+	}, []string{"scope", "event"})
+
+	emails = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emails_total",
+		Help:      "Emails by kind and result.",
+	}, []string{"kind", "result"})
+
+	emailDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "email_send_duration_seconds",
+		Help:      "Time taken to hand an email to the SMTP server.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"kind"})
+
+	passwordHashDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "password_hash_duration_seconds",
+		Help:      "Time taken by bcrypt to hash or compare a password.",
+		Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	}, []string{"operation"})
+
+	tokensIssued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_issued_total",
+		Help:      "Signed tokens issued by type.",
+	}, []string{"type"})
+
+	tokenVerifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_verifications_total",
+		Help:      "Token verifications by type and result.",
+	}, []string{"type", "result"})
+)
+
+// ObserveHTTPRequest records a served request. route is the route template,
+// such as /users/:userId, so that IDs do not create new series.
+func ObserveHTTPRequest(method string, route string, status string, seconds float64) {
+	httpRequests.WithLabelValues(method, route, status).Inc()
+	httpRequestDuration.WithLabelValues(method, route).Observe(seconds)
+}
+
+// ObserveGRPCRequest records a served gRPC call, such as
+// /auth.v1.AuthService/GetUser with code OK.
+func ObserveGRPCRequest(method string, code string, seconds float64) {
+	grpcRequests.WithLabelValues(method, code).Inc()
+	grpcRequestDuration.WithLabelValues(method).Observe(seconds)
+}
+
+// LoginSucceeded records a successful sign-in.
+func LoginSucceeded() {
+	logins.WithLabelValues(ResultSuccess, "").Inc()
+}
+
+// LoginFailed records a rejected sign-in and the reason it was rejected.
+func LoginFailed(reason string) {
+	logins.WithLabelValues(ResultFailure, reason).Inc()
+}
+
+// OTPIssued records a one-time code saved for the scope.
+func OTPIssued(scope string) {
+	otps.WithLabelValues(scope, "issued").Inc()
+}
+
+// OTPChecked records a one-time code that was checked, whether it matched or not.
+func OTPChecked(scope string, valid bool) {
+	event := "failed"
+	if valid {
+		event = "verified"
+	}
+	otps.WithLabelValues(scope, event).Inc()
+}
+
+// EmailSent records an attempt to send an email of the kind.
+func EmailSent(kind string, err error, seconds float64) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultFailure
+	}
+	emails.WithLabelValues(kind, result).Inc()
+	emailDuration.WithLabelValues(kind).Observe(seconds)
+}
+
+// ObservePasswordHash records the time bcrypt took for operation, "hash" or "compare".
+func ObservePasswordHash(operation string, seconds float64) {
+	passwordHashDuration.WithLabelValues(operation).Observe(seconds)
+}
+
+// TokenIssued records a signed token of the type.
+func TokenIssued(tokenType string) {
+	tokensIssued.WithLabelValues(tokenType).Inc()
+}
+
+// TokenVerified records a verification of a token of the type.
+func TokenVerified(tokenType string, err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultFailure
+	}
+	tokenVerifications.WithLabelValues(tokenType, result).Inc()
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RegisterPools exports the connection pool statistics of the database and Redis clients.
+func RegisterPools(db *pgxpool.Pool, redisClient *redis.Client) error {
+	if err := prometheus.Register(&pgxPoolCollector{pool: db}); err != nil {
+		return err
+	}
+	return prometheus.Register(&redisPoolCollector{client: redisClient})
+}
+
+var (
+	pgxAcquiredConns   = poolDesc("pgxpool", "acquired_conns", "Connections currently in use.")
+	pgxIdleConns       = poolDesc("pgxpool", "idle_conns", "Idle connections in the pool.")
+	pgxTotalConns      = poolDesc("pgxpool", "total_conns", "Open connections in the pool.")
+	pgxMaxConns        = poolDesc("pgxpool", "max_conns", "Largest number of connections the pool opens.")
+	pgxAcquires        = poolDesc("pgxpool", "acquires_total", "Connections acquired from the pool.")
+	pgxEmptyAcquires   = poolDesc("pgxpool", "empty_acquires_total", "Acquires that had to wait for a connection.")
+	pgxCanceledAcquire = poolDesc("pgxpool", "canceled_acquires_total", "Acquires canceled before they got a connection.")
+	pgxAcquireDuration = poolDesc("pgxpool", "acquire_duration_seconds_total", "Total time spent waiting for connections.")
+
+	redisHits       = poolDesc("redis_pool", "hits_total", "Times a free connection was found in the pool.")
+	redisMisses     = poolDesc("redis_pool", "misses_total", "Times no free connection was found in the pool.")
+	redisTimeouts   = poolDesc("redis_pool", "timeouts_total", "Times waiting for a connection timed out.")
+	redisTotalConns = poolDesc("redis_pool", "total_conns", "Open connections in the pool.")
+	redisIdleConns  = poolDesc("redis_pool", "idle_conns", "Idle connections in the pool.")
+	redisStaleConns = poolDesc("redis_pool", "stale_conns_total", "Stale connections removed from the pool.")
+)
+
+func poolDesc(subsystem string, name string, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, name), help, nil, nil)
+}
+
+// pgxPoolCollector reads the database pool statistics on every scrape.
+type pgxPoolCollector struct {
+	pool *pgxpool.Pool
+}
+
+func (c *pgxPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{pgxAcquiredConns, pgxIdleConns, pgxTotalConns, pgxMaxConns, pgxAcquires, pgxEmptyAcquires, pgxCanceledAcquire, pgxAcquireDuration} {
+		ch <- desc
+	}
+}
+
+func (c *pgxPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(pgxAcquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(pgxIdleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(pgxTotalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(pgxMaxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(pgxAcquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pgxEmptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pgxCanceledAcquire, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pgxAcquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
+
+// redisPoolCollector reads the Redis pool statistics on every scrape.
+type redisPoolCollector struct {
+	client *redis.Client
+}
+
+func (c *redisPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{redisHits, redisMisses, redisTimeouts, redisTotalConns, redisIdleConns, redisStaleConns} {
+		ch <- desc
+	}
+}
+
+func (c *redisPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(redisHits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(redisMisses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(redisTimeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(redisTotalConns, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(redisIdleConns, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(redisStaleConns, prometheus.CounterValue, float64(stats.StaleConns))
+}
@@ -1,35 +1,67 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
+// Roles known to the auth service.
+const (
+	RoleUser     = "user"
+	RoleCourier  = "courier"
+	RoleStaff    = "staff"
+	RoleSupport  = "support"
+	RoleOrgOwner = "org_owner"
+	RoleAdmin    = "admin"
+)
+
+// Account statuses of a user. Couriers stay pending until an admin approves them.
+const (
+	UserStatusPending  = "pending"
+	UserStatusApproved = "approved"
+	UserStatusCanceled = "canceled"
+)
+
 // User represents a user in the system.
 type User struct {
-	ID           string    `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"` // Don't expose password hash in JSON responses
-	FullName     string    `json:"full_name"`
-	DateOfBirth  time.Time `json:"date_of_birth"`
-	Status       string    `json:"status"`
-	Role         string    `json:"role"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID                    string     `json:"id"`
+	Username              string     `json:"username"`
+	Email                 string     `json:"email"`
+	EmailVerifiedAt       *time.Time `json:"email_verified_at,omitempty"`
+	Phone                 *string    `json:"phone,omitempty"` // E.164
+	PhoneVerifiedAt       *time.Time `json:"phone_verified_at,omitempty"`
+	PasswordHash          string     `json:"-"` // Don't expose password hash in JSON responses
+	FullName              string     `json:"full_name"`
+	DateOfBirth           time.Time  `json:"date_of_birth"`
+	AgeVerified           bool       `json:"age_verified"` // Date of birth checked against an identity document
+	AgeVerifiedAt         *time.Time `json:"age_verified_at,omitempty"`
+	Status                string     `json:"status"`
+	Role                  string     `json:"role"`
+	OrgID                 *string    `json:"org_id,omitempty"`
+	RoleSelfAssigned      bool       `json:"role_self_assigned"` // Elevated role that was never approved by an admin
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+	DeletedAt             *time.Time `json:"deleted_at,omitempty"`
 }
 
+// UserCreate is the self-registration payload. Only the customer ("user") and
+// courier applicant ("courier") roles can be chosen here; anything higher goes
+// through a role request. Either an email or a phone number is required.
 type UserCreate struct {
-	Username    string    `json:"username"`
-	Email       string    `json:"email"`
-	FullName    string    `json:"full_name"`
-	DateOfBirth time.Time `json:"date_of_birth"`
+	Username    string    `json:"username" binding:"required,username"`
+	Email       string    `json:"email" binding:"required_without=Phone,omitempty,email,max=100"`
+	Phone       string    `json:"phone" binding:"required_without=Email,omitempty,phone"`
+	FullName    string    `json:"full_name" binding:"max=100"`
+	DateOfBirth time.Time `json:"date_of_birth" binding:"required,min_age=13"`
+	Role        string    `json:"role" binding:"omitempty,oneof=user courier"`
 }
 
 type UserUpdate struct {
 	ID          string    `json:"id"`
-	Username    string    `json:"username"`
-	FullName    string    `json:"full_name"`
-	DateOfBirth time.Time `json:"date_of_birth"`
+	Username    string    `json:"username" binding:"required,username"`
+	FullName    string    `json:"full_name" binding:"max=100"`
+	DateOfBirth time.Time `json:"date_of_birth" binding:"required,min_age=13"`
 }
 
 type UserUpdatePass struct {
@@ -38,14 +70,228 @@ type UserUpdatePass struct {
 }
 
 type UserUpdateStatus struct {
+	Email  string `json:"email" binding:"required,email"`
+	Status string `json:"status" binding:"required,user_status"`
+}
+
+// User list matching, sorting and ordering options.
+const (
+	MatchPartial = "partial"
+	MatchExact   = "exact"
+
+	SortByCreatedAt = "created_at"
+	SortByUsername  = "username"
+	SortByEmail     = "email"
+
+	SortAsc  = "asc"
+	SortDesc = "desc"
+
+	DeletedExclude = "exclude"
+	DeletedInclude = "include"
+	DeletedOnly    = "only"
+)
+
+type GetAllUsers struct {
+	Email        string     `json:"email"`
+	FullName     string     `json:"full_name"`
+	Username     string     `json:"username"`
+	Status       string     `json:"status"`
+	Role         string     `json:"role"`
+	SelfAssigned *bool      `json:"role_self_assigned"` // Only users whose role was (or was not) self-assigned
+	Match        string     `json:"match"`
+	CreatedFrom  *time.Time `json:"created_from"`
+	CreatedTo    *time.Time `json:"created_to"`
+	SortBy       string     `json:"sort"`
+	SortOrder    string     `json:"order"`
+	Limit        int        `json:"limit"`
+	Cursor       string     `json:"cursor"`
+	IncludeTotal bool       `json:"include_total"`
+	Deleted      string     `json:"deleted"`
+}
+
+// UserList is one page of users. NextCursor is empty on the last page.
+type UserList struct {
+	Items      []*User `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	TotalCount *int64  `json:"total_count,omitempty"`
+}
+
+// UserSearchResult is a user matched by fuzzy search. Highlights holds the
+// matching fields with the matched text wrapped in <mark> tags (HTML-escaped).
+type UserSearchResult struct {
+	User       *User             `json:"user"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// Invite represents an invitation for a new account with a preassigned role.
+type Invite struct {
+	ID             string     `json:"id"`
+	Email          string     `json:"email"`
+	Role           string     `json:"role"`
+	OrgID          *string    `json:"org_id,omitempty"`
+	TokenHash      string     `json:"-"`
+	Status         string     `json:"status"`
+	InvitedBy      string     `json:"invited_by"`
+	AcceptedUserID *string    `json:"accepted_user_id,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+type InviteCreate struct {
+	Email string  `json:"email" binding:"required,email"`
+	Role  string  `json:"role" binding:"required"`
+	OrgID *string `json:"org_id"`
+}
+
+type InviteAccept struct {
+	Token       string    `json:"token" binding:"required"`
+	Username    string    `json:"username" binding:"required,username"`
+	FullName    string    `json:"full_name" binding:"max=100"`
+	DateOfBirth time.Time `json:"date_of_birth" binding:"required,min_age=13"`
+	Password    string    `json:"password" binding:"required,min=8,max=72"`
+}
+
+type GetAllInvites struct {
 	Email  string `json:"email"`
 	Status string `json:"status"`
+	OrgID  string `json:"org_id"`
 }
 
-type GetAllUsers struct {
-	Email    string `json:"email"`
-	FullName string `json:"full_name"`
-	Username string `json:"username"`
-	Status   string `json:"status"`
-	Role     string `json:"role"`
+// RoleRequest represents a user's request to be granted a different role.
+type RoleRequest struct {
+	ID            string     `json:"id"`
+	UserID        string     `json:"user_id"`
+	RequestedRole string     `json:"requested_role"`
+	Reason        string     `json:"reason"`
+	Status        string     `json:"status"`
+	ReviewedBy    *string    `json:"reviewed_by,omitempty"`
+	ReviewNote    *string    `json:"review_note,omitempty"`
+	ReviewedAt    *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+type RoleRequestCreate struct {
+	Role   string `json:"role" binding:"required,oneof=courier staff support org_owner admin"`
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+type RoleRequestReview struct {
+	Note string `json:"note" binding:"max=500"`
+}
+
+type GetAllRoleRequests struct {
+	UserID string `json:"user_id"`
+	Status string `json:"status"`
+}
+
+// AuditEvent is a single entry of the hash-chained security audit log.
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	ActorID    string          `json:"actor_id,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	Action     string          `json:"action"`
+	IP         string          `json:"ip,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Diff       json.RawMessage `json:"diff,omitempty" swaggertype:"object"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+type GetAllAuditEvents struct {
+	ActorID   string     `json:"actor_id"`
+	TargetID  string     `json:"target_id"`
+	Action    string     `json:"action"`
+	RequestID string     `json:"request_id"`
+	From      *time.Time `json:"from"`
+	To        *time.Time `json:"to"`
+	Cursor    int64      `json:"cursor"`
+	Limit     int        `json:"limit"`
+}
+
+type AuditEventList struct {
+	Items      []*AuditEvent `json:"items"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+type AuditChainStatus struct {
+	Valid          bool  `json:"valid"`
+	Checked        int64 `json:"checked"`
+	FirstInvalidID int64 `json:"first_invalid_id,omitempty"`
+}
+
+// KnownDevice is a device fingerprint a user has previously signed in from.
+type KnownDevice struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	Fingerprint string    `json:"-"`
+	UserAgent   string    `json:"user_agent"`
+	IPPrefix    string    `json:"ip_prefix"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// DataExport is an asynchronously built archive of the personal data held about a user.
+type DataExport struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	RequestedBy *string    `json:"requested_by,omitempty"`
+	Format      string     `json:"format"` // json, zip
+	Status      string     `json:"status"` // pending, ready, failed
+	Error       *string    `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
+
+// UserDataExport is the content of a data export archive.
+type UserDataExport struct {
+	ExportedAt   time.Time       `json:"exported_at"`
+	Profile      *User           `json:"profile"`
+	Sessions     []*KnownDevice  `json:"sessions"`
+	LoginHistory []*AuditEvent   `json:"login_history"`
+	AuditEvents  []*AuditEvent   `json:"audit_events"`
+	RoleRequests []*RoleRequest  `json:"role_requests"`
+	Invites      []*Invite       `json:"invites"`
+	Identities   []*UserIdentity `json:"identities"`
+}
+
+// UserErasure confirms a self-service erasure request. Accounts without a
+// password confirm by having signed in recently instead.
+type UserErasure struct {
+	Password string `json:"password"`
+}
+
+// AgeVerificationUpdate records the outcome of an admin's review of a user's identity document.
+type AgeVerificationUpdate struct {
+	Verified *bool  `json:"verified" binding:"required"`
+	Note     string `json:"note" binding:"max=500"`
+}
+
+// PhoneUpdate sets a new, unverified phone number on an account.
+type PhoneUpdate struct {
+	Phone string `json:"phone" binding:"required,phone"`
+}
+
+// PhoneVerify confirms a phone number with the code sent to it.
+type PhoneVerify struct {
+	OTP string `json:"otp" binding:"required,len=6,numeric"`
+}
+
+// UserIdentity is an external sign-in identity (Google, Apple, Telegram, ...) linked to a user.
+type UserIdentity struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       *string    `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
 }
@@ -0,0 +1,132 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+)
+
+// appleAudience is the audience of the client secrets Apple accepts.
+const appleAudience = "https://appleid.apple.com"
+
+// appleSecretExpiry is how long a generated client secret is used. Apple
+// accepts up to six months.
+const appleSecretExpiry = time.Hour
+
+// AppleProvider signs users in with Apple. It is an OpenID Connect provider
+// whose client secret is a JWT signed with a key from the Apple developer
+// account, and which posts the response back to the redirect URI.
+type AppleProvider struct {
+	*OIDCProvider
+
+	teamID string
+	keyID  string
+	key    *ecdsa.PrivateKey
+
+	mu              sync.Mutex
+	secret          string
+	secretExpiresAt time.Time
+}
+
+// NewAppleProvider creates a Sign in with Apple provider.
+func NewAppleProvider(p config.OAuthProvider, redirectURI string, client *http.Client) (*AppleProvider, error) {
+	provider, err := NewOIDCProvider(p, redirectURI, client)
+	if err != nil {
+		return nil, err
+	}
+	if p.AppleTeamID == "" || p.AppleKeyID == "" || p.ApplePrivateKey == "" {
+		return nil, errors.New("team ID, key ID and private key are required")
+	}
+	key, err := parseApplePrivateKey(p.ApplePrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	apple := &AppleProvider{
+		OIDCProvider: provider,
+		teamID:       p.AppleTeamID,
+		keyID:        p.AppleKeyID,
+		key:          key,
+	}
+	// Apple requires form_post whenever the name or email scope is requested.
+	provider.authParams.Set("response_mode", "form_post")
+	provider.clientSecret = apple.clientSecret
+	return apple, nil
+}
+
+// Callback verifies the response and adds the user's name, which Apple only
+// sends on the first sign-in and never puts in the ID token.
+func (p *AppleProvider) Callback(ctx context.Context, params url.Values, req *AuthRequest) (*Identity, error) {
+	identity, err := p.OIDCProvider.Callback(ctx, params, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var user struct {
+		Name struct {
+			FirstName string `json:"firstName"`
+			LastName  string `json:"lastName"`
+		} `json:"name"`
+	}
+	if raw := params.Get("user"); raw != "" && json.Unmarshal([]byte(raw), &user) == nil {
+		identity.Name = strings.TrimSpace(user.Name.FirstName + " " + user.Name.LastName)
+	}
+
+	return identity, nil
+}
+
+// clientSecret returns a cached client secret, signing a new one when it is about to expire.
+func (p *AppleProvider) clientSecret() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if p.secret != "" && now.Add(time.Minute).Before(p.secretExpiresAt) {
+		return p.secret, nil
+	}
+
+	expiresAt := now.Add(appleSecretExpiry)
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.StandardClaims{
+		Issuer:    p.teamID,
+		Subject:   p.clientID,
+		Audience:  appleAudience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	token.Header["kid"] = p.keyID
+
+	secret, err := token.SignedString(p.key)
+	if err != nil {
+		return "", err
+	}
+	p.secret, p.secretExpiresAt = secret, expiresAt
+	return secret, nil
+}
+
+// parseApplePrivateKey parses the PKCS #8 .p8 key downloaded from Apple. Keys
+// passed through environment variables may have their newlines escaped.
+func parseApplePrivateKey(raw string) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(strings.ReplaceAll(raw, `\n`, "\n")))
+	if block == nil {
+		return nil, errors.New("private key must be PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if ecKey, ok := key.(*ecdsa.PrivateKey); ok {
+			return ecKey, nil
+		}
+		return nil, errors.New("private key is not an ECDSA key")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
@@ -0,0 +1,147 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+)
+
+var (
+	// ErrProviderNotFound is returned for a provider that is not configured.
+	ErrProviderNotFound = errors.New("sign-in provider not found")
+	// ErrRedirectNotSupported is returned by providers that sign in through an
+	// embedded widget rather than a redirect, such as Telegram.
+	ErrRedirectNotSupported = errors.New("sign-in provider does not support redirects")
+	// ErrInvalidResponse is returned when the provider's response cannot be
+	// verified: a bad signature, a wrong audience or nonce, an expired token, ...
+	ErrInvalidResponse = errors.New("invalid response from sign-in provider")
+)
+
+// httpTimeout bounds every request made to a provider.
+const httpTimeout = 10 * time.Second
+
+// Identity is the account a user signed in with at a provider.
+type Identity struct {
+	Provider      string
+	Subject       string // Stable account ID at the provider
+	Email         string
+	EmailVerified bool // Whether the provider vouches for the email
+	Name          string
+}
+
+// AuthRequest holds the per-sign-in secrets that bind the provider's response
+// to the request that started it.
+type AuthRequest struct {
+	State        string
+	Nonce        string
+	CodeVerifier string // PKCE
+}
+
+// NewAuthRequest generates fresh random values for a sign-in.
+func NewAuthRequest() (*AuthRequest, error) {
+	values := make([]string, 3)
+	for i := range values {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate auth request: %w", err)
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return &AuthRequest{State: values[0], Nonce: values[1], CodeVerifier: values[2]}, nil
+}
+
+// CodeChallenge returns the S256 PKCE challenge of the code verifier.
+func (r *AuthRequest) CodeChallenge() string {
+	sum := sha256.Sum256([]byte(r.CodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Provider is an external sign-in provider.
+type Provider interface {
+	Name() string
+	// AuthCodeURL returns the URL to send the user to for signing in.
+	AuthCodeURL(ctx context.Context, req *AuthRequest) (string, error)
+	// Callback verifies the provider's response to the redirect URI and
+	// returns the identity that signed in. req is nil for providers that do
+	// not support redirects.
+	Callback(ctx context.Context, params url.Values, req *AuthRequest) (*Identity, error)
+}
+
+// Registry holds the configured providers by name.
+type Registry struct {
+	providers map[string]Provider
+}
+
+// NewRegistry creates the providers configured in cfg. Redirect URIs are
+// <AppBaseURL>/auth/oauth/<name>/callback.
+func NewRegistry(cfg *config.Config) (*Registry, error) {
+	registry := &Registry{providers: map[string]Provider{}}
+	client := &http.Client{Timeout: httpTimeout}
+
+	for _, p := range cfg.OAuthProviders {
+		if _, ok := registry.providers[p.Name]; ok {
+			return nil, fmt.Errorf("sign-in provider %q is configured twice", p.Name)
+		}
+		redirectURI := CallbackURL(cfg.AppBaseURL, p.Name)
+
+		var (
+			provider Provider
+			err      error
+		)
+		switch p.Type {
+		case config.OAuthTypeOIDC:
+			provider, err = NewOIDCProvider(p, redirectURI, client)
+		case config.OAuthTypeApple:
+			provider, err = NewAppleProvider(p, redirectURI, client)
+		case config.OAuthTypeTelegram:
+			provider, err = NewTelegramProvider(p)
+		default:
+			err = fmt.Errorf("unknown type %q", p.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sign-in provider %s: %w", p.Name, err)
+		}
+		registry.providers[p.Name] = provider
+	}
+
+	return registry, nil
+}
+
+// Register adds a provider, replacing any provider with the same name.
+func (r *Registry) Register(provider Provider) {
+	r.providers[provider.Name()] = provider
+}
+
+// Get returns the named provider.
+func (r *Registry) Get(name string) (Provider, error) {
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, ErrProviderNotFound
+	}
+	return provider, nil
+}
+
+// Names returns the names of the configured providers, sorted.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CallbackURL returns the redirect URI registered with the named provider.
+func CallbackURL(baseURL string, name string) string {
+	return strings.TrimRight(baseURL, "/") + "/auth/oauth/" + name + "/callback"
+}
@@ -0,0 +1,316 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+)
+
+// clockSkew is how far the provider's clock may be off when checking token times.
+const clockSkew = time.Minute
+
+// discoveryDocument is the part of the OpenID Provider Metadata that is used.
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider signs users in with the OpenID Connect authorization code flow
+// and PKCE. Endpoints are discovered from the issuer on first use and the
+// ID token is verified against the provider's published signing keys.
+type OIDCProvider struct {
+	name        string
+	issuer      string
+	clientID    string
+	redirectURI string
+	scopes      []string
+	client      *http.Client
+
+	// clientSecret returns the secret sent with the code exchange.
+	clientSecret func() (string, error)
+	// authParams are extra parameters of the authorization request.
+	authParams url.Values
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	keys      *keySet
+}
+
+// NewOIDCProvider creates a provider for any OpenID Connect compliant issuer, such as Google.
+func NewOIDCProvider(p config.OAuthProvider, redirectURI string, client *http.Client) (*OIDCProvider, error) {
+	if p.Issuer == "" || p.ClientID == "" {
+		return nil, errors.New("issuer and client ID are required")
+	}
+	secret := p.ClientSecret
+	return &OIDCProvider{
+		name:         p.Name,
+		issuer:       strings.TrimRight(p.Issuer, "/"),
+		clientID:     p.ClientID,
+		redirectURI:  redirectURI,
+		scopes:       p.Scopes,
+		client:       client,
+		clientSecret: func() (string, error) { return secret, nil },
+		authParams:   url.Values{},
+	}, nil
+}
+
+// Name returns the name of the provider.
+func (p *OIDCProvider) Name() string {
+	return p.name
+}
+
+// AuthCodeURL returns the authorization endpoint URL for the request.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, req *AuthRequest) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {p.redirectURI},
+		"scope":                 {strings.Join(p.scopes, " ")},
+		"state":                 {req.State},
+		"nonce":                 {req.Nonce},
+		"code_challenge":        {req.CodeChallenge()},
+		"code_challenge_method": {"S256"},
+	}
+	for key, values := range p.authParams {
+		params[key] = values
+	}
+
+	sep := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return discovery.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Callback exchanges the authorization code for tokens and verifies the ID token.
+func (p *OIDCProvider) Callback(ctx context.Context, params url.Values, req *AuthRequest) (*Identity, error) {
+	if req == nil {
+		return nil, fmt.Errorf("%w: missing auth request", ErrInvalidResponse)
+	}
+	if errCode := params.Get("error"); errCode != "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidResponse, errCode)
+	}
+	code := params.Get("code")
+	if code == "" {
+		return nil, fmt.Errorf("%w: missing code", ErrInvalidResponse)
+	}
+
+	idToken, err := p.exchange(ctx, code, req.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	return p.VerifyIDToken(ctx, idToken, req.Nonce)
+}
+
+// tokenResponse is the token endpoint response.
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (p *OIDCProvider) exchange(ctx context.Context, code string, codeVerifier string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	secret, err := p.clientSecret()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURI},
+		"client_id":     {p.clientID},
+		"code_verifier": {codeVerifier},
+	}
+	if secret != "" {
+		form.Set("client_secret", secret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if token.Error != "" {
+		return "", fmt.Errorf("%w: %s %s", ErrInvalidResponse, token.Error, token.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return "", fmt.Errorf("%w: token endpoint returned %s without an ID token", ErrInvalidResponse, resp.Status)
+	}
+
+	return token.IDToken, nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token and returns the identity it asserts.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawToken string, nonce string) (*Identity, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims idTokenClaims
+	_, err = jwt.ParseWithClaims(rawToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected token signing method %s", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	switch {
+	// Google may leave out the scheme of its issuer.
+	case claims.Issuer != discovery.Issuer && "https://"+claims.Issuer != discovery.Issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidResponse, claims.Issuer)
+	case !claims.Audience.contains(p.clientID):
+		return nil, fmt.Errorf("%w: token was issued to another client", ErrInvalidResponse)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.clientID:
+		return nil, fmt.Errorf("%w: token was issued to another client", ErrInvalidResponse)
+	case nonce != "" && claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidResponse)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidResponse)
+	}
+
+	return &Identity{
+		Provider:      p.name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.Email != "" && bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+// discover fetches the provider metadata once and caches it. Failed lookups
+// are retried on the next call.
+func (p *OIDCProvider) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery discoveryDocument
+	if err := getJSON(ctx, p.client, p.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", p.name, err)
+	}
+	if discovery.Issuer != p.issuer {
+		return nil, fmt.Errorf("failed to discover %s: issuer %q does not match %q", p.name, discovery.Issuer, p.issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("failed to discover %s: incomplete provider metadata", p.name)
+	}
+
+	p.discovery = &discovery
+	p.keys = newKeySet(discovery.JWKSURI, p.client)
+	return p.discovery, nil
+}
+
+// idTokenClaims are the claims of an OpenID Connect ID token.
+type idTokenClaims struct {
+	Issuer          string       `json:"iss"`
+	Subject         string       `json:"sub"`
+	Audience        audience     `json:"aud"`
+	AuthorizedParty string       `json:"azp"`
+	ExpiresAt       int64        `json:"exp"`
+	IssuedAt        int64        `json:"iat"`
+	Nonce           string       `json:"nonce"`
+	Email           string       `json:"email"`
+	EmailVerified   flexibleBool `json:"email_verified"`
+	Name            string       `json:"name"`
+}
+
+// Valid checks the token times, allowing for clock skew.
+func (c *idTokenClaims) Valid() error {
+	now := time.Now()
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(clockSkew)) {
+		return errors.New("token is expired")
+	}
+	if c.IssuedAt != 0 && now.Add(clockSkew).Before(time.Unix(c.IssuedAt, 0)) {
+		return errors.New("token used before issued")
+	}
+	return nil
+}
+
+// audience is the aud claim, which may be a single string or an array.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// flexibleBool is a boolean claim that some providers (Apple) send as a string.
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case bool:
+		*b = flexibleBool(v)
+	case string:
+		*b = flexibleBool(v == "true")
+	default:
+		*b = false
+	}
+	return nil
+}
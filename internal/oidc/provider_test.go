@@ -0,0 +1,314 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/oidc"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/oidc/oidctest"
+)
+
+const (
+	testClientID     = "test-client"
+	testClientSecret = "test-secret"
+	testRedirectURI  = "http://auth.test/auth/oauth/mock/callback"
+)
+
+func newTestServer(t *testing.T) *oidctest.Server {
+	t.Helper()
+	server, err := oidctest.NewServer(testClientID, testClientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestProvider(t *testing.T, server *oidctest.Server) *oidc.OIDCProvider {
+	t.Helper()
+	provider, err := oidc.NewOIDCProvider(server.ProviderConfig("mock"), testRedirectURI, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+// authorize follows the provider's authorization URL like a browser would and
+// returns the parameters of the redirect back to the callback.
+func authorize(t *testing.T, server *oidctest.Server, provider *oidc.OIDCProvider, req *oidc.AuthRequest) url.Values {
+	t.Helper()
+	authURL, err := provider.AuthCodeURL(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := *server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatalf("authorization response has no redirect: %v", err)
+	}
+	return location.Query()
+}
+
+func TestOIDCProviderCallback(t *testing.T) {
+	server := newTestServer(t)
+	provider := newTestProvider(t, server)
+
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := authorize(t, server, provider, req)
+	if params.Get("state") != req.State {
+		t.Fatalf("state = %q, want %q", params.Get("state"), req.State)
+	}
+
+	identity, err := provider.Callback(context.Background(), params, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := oidc.Identity{
+		Provider:      "mock",
+		Subject:       server.User.Subject,
+		Email:         server.User.Email,
+		EmailVerified: true,
+		Name:          server.User.Name,
+	}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+
+	// Codes are single use.
+	if _, err := provider.Callback(context.Background(), params, req); !errors.Is(err, oidc.ErrInvalidResponse) {
+		t.Errorf("replayed code: err = %v, want ErrInvalidResponse", err)
+	}
+}
+
+func TestOIDCProviderCallbackRejects(t *testing.T) {
+	server := newTestServer(t)
+	provider := newTestProvider(t, server)
+
+	tests := []struct {
+		name   string
+		mutate func(params url.Values, req *oidc.AuthRequest) *oidc.AuthRequest
+	}{
+		{
+			name: "wrong code verifier",
+			mutate: func(params url.Values, req *oidc.AuthRequest) *oidc.AuthRequest {
+				other := *req
+				other.CodeVerifier = "another-verifier"
+				return &other
+			},
+		},
+		{
+			name: "missing auth request",
+			mutate: func(params url.Values, req *oidc.AuthRequest) *oidc.AuthRequest {
+				return nil
+			},
+		},
+		{
+			name: "provider error",
+			mutate: func(params url.Values, req *oidc.AuthRequest) *oidc.AuthRequest {
+				params.Del("code")
+				params.Set("error", "access_denied")
+				return req
+			},
+		},
+		{
+			name: "missing code",
+			mutate: func(params url.Values, req *oidc.AuthRequest) *oidc.AuthRequest {
+				params.Del("code")
+				return req
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := oidc.NewAuthRequest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			params := authorize(t, server, provider, req)
+			req = tt.mutate(params, req)
+
+			if _, err := provider.Callback(context.Background(), params, req); !errors.Is(err, oidc.ErrInvalidResponse) {
+				t.Errorf("err = %v, want ErrInvalidResponse", err)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderVerifyIDToken(t *testing.T) {
+	server := newTestServer(t)
+	foreign := newTestServer(t)
+	provider := newTestProvider(t, server)
+
+	const nonce = "test-nonce"
+	user := server.User
+	unverified := user
+	unverified.EmailVerified = false
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		token        func() (string, error)
+		wantErr      bool
+		wantVerified bool
+	}{
+		{
+			name:         "valid",
+			token:        func() (string, error) { return server.SignIDToken(user, nonce, nil) },
+			wantVerified: true,
+		},
+		{
+			name:  "unverified email",
+			token: func() (string, error) { return server.SignIDToken(unverified, nonce, nil) },
+		},
+		{
+			name: "email verified as a string",
+			token: func() (string, error) {
+				return server.SignIDToken(unverified, nonce, jwt.MapClaims{"email_verified": "true"})
+			},
+			wantVerified: true,
+		},
+		{
+			name:  "verified without an email",
+			token: func() (string, error) { return server.SignIDToken(user, nonce, jwt.MapClaims{"email": ""}) },
+		},
+		{
+			name: "several audiences with this client as authorized party",
+			token: func() (string, error) {
+				return server.SignIDToken(user, nonce, jwt.MapClaims{"aud": []string{testClientID, "other"}, "azp": testClientID})
+			},
+			wantVerified: true,
+		},
+		{
+			name: "expired within clock skew",
+			token: func() (string, error) {
+				return server.SignIDToken(user, nonce, jwt.MapClaims{"exp": now.Add(-30 * time.Second).Unix()})
+			},
+			wantVerified: true,
+		},
+		{
+			name:    "wrong nonce",
+			token:   func() (string, error) { return server.SignIDToken(user, "another-nonce", nil) },
+			wantErr: true,
+		},
+		{
+			name:    "missing nonce",
+			token:   func() (string, error) { return server.SignIDToken(user, "", nil) },
+			wantErr: true,
+		},
+		{
+			name:    "another audience",
+			token:   func() (string, error) { return server.SignIDToken(user, nonce, jwt.MapClaims{"aud": "other"}) },
+			wantErr: true,
+		},
+		{
+			name: "several audiences without authorized party",
+			token: func() (string, error) {
+				return server.SignIDToken(user, nonce, jwt.MapClaims{"aud": []string{testClientID, "other"}})
+			},
+			wantErr: true,
+		},
+		{
+			name: "another issuer",
+			token: func() (string, error) {
+				return server.SignIDToken(user, nonce, jwt.MapClaims{"iss": "https://issuer.example"})
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			token: func() (string, error) {
+				return server.SignIDToken(user, nonce, jwt.MapClaims{"exp": now.Add(-time.Hour).Unix()})
+			},
+			wantErr: true,
+		},
+		{
+			name: "issued in the future",
+			token: func() (string, error) {
+				return server.SignIDToken(user, nonce, jwt.MapClaims{"iat": now.Add(time.Hour).Unix()})
+			},
+			wantErr: true,
+		},
+		{
+			name:    "missing subject",
+			token:   func() (string, error) { return server.SignIDToken(user, nonce, jwt.MapClaims{"sub": ""}) },
+			wantErr: true,
+		},
+		{
+			// Same key ID and claims, but a key the server's JWKS does not publish.
+			name: "signed with a foreign key",
+			token: func() (string, error) {
+				return foreign.SignIDToken(user, nonce, jwt.MapClaims{"iss": server.Issuer(), "aud": testClientID})
+			},
+			wantErr: true,
+		},
+		{
+			name: "symmetric signature",
+			token: func() (string, error) {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+					"iss": server.Issuer(),
+					"sub": user.Subject,
+					"aud": testClientID,
+					"exp": now.Add(time.Hour).Unix(),
+				})
+				token.Header["kid"] = "oidctest"
+				return token.SignedString([]byte(testClientSecret))
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsigned",
+			token: func() (string, error) {
+				token := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+					"iss": server.Issuer(),
+					"sub": user.Subject,
+					"aud": testClientID,
+					"exp": now.Add(time.Hour).Unix(),
+				})
+				return token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := tt.token()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			identity, err := provider.VerifyIDToken(context.Background(), raw, nonce)
+			if tt.wantErr {
+				if !errors.Is(err, oidc.ErrInvalidResponse) {
+					t.Fatalf("err = %v, want ErrInvalidResponse", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.Subject != user.Subject {
+				t.Errorf("subject = %q, want %q", identity.Subject, user.Subject)
+			}
+			if identity.EmailVerified != tt.wantVerified {
+				t.Errorf("email verified = %v, want %v", identity.EmailVerified, tt.wantVerified)
+			}
+		})
+	}
+}
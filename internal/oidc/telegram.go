@@ -0,0 +1,85 @@
+package oidc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+)
+
+// telegramAuthMaxAge is how old the widget's auth_date may be, limiting how
+// long intercepted login data can be replayed.
+const telegramAuthMaxAge = 15 * time.Minute
+
+// TelegramProvider signs users in with the Telegram Login Widget. The widget
+// runs on the client, which passes the signed user data to the callback (for
+// example with data-auth-url), so there is no redirect to start the sign-in
+// and no state to check. Telegram does not share email addresses.
+type TelegramProvider struct {
+	name      string
+	secretKey []byte
+}
+
+// NewTelegramProvider creates a Telegram Login Widget provider.
+func NewTelegramProvider(p config.OAuthProvider) (*TelegramProvider, error) {
+	if p.BotToken == "" {
+		return nil, errors.New("bot token is required")
+	}
+	secretKey := sha256.Sum256([]byte(p.BotToken))
+	return &TelegramProvider{name: p.Name, secretKey: secretKey[:]}, nil
+}
+
+// Name returns the name of the provider.
+func (p *TelegramProvider) Name() string {
+	return p.name
+}
+
+// AuthCodeURL always fails; the sign-in starts with the widget.
+func (p *TelegramProvider) AuthCodeURL(ctx context.Context, req *AuthRequest) (string, error) {
+	return "", ErrRedirectNotSupported
+}
+
+// Callback checks the hash of the widget data against the bot token and
+// returns the Telegram account it describes.
+func (p *TelegramProvider) Callback(ctx context.Context, params url.Values, req *AuthRequest) (*Identity, error) {
+	hash := params.Get("hash")
+	if hash == "" || params.Get("id") == "" {
+		return nil, fmt.Errorf("%w: missing id or hash", ErrInvalidResponse)
+	}
+
+	// The data-check-string is every received field except the hash, sorted, as key=value lines.
+	var fields []string
+	for key := range params {
+		if key != "hash" {
+			fields = append(fields, key+"="+params.Get(key))
+		}
+	}
+	sort.Strings(fields)
+
+	mac := hmac.New(sha256.New, p.secretKey)
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	expected, err := hex.DecodeString(hash)
+	if err != nil || !hmac.Equal(mac.Sum(nil), expected) {
+		return nil, fmt.Errorf("%w: hash mismatch", ErrInvalidResponse)
+	}
+
+	authDate, err := strconv.ParseInt(params.Get("auth_date"), 10, 64)
+	if err != nil || time.Since(time.Unix(authDate, 0)) > telegramAuthMaxAge {
+		return nil, fmt.Errorf("%w: login data has expired", ErrInvalidResponse)
+	}
+
+	return &Identity{
+		Provider: p.name,
+		Subject:  params.Get("id"),
+		Name:     strings.TrimSpace(params.Get("first_name") + " " + params.Get("last_name")),
+	}, nil
+}
@@ -0,0 +1,36 @@
+package phone
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidPhone is returned for numbers that cannot be normalized to E.164.
+var ErrInvalidPhone = errors.New("phone number must be in international format, e.g. +998901234567")
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// separators are the characters people commonly type between digit groups.
+var separators = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "", "\u00a0", "")
+
+// Normalize converts a phone number in international format to E.164. Common
+// separators are removed and a leading 00 is accepted in place of +.
+func Normalize(raw string) (string, error) {
+	s := separators.Replace(strings.TrimSpace(raw))
+	if strings.HasPrefix(s, "00") {
+		s = "+" + s[2:]
+	}
+	if !e164.MatchString(s) {
+		return "", ErrInvalidPhone
+	}
+	return s, nil
+}
+
+// Mask hides all but the last few digits of an E.164 number, for messages and logs.
+func Mask(e164 string) string {
+	if len(e164) <= 4 {
+		return e164
+	}
+	return strings.Repeat("*", len(e164)-4) + e164[len(e164)-4:]
+}
@@ -0,0 +1,101 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Bind converts an error from binding a request into a problem. Validation
+// failures are reported per field; anything else means the body could not be parsed.
+func Bind(err error) *Error {
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		e := ValidationFailed.New("One or more fields are invalid")
+		for _, fe := range verrs {
+			e.WithField(fe.Field(), fieldMessage(fe))
+		}
+		return e
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return ValidationFailed.New("One or more fields are invalid").WithField(typeErr.Field, "must be a "+typeErr.Type.String())
+	}
+	return InvalidRequest.Wrap(err, "Request body is not valid JSON")
+}
+
+// fieldMessage describes a failed validation rule.
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return fmt.Sprintf("is required when %s is not set", jsonName(fe.Param()))
+	case "eqfield":
+		return "must match " + jsonName(fe.Param())
+	case "email":
+		return "must be a valid email address"
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters long", fe.Param())
+		}
+		return "must be at least " + fe.Param()
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters long", fe.Param())
+		}
+		return "must be at most " + fe.Param()
+	case "len":
+		return fmt.Sprintf("must be exactly %s characters long", fe.Param())
+	case "numeric":
+		return "must contain only digits"
+	case "username":
+		return "must be 3 to 32 letters, digits, dots or underscores, starting with a letter or digit"
+	case "phone":
+		return "must be a phone number in international format, e.g. +998901234567"
+	case "min_age":
+		return fmt.Sprintf("must be a date at least %s years ago", fe.Param())
+	case "user_status":
+		return "must be one of: pending, approved, canceled"
+	}
+	return "is invalid"
+}
+
+// jsonName converts a Go field name used as a validation parameter to the
+// snake_case name it has in request bodies.
+func jsonName(field string) string {
+	var b strings.Builder
+	for i, r := range field {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return strings.ToLower(b.String())
+}
+
+// RegisterJSONFieldNames makes validation errors name fields as they appear in
+// the request (the json, form or uri tag) rather than by their Go name.
+func RegisterJSONFieldNames(v *validator.Validate) {
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		for _, tag := range []string{"json", "form", "uri"} {
+			name := strings.SplitN(f.Tag.Get(tag), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return f.Name
+	})
+}
@@ -0,0 +1,64 @@
+package problem
+
+import "net/http"
+
+// Request and server errors.
+var (
+	InvalidRequest      = Code{"request.invalid", http.StatusBadRequest, "Invalid request"}
+	ValidationFailed    = Code{"request.validation_failed", http.StatusBadRequest, "Validation failed"}
+	InvalidParameter    = Code{"request.invalid_parameter", http.StatusBadRequest, "Invalid parameter"}
+	RouteNotFound       = Code{"route.not_found", http.StatusNotFound, "Not found"}
+	MethodNotAllowed    = Code{"route.method_not_allowed", http.StatusMethodNotAllowed, "Method not allowed"}
+	Internal            = Code{"internal", http.StatusInternalServerError, "Internal server error"}
+	UpstreamUnavailable = Code{"upstream.unavailable", http.StatusBadGateway, "Upstream service unavailable"}
+)
+
+// Authentication and authorization errors.
+var (
+	Unauthenticated        = Code{"auth.unauthenticated", http.StatusUnauthorized, "Authentication required"}
+	InvalidToken           = Code{"auth.invalid_token", http.StatusUnauthorized, "Invalid token"}
+	SessionRevoked         = Code{"auth.session_revoked", http.StatusUnauthorized, "Session revoked"}
+	Forbidden              = Code{"auth.forbidden", http.StatusForbidden, "Forbidden"}
+	InvalidCredentials     = Code{"auth.invalid_credentials", http.StatusUnauthorized, "Invalid credentials"}
+	AccountNotApproved     = Code{"auth.account_not_approved", http.StatusUnauthorized, "Account not approved"}
+	PasswordResetRequired  = Code{"auth.password_reset_required", http.StatusForbidden, "Password reset required"}
+	ImpersonationForbidden = Code{"auth.impersonation_forbidden", http.StatusForbidden, "Impersonation not allowed"}
+	ImpersonationReadOnly  = Code{"auth.impersonation_read_only", http.StatusForbidden, "Impersonated session is read-only"}
+	RecentSignInRequired   = Code{"auth.recent_sign_in_required", http.StatusForbidden, "Recent sign-in required"}
+	LinkInvalid            = Code{"auth.link_invalid", http.StatusUnauthorized, "Link invalid or expired"}
+	ProviderNotFound       = Code{"auth.provider_not_found", http.StatusNotFound, "Sign-in provider not found"}
+	ProviderFailed         = Code{"auth.provider_failed", http.StatusUnauthorized, "Sign-in with provider failed"}
+	OAuthStateInvalid      = Code{"auth.oauth_state_invalid", http.StatusUnauthorized, "Sign-in request invalid or expired"}
+	RedirectNotSupported   = Code{"auth.redirect_not_supported", http.StatusBadRequest, "Provider does not support redirects"}
+	OTPInvalid             = Code{"otp.invalid", http.StatusUnauthorized, "Invalid code"}
+	OTPExpired             = Code{"otp.expired", http.StatusUnauthorized, "Code expired"}
+	OTPCooldown            = Code{"otp.cooldown", http.StatusTooManyRequests, "Code requested too recently"}
+)
+
+// Resource errors.
+var (
+	UserNotFound          = Code{"user.not_found", http.StatusNotFound, "User not found"}
+	EmailTaken            = Code{"user.email_taken", http.StatusConflict, "Email already registered"}
+	PhoneTaken            = Code{"user.phone_taken", http.StatusConflict, "Phone number already registered"}
+	UserConflict          = Code{"user.conflict", http.StatusConflict, "Username or email already in use"}
+	RoleUnchanged         = Code{"user.role_unchanged", http.StatusBadRequest, "Role unchanged"}
+	LastSignInMethod      = Code{"user.last_sign_in_method", http.StatusConflict, "Last sign-in method"}
+	AgeRequirementNotMet  = Code{"user.age_requirement_not_met", http.StatusForbidden, "Age requirement not met"}
+	PhoneInvalid          = Code{"phone.invalid", http.StatusBadRequest, "Invalid phone number"}
+	PhoneNotSet           = Code{"phone.not_set", http.StatusNotFound, "No phone number set"}
+	PhoneChanged          = Code{"phone.changed", http.StatusConflict, "Phone number changed"}
+	IdentityNotFound      = Code{"identity.not_found", http.StatusNotFound, "Linked account not found"}
+	IdentityConflict      = Code{"identity.conflict", http.StatusConflict, "Linked account conflict"}
+	IdentityLinkRequired  = Code{"identity.link_required", http.StatusConflict, "Account must be linked"}
+	InviteNotFound        = Code{"invite.not_found", http.StatusNotFound, "Invite not found"}
+	InviteInvalid         = Code{"invite.invalid", http.StatusGone, "Invite invalid or expired"}
+	InviteNotPending      = Code{"invite.not_pending", http.StatusConflict, "Invite not pending"}
+	InviteRoleForbidden   = Code{"invite.role_forbidden", http.StatusForbidden, "Role cannot be invited"}
+	OrgRequired           = Code{"org.required", http.StatusForbidden, "Organization required"}
+	RoleRequestNotPending = Code{"role_request.not_pending", http.StatusConflict, "Role request not pending"}
+	RoleRequestPending    = Code{"role_request.already_pending", http.StatusConflict, "Role request already pending"}
+	RoleRequestOwn        = Code{"role_request.own", http.StatusForbidden, "Own role request"}
+	ExportNotFound        = Code{"export.not_found", http.StatusNotFound, "Data export not found"}
+	ExportNotReady        = Code{"export.not_ready", http.StatusConflict, "Data export not ready"}
+	DeviceNotFound        = Code{"device.not_found", http.StatusNotFound, "Device not found"}
+)
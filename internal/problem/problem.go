@@ -0,0 +1,127 @@
+// Package problem reports API errors as RFC 7807 problem details
+// (application/problem+json) with stable, machine-readable error codes.
+//
+// Handlers report an error with Abort and return; the error handler
+// middleware writes the response. Clients should match on the code, never on
+// the title or detail, which are meant for humans and may change.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of problem responses.
+const ContentType = "application/problem+json"
+
+// typePrefix turns an error code into the problem type URI.
+const typePrefix = "urn:timecapsule:problem:"
+
+// Code is a stable error code together with the HTTP status and title it is reported with.
+type Code struct {
+	ID     string
+	Status int
+	Title  string
+}
+
+// New returns an error with the code and a human-readable detail.
+func (code Code) New(detail string) *Error {
+	return &Error{Code: code, Detail: detail}
+}
+
+// Newf returns an error with the code and a formatted detail.
+func (code Code) Newf(format string, args ...interface{}) *Error {
+	return &Error{Code: code, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Wrap returns an error with the code and detail caused by err. The cause of
+// a server error is logged when the error is reported but never sent to the client.
+func (code Code) Wrap(err error, detail string) *Error {
+	return &Error{Code: code, Detail: detail, Err: err}
+}
+
+// Error is an API error that is reported as a problem response.
+type Error struct {
+	Code   Code
+	Detail string
+	Fields map[string]string // Per-field validation messages, keyed by field name
+	Err    error             // Internal cause, never sent to the client
+}
+
+func (e *Error) Error() string {
+	msg := e.Code.ID
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithField adds a validation message for a field of the request.
+func (e *Error) WithField(field string, message string) *Error {
+	if e.Fields == nil {
+		e.Fields = map[string]string{}
+	}
+	e.Fields[field] = message
+	return e
+}
+
+// Problem is the body of a problem response.
+type Problem struct {
+	Type     string            `json:"type" example:"urn:timecapsule:problem:user.not_found"`
+	Title    string            `json:"title" example:"User not found"`
+	Status   int               `json:"status" example:"404"`
+	Detail   string            `json:"detail,omitempty" example:"User not found"`
+	Instance string            `json:"instance,omitempty" example:"/users/6f1c7a52-2b1e-4c39-9d1e-3c1f0f8a9b11"`
+	Code     string            `json:"code" example:"user.not_found"`
+	Errors   map[string]string `json:"errors,omitempty"` // Field name to validation message
+}
+
+// Abort records err for the error handler middleware and stops the handler chain.
+func Abort(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
+
+// Write writes err as a problem response. Errors that are not an *Error are
+// reported as internal errors without exposing their message.
+func Write(c *gin.Context, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = Internal.Wrap(err, "")
+	}
+	if e.Code.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(c.Request.Context(), "request failed",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"code", e.Code.ID,
+			"error", e,
+		)
+	}
+
+	body, err := json.Marshal(Problem{
+		Type:     typePrefix + e.Code.ID,
+		Title:    e.Code.Title,
+		Status:   e.Code.Status,
+		Detail:   e.Detail,
+		Instance: c.Request.URL.Path,
+		Code:     e.Code.ID,
+		Errors:   e.Fields,
+	})
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(e.Code.Status, ContentType, body)
+}
@@ -0,0 +1,86 @@
+package purge
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/audit"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/dataexport"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/user"
+)
+
+// batchSize is the number of users purged per transaction.
+const batchSize = 100
+
+// Job periodically purges soft-deleted users once their grace period has passed,
+// and expired personal data exports.
+type Job struct {
+	userRepo   *user.UserRepo
+	exportRepo *dataexport.ExportRepo
+	auditRepo  *audit.AuditRepo
+	cfg        *config.Config
+}
+
+// NewJob creates a new purge Job.
+func NewJob(db *pgxpool.Pool, cfg *config.Config) *Job {
+	return &Job{
+		userRepo:   user.NewUserRepo(db),
+		exportRepo: dataexport.NewExportRepo(db),
+		auditRepo:  audit.NewAuditRepo(db),
+		cfg:        cfg,
+	}
+}
+
+// Run purges deleted users every configured interval until ctx is cancelled.
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(j.cfg.UserPurgeInterval) * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		if err := j.RunOnce(ctx); err != nil {
+			slog.ErrorContext(ctx, "user purge failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce purges every user whose grace period has passed and every expired export.
+func (j *Job) RunOnce(ctx context.Context) error {
+	if _, err := j.exportRepo.DeleteExpiredExports(ctx); err != nil {
+		return err
+	}
+
+	deletedBefore := time.Now().Add(-time.Duration(j.cfg.UserPurgeGracePeriod) * 24 * time.Hour)
+
+	for {
+		purged, err := j.userRepo.PurgeDeletedUsers(ctx, deletedBefore, j.cfg.UserPurgeMode, batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range purged {
+			result := "deleted"
+			if p.Anonymized {
+				result = "anonymized"
+			}
+			j.auditRepo.Record(ctx, &models.AuditEvent{
+				TargetID: p.ID,
+				Action:   audit.ActionUserPurge,
+				Diff:     audit.Details(map[string]interface{}{"result": result}),
+			})
+		}
+
+		if len(purged) < batchSize {
+			return nil
+		}
+	}
+}
@@ -2,13 +2,24 @@ package redis
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/metrics"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/tracing"
 )
 
+// emailOTPScope labels the metrics of the unscoped email OTPs used for
+// registration and password reset.
+const emailOTPScope = "email"
+
+// connectTimeout bounds how long Connect waits for Redis to answer.
+const connectTimeout = 5 * time.Second
+
 // Client represents a Redis client.
 type Client struct {
 	*redis.Client
@@ -21,11 +32,16 @@ func Connect(cfg *config.Config) (*Client, error) {
 		Password: cfg.RedisPassword,
 		DB:       cfg.RedisDB,
 	})
+	// Record a span for every command
+	client.AddHook(tracing.RedisHook{})
 
 	// Test the connection
-	// if _, err := client.Ping(context.Background()).Result(); err != nil {
-	// 	return nil, fmt.Errorf("redis connection failed: %w", err)
-	// }
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	if _, err := client.Ping(ctx).Result(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis connection failed: %w", err)
+	}
 
 	return &Client{client}, nil
 }
@@ -37,19 +53,249 @@ func (c *Client) SaveOTP(ctx context.Context, email string, otp string, expirati
 	if err != nil {
 		return fmt.Errorf("failed to save OTP in Redis: %w", err)
 	}
+	metrics.OTPIssued(emailOTPScope)
 	return nil
 }
 
-// VerifyOTP verifies the OTP code against the one stored in Redis.
+// VerifyOTP verifies the OTP code against the one stored in Redis. It returns
+// ErrOTPExpired if no code is pending.
 func (c *Client) VerifyOTP(ctx context.Context, email string, otp string) (bool, error) {
 	key := fmt.Sprintf("otp:%s", email)
 	storedOTP, err := c.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return false, nil // OTP not found (expired or never set)
+			metrics.OTPChecked(emailOTPScope, false)
+			return false, ErrOTPExpired
 		}
 		return false, fmt.Errorf("failed to get OTP from Redis: %w", err)
 	}
 
+	metrics.OTPChecked(emailOTPScope, storedOTP == otp)
 	return storedOTP == otp, nil
 }
+
+// RevokeSession marks the session as revoked and discards its refresh token.
+// The key only needs to outlive the access tokens issued for the session, so
+// expiration should be the access token lifetime.
+func (c *Client) RevokeSession(ctx context.Context, sessionID string, expiration time.Duration) error {
+	key := fmt.Sprintf("session:revoked:%s", sessionID)
+	if err := c.Set(ctx, key, 1, expiration).Err(); err != nil {
+		return fmt.Errorf("failed to revoke session in Redis: %w", err)
+	}
+	if err := c.Del(ctx, refreshTokenKey(sessionID)).Err(); err != nil {
+		return fmt.Errorf("failed to delete refresh token in Redis: %w", err)
+	}
+	return nil
+}
+
+// IsSessionRevoked reports whether the session has been revoked.
+func (c *Client) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	key := fmt.Sprintf("session:revoked:%s", sessionID)
+	n, err := c.Exists(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check session in Redis: %w", err)
+	}
+	return n > 0, nil
+}
+
+// RevokeUserSessions revokes every session of the user started until now. The
+// key only needs to outlive the access and refresh tokens issued so far, so
+// expiration should be the session lifetime.
+func (c *Client) RevokeUserSessions(ctx context.Context, userID string, expiration time.Duration) error {
+	key := fmt.Sprintf("session:revoked_before:%s", userID)
+	if err := c.Set(ctx, key, time.Now().Unix(), expiration).Err(); err != nil {
+		return fmt.Errorf("failed to revoke sessions in Redis: %w", err)
+	}
+	return nil
+}
+
+// UserSessionsRevokedAt returns the Unix time at which all sessions of the user
+// were last revoked, or 0 if they were not. Tokens issued at or before it are revoked.
+func (c *Client) UserSessionsRevokedAt(ctx context.Context, userID string) (int64, error) {
+	key := fmt.Sprintf("session:revoked_before:%s", userID)
+	revokedAt, err := c.Get(ctx, key).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to check sessions in Redis: %w", err)
+	}
+	return revokedAt, nil
+}
+
+// ErrRefreshTokenNotFound is returned when the session has no refresh token,
+// because it expired, was revoked or never existed.
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+// RefreshToken is the stored refresh token of a session. Only the hash of the
+// token is kept.
+type RefreshToken struct {
+	UserID    string `json:"user_id"`
+	TokenHash string `json:"token_hash"`
+	IssuedAt  int64  `json:"issued_at"` // Unix time
+	AuthTime  int64  `json:"auth_time"` // Unix time the user signed in to the session
+}
+
+// rotateRefreshToken replaces the refresh token of a session only if it is
+// still the one that was presented, so that it can be used once.
+var rotateRefreshToken = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+return 1
+`)
+
+func refreshTokenKey(sessionID string) string {
+	return fmt.Sprintf("session:refresh:%s", sessionID)
+}
+
+// SaveRefreshToken stores the refresh token of a new session.
+func (c *Client) SaveRefreshToken(ctx context.Context, sessionID string, token *RefreshToken, expiration time.Duration) error {
+	value, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if err := c.Set(ctx, refreshTokenKey(sessionID), value, expiration).Err(); err != nil {
+		return fmt.Errorf("failed to save refresh token in Redis: %w", err)
+	}
+	return nil
+}
+
+// GetRefreshToken returns the refresh token of the session, or
+// ErrRefreshTokenNotFound if it has none.
+func (c *Client) GetRefreshToken(ctx context.Context, sessionID string) (*RefreshToken, error) {
+	value, err := c.Get(ctx, refreshTokenKey(sessionID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to get refresh token from Redis: %w", err)
+	}
+
+	var token RefreshToken
+	if err := json.Unmarshal(value, &token); err != nil {
+		return nil, fmt.Errorf("failed to decode refresh token: %w", err)
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken replaces the refresh token of the session with next. It
+// returns ErrRefreshTokenNotFound if current is no longer the session's token,
+// because it was used or revoked in the meantime.
+func (c *Client) RotateRefreshToken(ctx context.Context, sessionID string, current *RefreshToken, next *RefreshToken, expiration time.Duration) error {
+	currentValue, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	nextValue, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+
+	rotated, err := rotateRefreshToken.Run(ctx, c.Client, []string{refreshTokenKey(sessionID)},
+		currentValue, nextValue, expiration.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to rotate refresh token in Redis: %w", err)
+	}
+	if rotated == 0 {
+		return ErrRefreshTokenNotFound
+	}
+	return nil
+}
+
+var (
+	// ErrOTPCooldown is returned when a new OTP is requested too soon after the previous one.
+	ErrOTPCooldown = errors.New("an OTP was sent recently, try again later")
+	// ErrOTPExpired is returned when no OTP is stored, because it expired, was
+	// used up or was never sent.
+	ErrOTPExpired = errors.New("no OTP is pending")
+)
+
+// maxOTPAttempts is how many wrong codes are accepted before a scoped OTP is discarded.
+const maxOTPAttempts = 5
+
+// otpCooldown is the minimum time between two scoped OTPs for the same identifier.
+const otpCooldown = time.Minute
+
+// SaveScopedOTP saves a single-use OTP for the identifier (an email or phone
+// number) within a scope such as phone login, so that codes issued for one
+// purpose cannot be used for another. Requests within otpCooldown of the
+// previous one are refused with ErrOTPCooldown.
+func (c *Client) SaveScopedOTP(ctx context.Context, scope string, identifier string, otp string, expiration time.Duration) error {
+	key := fmt.Sprintf("otp:%s:%s", scope, identifier)
+	ok, err := c.SetNX(ctx, key+":cooldown", 1, otpCooldown).Result()
+	if err != nil {
+		return fmt.Errorf("failed to save OTP in Redis: %w", err)
+	}
+	if !ok {
+		return ErrOTPCooldown
+	}
+
+	pipe := c.TxPipeline()
+	pipe.Set(ctx, key, otp, expiration)
+	pipe.Del(ctx, key+":attempts")
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save OTP in Redis: %w", err)
+	}
+	metrics.OTPIssued(scope)
+	return nil
+}
+
+// consumeOTPScript checks a scoped OTP. A matching code is deleted so it cannot
+// be reused; a wrong code counts as an attempt and the code is deleted once
+// the attempts run out.
+var consumeOTPScript = redis.NewScript(`
+local stored = redis.call("GET", KEYS[1])
+if not stored then
+	return -1
+end
+if stored == ARGV[1] then
+	redis.call("DEL", KEYS[1], KEYS[2])
+	return 1
+end
+local attempts = redis.call("INCR", KEYS[2])
+redis.call("PEXPIRE", KEYS[2], redis.call("PTTL", KEYS[1]))
+if attempts >= tonumber(ARGV[2]) then
+	redis.call("DEL", KEYS[1], KEYS[2])
+end
+return 0
+`)
+
+// ConsumeScopedOTP verifies a scoped OTP and, if it matches, invalidates it.
+// It returns ErrOTPExpired if no code is pending.
+func (c *Client) ConsumeScopedOTP(ctx context.Context, scope string, identifier string, otp string) (bool, error) {
+	key := fmt.Sprintf("otp:%s:%s", scope, identifier)
+	n, err := consumeOTPScript.Run(ctx, c.Client, []string{key, key + ":attempts"}, otp, maxOTPAttempts).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to verify OTP in Redis: %w", err)
+	}
+	metrics.OTPChecked(scope, n == 1)
+	if n < 0 {
+		return false, ErrOTPExpired
+	}
+	return n == 1, nil
+}
+
+// SaveOAuthState stores the data of a social sign-in in progress under its state parameter.
+func (c *Client) SaveOAuthState(ctx context.Context, state string, data string, expiration time.Duration) error {
+	key := fmt.Sprintf("oauth:state:%s", state)
+	if err := c.Set(ctx, key, data, expiration).Err(); err != nil {
+		return fmt.Errorf("failed to save OAuth state in Redis: %w", err)
+	}
+	return nil
+}
+
+// ConsumeOAuthState returns and deletes the data stored for the state, so each
+// provider response is accepted once. It returns "" for an unknown or expired state.
+func (c *Client) ConsumeOAuthState(ctx context.Context, state string) (string, error) {
+	key := fmt.Sprintf("oauth:state:%s", state)
+	data, err := c.GetDel(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get OAuth state from Redis: %w", err)
+	}
+	return data, nil
+}
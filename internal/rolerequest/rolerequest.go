@@ -0,0 +1,187 @@
+package rolerequest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+)
+
+var (
+	// ErrPendingRequestExists is returned when the user already has a role request awaiting review.
+	ErrPendingRequestExists = errors.New("user already has a pending role request")
+	// ErrRequestNotPending is returned when reviewing a request that was already approved or rejected.
+	ErrRequestNotPending = errors.New("role request is no longer pending")
+	// ErrOwnRequest is returned when a user reviews their own role request.
+	ErrOwnRequest = errors.New("users cannot review their own role request")
+)
+
+// RoleRequestRepo is the repository for interacting with role request data.
+type RoleRequestRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewRoleRequestRepo creates a new RoleRequestRepo.
+func NewRoleRequestRepo(db *pgxpool.Pool) *RoleRequestRepo {
+	return &RoleRequestRepo{
+		db: db,
+	}
+}
+
+const roleRequestColumns = `
+	id, user_id, requested_role, COALESCE(reason, ''), status, reviewed_by, review_note,
+	reviewed_at, created_at, updated_at
+`
+
+func scanRoleRequest(row pgx.Row) (*models.RoleRequest, error) {
+	var req models.RoleRequest
+	err := row.Scan(
+		&req.ID,
+		&req.UserID,
+		&req.RequestedRole,
+		&req.Reason,
+		&req.Status,
+		&req.ReviewedBy,
+		&req.ReviewNote,
+		&req.ReviewedAt,
+		&req.CreatedAt,
+		&req.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// CreateRoleRequest creates a new pending role request.
+func (r *RoleRequestRepo) CreateRoleRequest(ctx context.Context, req *models.RoleRequest) error {
+	req.ID = uuid.New().String()
+	query := `
+		INSERT INTO role_requests (id, user_id, requested_role, reason, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		ON CONFLICT (user_id) WHERE status = 'pending' DO NOTHING
+		RETURNING status, created_at, updated_at
+	`
+
+	err := r.db.QueryRow(ctx, query,
+		req.ID,
+		req.UserID,
+		req.RequestedRole,
+		req.Reason,
+	).Scan(&req.Status, &req.CreatedAt, &req.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrPendingRequestExists
+		}
+		return fmt.Errorf("failed to create role request: %w", err)
+	}
+
+	return nil
+}
+
+// GetRoleRequestByID retrieves a role request by its ID.
+func (r *RoleRequestRepo) GetRoleRequestByID(ctx context.Context, requestID uuid.UUID) (*models.RoleRequest, error) {
+	query := `SELECT ` + roleRequestColumns + ` FROM role_requests WHERE id = $1`
+
+	req, err := scanRoleRequest(r.db.QueryRow(ctx, query, requestID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role request by ID: %w", err)
+	}
+
+	return req, nil
+}
+
+// GetAllRoleRequests retrieves role requests matching the given filter, newest first.
+func (r *RoleRequestRepo) GetAllRoleRequests(ctx context.Context, filter models.GetAllRoleRequests) ([]*models.RoleRequest, error) {
+	var (
+		requests []*models.RoleRequest
+		args     []interface{}
+	)
+	query := `SELECT ` + roleRequestColumns + ` FROM role_requests WHERE 1 = 1`
+
+	if filter.UserID != "" {
+		args = append(args, filter.UserID)
+		query += fmt.Sprintf(" AND user_id = $%d", len(args))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role requests: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		req, err := scanRoleRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan role request row: %w", err)
+		}
+		requests = append(requests, req)
+	}
+
+	return requests, nil
+}
+
+// ReviewRoleRequest approves or rejects a pending role request. On approval the
+// requested role is applied to the user in the same transaction and the role the
+// user held before is returned. Nobody can review their own request.
+func (r *RoleRequestRepo) ReviewRoleRequest(ctx context.Context, requestID uuid.UUID, reviewerID string, approve bool, note string) (*models.RoleRequest, string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	status := "rejected"
+	if approve {
+		status = "approved"
+	}
+
+	query := `
+		UPDATE role_requests
+		SET status = $1, reviewed_by = $2, review_note = NULLIF($3, ''), reviewed_at = NOW(), updated_at = NOW()
+		WHERE id = $4 AND status = 'pending'
+		RETURNING ` + roleRequestColumns
+
+	req, err := scanRoleRequest(tx.QueryRow(ctx, query, status, reviewerID, note, requestID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", ErrRequestNotPending
+		}
+		return nil, "", fmt.Errorf("failed to review role request: %w", err)
+	}
+	if req.UserID == reviewerID {
+		return nil, "", ErrOwnRequest
+	}
+
+	var previousRole string
+	if approve {
+		query = `SELECT role FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, req.UserID).Scan(&previousRole); err != nil {
+			return nil, "", fmt.Errorf("failed to get user role: %w", err)
+		}
+
+		query = `
+			UPDATE users
+			SET role = $1, role_self_assigned = FALSE, updated_at = NOW()
+			WHERE id = $2
+		`
+		if _, err := tx.Exec(ctx, query, req.RequestedRole, req.UserID); err != nil {
+			return nil, "", fmt.Errorf("failed to update user role: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, "", fmt.Errorf("failed to commit role request review: %w", err)
+	}
+
+	return req, previousRole, nil
+}
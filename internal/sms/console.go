@@ -0,0 +1,63 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ConsoleSender writes messages to a writer instead of delivering them. It is
+// meant for local development.
+type ConsoleSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewConsoleSender creates a ConsoleSender writing to w, or to stdout if w is nil.
+func NewConsoleSender(w io.Writer) *ConsoleSender {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &ConsoleSender{w: w}
+}
+
+// Send writes the message.
+func (s *ConsoleSender) Send(ctx context.Context, to string, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.w, "[sms] %s to=%s message=%q\n", time.Now().UTC().Format(time.RFC3339), to, message)
+	if err != nil {
+		return fmt.Errorf("failed to write SMS: %w", err)
+	}
+	return nil
+}
+
+// FileSender appends messages to a file instead of delivering them, so that
+// local tooling can pick up the codes.
+type FileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileSender creates a FileSender appending to the file at path.
+func NewFileSender(path string) *FileSender {
+	return &FileSender{path: path}
+}
+
+// Send appends the message to the file.
+func (s *FileSender) Send(ctx context.Context, to string, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open SMS file: %w", err)
+	}
+	defer f.Close()
+
+	return (&ConsoleSender{w: f}).Send(ctx, to, message)
+}
@@ -0,0 +1,69 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPSender delivers messages by posting them as JSON to an SMS provider
+// endpoint, or to a local stub during development:
+//
+//	POST <url>
+//	Authorization: Bearer <token>
+//	{"from": "...", "to": "+998901234567", "message": "..."}
+//
+// Any 2xx response counts as accepted.
+type HTTPSender struct {
+	url    string
+	token  string
+	from   string
+	client *http.Client
+}
+
+// NewHTTPSender creates an HTTPSender. The token and sender name are optional.
+func NewHTTPSender(url string, token string, from string) *HTTPSender {
+	return &HTTPSender{
+		url:    url,
+		token:  token,
+		from:   from,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send posts the message to the provider.
+func (s *HTTPSender) Send(ctx context.Context, to string, message string) error {
+	body, err := json.Marshal(map[string]string{
+		"from":    s.from,
+		"to":      to,
+		"message": message,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode SMS: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create SMS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send SMS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("SMS provider returned %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	return nil
+}
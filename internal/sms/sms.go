@@ -0,0 +1,45 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+)
+
+// SMS drivers.
+const (
+	DriverConsole = "console"
+	DriverFile    = "file"
+	DriverHTTP    = "http"
+)
+
+// SMSSender delivers text messages to E.164 phone numbers.
+type SMSSender interface {
+	Send(ctx context.Context, to string, message string) error
+}
+
+// NewSender creates the sender selected by cfg.SMSDriver.
+func NewSender(cfg *config.Config) (SMSSender, error) {
+	switch cfg.SMSDriver {
+	case DriverConsole, "":
+		return NewConsoleSender(nil), nil
+	case DriverFile:
+		if cfg.SMSFilePath == "" {
+			return nil, fmt.Errorf("SMS_FILE_PATH is required for the %s SMS driver", DriverFile)
+		}
+		return NewFileSender(cfg.SMSFilePath), nil
+	case DriverHTTP:
+		if cfg.SMSHTTPURL == "" {
+			return nil, fmt.Errorf("SMS_HTTP_URL is required for the %s SMS driver", DriverHTTP)
+		}
+		return NewHTTPSender(cfg.SMSHTTPURL, cfg.SMSHTTPToken, cfg.SMSFrom), nil
+	default:
+		return nil, fmt.Errorf("unknown SMS driver %q", cfg.SMSDriver)
+	}
+}
+
+// SendOTP sends a one-time code to the phone number.
+func SendOTP(ctx context.Context, sender SMSSender, to string, otp string) error {
+	return sender.Send(ctx, to, fmt.Sprintf("Your verification code is %s. Do not share it with anyone.", otp))
+}
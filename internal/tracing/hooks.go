@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PGXTracer records a span for every database query. Statements are recorded
+// as written; argument values are not, as they may hold personal data.
+type PGXTracer struct{}
+
+func (PGXTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	operation := sqlOperation(data.SQL)
+	ctx, _ = Start(ctx, "postgres "+operation,
+		semconv.DBSystemPostgreSQL,
+		semconv.DBNamespace(conn.Config().Database),
+		semconv.DBOperationName(operation),
+		semconv.DBQueryText(data.SQL),
+	)
+	return ctx
+}
+
+func (PGXTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	End(span, data.Err)
+}
+
+// sqlOperation returns the first keyword of a statement, such as SELECT.
+func sqlOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// RedisHook records a span for every Redis command and pipeline. Only command
+// names are recorded, never arguments, which include OTPs.
+type RedisHook struct{}
+
+func (RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, _ = Start(ctx, "redis "+cmd.Name(),
+		semconv.DBSystemRedis,
+		semconv.DBOperationName(cmd.Name()),
+	)
+	return ctx, nil
+}
+
+func (RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	End(trace.SpanFromContext(ctx), redisError(cmd.Err()))
+	return nil
+}
+
+func (RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name()
+	}
+	ctx, _ = Start(ctx, "redis pipeline",
+		semconv.DBSystemRedis,
+		semconv.DBOperationName(strings.Join(names, " ")),
+		attribute.Int("db.operation.batch.size", len(cmds)),
+	)
+	return ctx, nil
+}
+
+func (RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if err = redisError(cmd.Err()); err != nil {
+			break
+		}
+	}
+	End(trace.SpanFromContext(ctx), err)
+	return nil
+}
+
+// redisError drops redis.Nil, which only means the key does not exist.
+func redisError(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package user
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded or
+// was issued for a different sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// sortColumns maps the supported sort fields to their columns. Phone-only
+// users have no email; it sorts and compares as empty, as it is read back,
+// since NULLs would fall out of the keyset comparison.
+var sortColumns = map[string]string{
+	models.SortByCreatedAt: "created_at",
+	models.SortByUsername:  "username",
+	models.SortByEmail:     "COALESCE(email, '')",
+}
+
+// cursor is the position after the last user of a page. It is opaque to
+// clients and only valid for the sort it was issued for.
+type cursor struct {
+	SortBy    string `json:"s"`
+	SortOrder string `json:"o"`
+	Value     string `json:"v"`
+	ID        string `json:"id"`
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, err
+	}
+	if c.ID == "" {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// escapeLike escapes the LIKE wildcards in a substring filter.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
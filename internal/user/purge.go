@@ -0,0 +1,182 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// foreignKeyViolation is the PostgreSQL error code for foreign key violations.
+const foreignKeyViolation = "23503"
+
+// Purge modes for soft-deleted users whose grace period has passed.
+const (
+	PurgeModeAnonymize = "anonymize"
+	PurgeModeDelete    = "delete"
+)
+
+// PurgedUser reports what happened to a user during a purge.
+type PurgedUser struct {
+	ID         string
+	Anonymized bool // False if the row was deleted
+}
+
+// PurgeDeletedUsers removes up to limit users deleted before the given time. In
+// delete mode a user still referenced by other rows (for example invites they
+// sent) is anonymized instead. Rows locked by a concurrent purge are skipped.
+func (r *UserRepo) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, mode string, limit int) ([]PurgedUser, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		SELECT id FROM users
+		WHERE deleted_at < $1 AND purged_at IS NULL
+		ORDER BY deleted_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`
+	rows, err := tx.Query(ctx, query, deletedBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted users: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted users: %w", err)
+	}
+
+	purged := make([]PurgedUser, 0, len(ids))
+	for _, id := range ids {
+		if mode == PurgeModeDelete {
+			deleted, err := deleteReferencedUser(ctx, tx, id)
+			if err != nil {
+				return nil, err
+			}
+			if deleted {
+				purged = append(purged, PurgedUser{ID: id})
+				continue
+			}
+		}
+		if err := anonymizeUser(ctx, tx, id); err != nil {
+			return nil, err
+		}
+		purged = append(purged, PurgedUser{ID: id, Anonymized: true})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit purge: %w", err)
+	}
+
+	return purged, nil
+}
+
+// deleteReferencedUser deletes the user inside a savepoint and reports false,
+// leaving the row in place, if other rows still reference it.
+func deleteReferencedUser(ctx context.Context, tx pgx.Tx, userID string) (bool, error) {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin savepoint: %w", err)
+	}
+	defer sp.Rollback(ctx)
+
+	if _, err := sp.Exec(ctx, `DELETE FROM users WHERE id = $1`, userID); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	if err := sp.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to release savepoint: %w", err)
+	}
+	return true, nil
+}
+
+// anonymizeUser replaces the personal data of a user in place, keeping the ID so
+// that references held elsewhere stay valid. Data tied to the user in other
+// tables (devices, exports, linked identities, invites to their email, role
+// request reasons) is removed or anonymized as well.
+func anonymizeUser(ctx context.Context, tx pgx.Tx, userID string) error {
+	query := `
+		UPDATE invites
+		SET email = 'deleted+' || $1::text || '@invalid', updated_at = NOW()
+		WHERE accepted_user_id = $1 OR email = (SELECT email FROM users WHERE id = $1)
+	`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to anonymize user invites: %w", err)
+	}
+
+	query = `
+		UPDATE users
+		SET username = 'deleted_' || replace(id::text, '-', ''),
+			email = 'deleted+' || id::text || '@invalid',
+			email_verified_at = NULL,
+			phone = NULL,
+			phone_verified_at = NULL,
+			password_hash = '!',
+			full_name = NULL,
+			date_of_birth = NULL,
+			age_verified_at = NULL,
+			purged_at = NOW(),
+			updated_at = NOW()
+		WHERE id = $1
+	`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to anonymize user: %w", err)
+	}
+
+	query = `UPDATE role_requests SET reason = NULL WHERE user_id = $1`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to anonymize user role requests: %w", err)
+	}
+
+	for _, table := range []string{"known_devices", "data_exports", "user_identities"} {
+		if _, err := tx.Exec(ctx, `DELETE FROM `+table+` WHERE user_id = $1`, userID); err != nil {
+			return fmt.Errorf("failed to delete user %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// EraseUser anonymizes a user right away instead of waiting for the purge job.
+// The account is deleted and can no longer be restored. The audit log is
+// append-only and is left untouched.
+func (r *UserRepo) EraseUser(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE users
+		SET deleted_at = COALESCE(deleted_at, NOW())
+		WHERE id = $1 AND purged_at IS NULL
+	`
+	tag, err := tx.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	if err := anonymizeUser(ctx, tx, userID.String()); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit erasure: %w", err)
+	}
+
+	return nil
+}
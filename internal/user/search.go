@@ -0,0 +1,127 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+)
+
+// SearchUsers finds users whose username, full name, email or phone resemble the query,
+// best matches first. Similarity uses the pg_trgm indexes; plain substring matches
+// are included as well so that short queries still find something.
+func (r *UserRepo) SearchUsers(ctx context.Context, q string, limit int) ([]*models.UserSearchResult, error) {
+	results := []*models.UserSearchResult{}
+	query := `
+		SELECT ` + userColumns + `,
+			GREATEST(
+				similarity(username, $1),
+				similarity(COALESCE(full_name, ''), $1),
+				similarity(COALESCE(email, ''), $1),
+				similarity(COALESCE(phone, ''), $1)
+			) AS score
+		FROM users
+		WHERE deleted_at IS NULL AND (
+			username % $1 OR full_name % $1 OR email % $1 OR phone % $1
+			OR username ILIKE $2 ESCAPE '\' OR full_name ILIKE $2 ESCAPE '\' OR email ILIKE $2 ESCAPE '\'
+			OR phone ILIKE $2 ESCAPE '\'
+		)
+		ORDER BY score DESC, id
+		LIMIT $3
+	`
+
+	rows, err := r.db.Query(ctx, query, q, "%"+escapeLike(q)+"%", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var score float64
+		user, err := scanUser(rows, &score)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		results = append(results, &models.UserSearchResult{
+			User:  user,
+			Score: score,
+			Highlights: highlightFields(q, map[string]string{
+				"username":  user.Username,
+				"full_name": user.FullName,
+				"email":     user.Email,
+				"phone":     derefString(user.Phone),
+			}),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+
+	return results, nil
+}
+
+// highlightFields returns the fields containing the query, or any of its words,
+// with each occurrence wrapped in <mark> tags. Fields without a match are omitted.
+func highlightFields(q string, fields map[string]string) map[string]string {
+	terms := strings.Fields(q)
+	if len(terms) > 1 {
+		terms = append([]string{strings.Join(terms, " ")}, terms...)
+	}
+
+	highlights := map[string]string{}
+	for name, value := range fields {
+		if h, ok := highlight(value, terms); ok {
+			highlights[name] = h
+		}
+	}
+	return highlights
+}
+
+// highlight marks the case-insensitive occurrences of terms in s, preferring the
+// earliest and then the longest term at each position.
+func highlight(s string, terms []string) (string, bool) {
+	lower := strings.ToLower(s)
+	if len(lower) != len(s) {
+		// Lowercasing changed byte lengths, so offsets in lower do not map back to s.
+		return "", false
+	}
+	var (
+		b       strings.Builder
+		matched bool
+		last    int
+	)
+	for i := 0; i < len(s); {
+		end := -1
+		for _, term := range terms {
+			t := strings.ToLower(term)
+			if strings.HasPrefix(lower[i:], t) && i+len(t) > end {
+				end = i + len(t)
+			}
+		}
+		if end > i {
+			b.WriteString(html.EscapeString(s[last:i]))
+			b.WriteString("<mark>")
+			b.WriteString(html.EscapeString(s[i:end]))
+			b.WriteString("</mark>")
+			i, last, matched = end, end, true
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	if !matched {
+		return "", false
+	}
+	b.WriteString(html.EscapeString(s[last:]))
+	return b.String(), true
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
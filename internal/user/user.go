@@ -2,13 +2,35 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
 )
 
+var (
+	// ErrUserNotFound is returned when restoring a user that is not deleted,
+	// erasing one that was already purged, or updating one that does not exist.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserConflict is returned when creating a user, or restoring one, whose
+	// username, email or phone is taken by another account.
+	ErrUserConflict = errors.New("username or email is already in use")
+	// ErrPhoneTaken is returned when verifying a phone number that another
+	// account has already verified.
+	ErrPhoneTaken = errors.New("phone number is already in use")
+	// ErrPhoneMismatch is returned when verifying a phone number that is no
+	// longer the one set on the account.
+	ErrPhoneMismatch = errors.New("phone number has changed")
+)
+
+// uniqueViolation is the PostgreSQL error code for unique constraint violations.
+const uniqueViolation = "23505"
+
 // UserRepo is the repository for interacting with user data.
 type UserRepo struct {
 	db *pgxpool.Pool
@@ -25,134 +47,288 @@ func NewUserRepo(db *pgxpool.Pool) *UserRepo {
 func (r *UserRepo) CreateUser(ctx context.Context, user *models.User) error {
 	user.ID = uuid.New().String()
 	query := `
-		INSERT INTO users (id, username, email, password_hash, full_name, date_of_birth, role, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+		INSERT INTO users (id, username, email, phone, password_hash, full_name, date_of_birth, role, org_id, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, $9, NOW(), NOW())
 	`
 
 	_, err := r.db.Exec(ctx, query,
 		user.ID,
 		user.Username,
 		user.Email,
+		user.Phone,
 		user.PasswordHash,
 		user.FullName,
 		user.DateOfBirth,
 		user.Role,
+		user.OrgID,
 	)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrUserConflict
+		}
 		return fmt.Errorf("failed to create user: %w", err)
 	}
 
 	return nil
 }
 
-// GetUserByID retrieves a user by their ID.
-func (r *UserRepo) GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error) {
-	var user models.User
+// CreateVerifiedUser creates an approved user whose email and phone, if given,
+// count as verified. It is used for accounts an operator vouches for, such as
+// the first admin.
+func (r *UserRepo) CreateVerifiedUser(ctx context.Context, user *models.User) error {
+	user.ID = uuid.New().String()
+	user.Status = models.UserStatusApproved
+
+	// Accounts created without a date of birth store none, as anonymized ones do.
+	var dateOfBirth *time.Time
+	if !user.DateOfBirth.IsZero() {
+		dateOfBirth = &user.DateOfBirth
+	}
+
 	query := `
-		SELECT id, username, email, password_hash, full_name, date_of_birth, satus, role, created_at, updated_at
-		FROM users
-		WHERE id = $1
+		INSERT INTO users (id, username, email, email_verified_at, phone, phone_verified_at, password_hash, full_name, date_of_birth, status, role, org_id, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), CASE WHEN $3 <> '' THEN NOW() END, $4::text, CASE WHEN $4::text IS NOT NULL THEN NOW() END, $5, $6, $7, $8, $9, $10, NOW(), NOW())
 	`
 
-	err := r.db.QueryRow(ctx, query, userID).Scan(
+	_, err := r.db.Exec(ctx, query,
+		user.ID,
+		user.Username,
+		user.Email,
+		user.Phone,
+		user.PasswordHash,
+		user.FullName,
+		dateOfBirth,
+		user.Status,
+		user.Role,
+		user.OrgID,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrUserConflict
+		}
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return nil
+}
+
+// userColumns selects a user. Phone-only users have no email and anonymized
+// users have no full name or date of birth, which are read back as zero values.
+const userColumns = `
+	id, username, COALESCE(email, ''), email_verified_at, phone, phone_verified_at, password_hash,
+	COALESCE(full_name, ''), COALESCE(date_of_birth, '0001-01-01'), age_verified_at,
+	status, role, org_id, role_self_assigned, password_reset_required, created_at, updated_at, deleted_at
+`
+
+// scanUser scans a row selected with userColumns. Any extra destinations are
+// scanned from the columns that follow.
+func scanUser(row pgx.Row, extra ...interface{}) (*models.User, error) {
+	var user models.User
+	dest := []interface{}{
 		&user.ID,
 		&user.Username,
 		&user.Email,
+		&user.EmailVerifiedAt,
+		&user.Phone,
+		&user.PhoneVerifiedAt,
 		&user.PasswordHash,
 		&user.FullName,
 		&user.DateOfBirth,
+		&user.AgeVerifiedAt,
 		&user.Status,
 		&user.Role,
+		&user.OrgID,
+		&user.RoleSelfAssigned,
+		&user.PasswordResetRequired,
 		&user.CreatedAt,
 		&user.UpdatedAt,
-	)
+		&user.DeletedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	user.AgeVerified = user.AgeVerifiedAt != nil
+	return &user, nil
+}
+
+// GetUserByID retrieves a user by their ID. Deleted users are not found.
+func (r *UserRepo) GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1 AND deleted_at IS NULL`
+
+	user, err := scanUser(r.db.QueryRow(ctx, query, userID))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user by ID: %w", err)
 	}
 
-	return &user, nil
+	return user, nil
 }
 
-// GetUserByEmail retrieves a user by their email address.
+// GetUsersByIDs retrieves the users with the given IDs in no particular order.
+// Users that do not exist or are deleted are left out.
+func (r *UserRepo) GetUsersByIDs(ctx context.Context, userIDs []uuid.UUID) ([]*models.User, error) {
+	users := []*models.User{}
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ANY($1) AND deleted_at IS NULL`
+
+	rows, err := r.db.Query(ctx, query, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users by ID: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get users by ID: %w", err)
+	}
+
+	return users, nil
+}
+
+// GetUserByEmail retrieves a user by their email address. Deleted users are not found.
 func (r *UserRepo) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	var user models.User
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1 AND deleted_at IS NULL`
+
+	user, err := scanUser(r.db.QueryRow(ctx, query, email))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
+	}
+
+	return user, nil
+}
+
+// GetUserByPhone retrieves the user who verified the phone number. Deleted
+// users and unverified numbers are not found.
+func (r *UserRepo) GetUserByPhone(ctx context.Context, phone string) (*models.User, error) {
 	query := `
-		SELECT id, username, email, password_hash, full_name, date_of_birth, satatus, role, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
-		WHERE email = $1
+		WHERE phone = $1 AND phone_verified_at IS NOT NULL AND deleted_at IS NULL
 	`
 
-	err := r.db.QueryRow(ctx, query, email).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash,
-		&user.FullName,
-		&user.DateOfBirth,
-		&user.Status,
-		&user.Role,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := scanUser(r.db.QueryRow(ctx, query, phone))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user by email: %w", err)
+		return nil, fmt.Errorf("failed to get user by phone: %w", err)
 	}
 
-	return &user, nil
+	return user, nil
+}
+
+// GetPendingUserByPhone retrieves the most recent registration with the phone
+// number that has not been verified yet.
+func (r *UserRepo) GetPendingUserByPhone(ctx context.Context, phone string) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE phone = $1 AND phone_verified_at IS NULL AND deleted_at IS NULL
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	user, err := scanUser(r.db.QueryRow(ctx, query, phone))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by phone: %w", err)
+	}
+
+	return user, nil
 }
 
-// GetAllUsers retrieves all users from the database.
-func (r *UserRepo) GetAllUsers(ctx context.Context, userReq models.GetAllUsers) ([]*models.User, error) {
+// GetAllUsers retrieves one page of users matching the filter, using keyset
+// pagination on the sort column with the user ID as tie-breaker.
+func (r *UserRepo) GetAllUsers(ctx context.Context, userReq models.GetAllUsers) (*models.UserList, error) {
 	var (
-		users  []*models.User
 		filter string
 		args   []interface{}
-		count  int
 	)
-	query := `
-		SELECT 
-			id, 
-			username, 
-			email, 
-			password_hash, 
-			full_name,
-			date_of_birth, 
-			status,
-			role, 
-			created_at, 
-			updated_at
-		FROM 
-			users
-		WHERE
-			1 = 1
-	`
-	filter = ""
-	if userReq.Email != "" {
-		filter += fmt.Sprintf(" AND email ILIKE $%d", count)
-		count++
-		args = append(args, "%"+userReq.Email+"%")
+	addFilter := func(condition string, value interface{}) {
+		args = append(args, value)
+		filter += fmt.Sprintf(" AND "+condition, len(args))
 	}
-	if userReq.FullName != "" {
-		filter += fmt.Sprintf(" AND full_name ILIKE $%d", count)
-		count++
-		args = append(args, "%"+userReq.FullName+"%")
+	addTextFilter := func(column string, value string) {
+		if value == "" {
+			return
+		}
+		if userReq.Match == models.MatchExact {
+			addFilter(column+" = $%d", value)
+			return
+		}
+		addFilter(column+` ILIKE $%d ESCAPE '\'`, "%"+escapeLike(value)+"%")
 	}
+
+	addTextFilter("email", userReq.Email)
+	addTextFilter("full_name", userReq.FullName)
+	addTextFilter("username", userReq.Username)
 	if userReq.Role != "" {
-		filter += fmt.Sprintf(" AND role ILIKE $%d", count)
-		count++
-		args = append(args, "%"+userReq.Role+"%")
+		addFilter("role = $%d", userReq.Role)
 	}
 	if userReq.Status != "" {
-		filter += fmt.Sprintf(" AND status ILIKE $%d", count)
-		count++
-		args = append(args, "%"+userReq.Status+"%")
+		addFilter("status = $%d", userReq.Status)
+	}
+	if userReq.SelfAssigned != nil {
+		addFilter("role_self_assigned = $%d", *userReq.SelfAssigned)
+	}
+	if userReq.CreatedFrom != nil {
+		addFilter("created_at >= $%d", *userReq.CreatedFrom)
+	}
+	if userReq.CreatedTo != nil {
+		addFilter("created_at < $%d", *userReq.CreatedTo)
 	}
-	if userReq.Username != "" {
-		filter += fmt.Sprintf(" AND username ILIKE $%d", count)
-		count++
-		args = append(args, "%"+userReq.Username+"%")
+	switch userReq.Deleted {
+	case models.DeletedOnly:
+		filter += " AND deleted_at IS NOT NULL"
+	case models.DeletedInclude:
+	default:
+		filter += " AND deleted_at IS NULL"
 	}
-	query += filter
+
+	list := &models.UserList{Items: []*models.User{}}
+
+	if userReq.IncludeTotal {
+		var total int64
+		countQuery := `SELECT COUNT(*) FROM users WHERE 1 = 1` + filter
+		if err := r.db.QueryRow(ctx, countQuery, args...).Scan(&total); err != nil {
+			return nil, fmt.Errorf("failed to count users: %w", err)
+		}
+		list.TotalCount = &total
+	}
+
+	// sortColumns is a whitelist, the column name is never taken from the request.
+	sortColumn, ok := sortColumns[userReq.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort field %q", userReq.SortBy)
+	}
+	direction, comparison := "ASC", ">"
+	if userReq.SortOrder == models.SortDesc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if userReq.Cursor != "" {
+		cur, err := decodeCursor(userReq.Cursor)
+		if err != nil || cur.SortBy != userReq.SortBy || cur.SortOrder != userReq.SortOrder {
+			return nil, ErrInvalidCursor
+		}
+		var value interface{} = cur.Value
+		if userReq.SortBy == models.SortByCreatedAt {
+			createdAt, err := time.Parse(time.RFC3339Nano, cur.Value)
+			if err != nil {
+				return nil, ErrInvalidCursor
+			}
+			value = createdAt
+		}
+		args = append(args, value, cur.ID)
+		filter += fmt.Sprintf(" AND (%s, id) %s ($%d, $%d)", sortColumn, comparison, len(args)-1, len(args))
+	}
+
+	args = append(args, userReq.Limit+1)
+	query := `SELECT ` + userColumns + ` FROM users WHERE 1 = 1` + filter +
+		fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT $%d", sortColumn, direction, direction, len(args))
+
 	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all users: %w", err)
@@ -160,34 +336,44 @@ func (r *UserRepo) GetAllUsers(ctx context.Context, userReq models.GetAllUsers)
 	defer rows.Close()
 
 	for rows.Next() {
-		var user models.User
-		err := rows.Scan(
-			&user.ID,
-			&user.Username,
-			&user.Email,
-			&user.PasswordHash,
-			&user.FullName,
-			&user.DateOfBirth,
-			&user.Role,
-			&user.Status,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-		)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user row: %w", err)
 		}
-		users = append(users, &user)
+		list.Items = append(list.Items, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get all users: %w", err)
 	}
 
-	return users, nil
+	if len(list.Items) > userReq.Limit {
+		list.Items = list.Items[:userReq.Limit]
+		last := list.Items[len(list.Items)-1]
+		cur := cursor{SortBy: userReq.SortBy, SortOrder: userReq.SortOrder, ID: last.ID}
+		switch userReq.SortBy {
+		case models.SortByUsername:
+			cur.Value = last.Username
+		case models.SortByEmail:
+			cur.Value = last.Email
+		default:
+			cur.Value = last.CreatedAt.UTC().Format(time.RFC3339Nano)
+		}
+		list.NextCursor = encodeCursor(cur)
+	}
+
+	return list, nil
 }
 
-// UpdateUser updates an existing user in the database.
+// UpdateUser updates an existing user in the database. Changing the date of
+// birth clears its verification. It returns ErrUserConflict if the username is
+// taken by another account.
 func (r *UserRepo) UpdateUser(ctx context.Context, user *models.UserUpdate) error {
 	query := `
 		UPDATE users
-		SET username = $1, full_name = $2, date_of_birth = $3, updated_at = NOW()
-		WHERE id = $4
+		SET username = $1, full_name = $2, date_of_birth = $3,
+			age_verified_at = CASE WHEN date_of_birth = $3::date THEN age_verified_at END,
+			updated_at = NOW()
+		WHERE id = $4 AND deleted_at IS NULL
 	`
 
 	_, err := r.db.Exec(ctx, query,
@@ -197,17 +383,23 @@ func (r *UserRepo) UpdateUser(ctx context.Context, user *models.UserUpdate) erro
 		user.ID,
 	)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrUserConflict
+		}
 		return fmt.Errorf("failed to update user: %w", err)
 	}
 
 	return nil
 }
 
-// DeleteUser deletes a user from the database by their ID.
+// DeleteUser soft-deletes a user. The row is kept until the purge job removes or
+// anonymizes it after the grace period, and can be restored until then.
 func (r *UserRepo) DeleteUser(ctx context.Context, userID uuid.UUID) error {
 	query := `
-		DELETE FROM users
-		WHERE id = $1
+		UPDATE users
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	_, err := r.db.Exec(ctx, query, userID)
@@ -218,12 +410,15 @@ func (r *UserRepo) DeleteUser(ctx context.Context, userID uuid.UUID) error {
 	return nil
 }
 
-// UpdateUser updates an existing user in the database.
+// UpdateUserPassword sets a new password hash and clears any pending forced reset.
+// It is only called after the user confirmed a code sent to the email, so the
+// email is marked verified as well.
 func (r *UserRepo) UpdateUserPassword(ctx context.Context, user *models.UserUpdatePass) error {
 	query := `
 		UPDATE users
-		SET password_hash = $1, updated_at = NOW()
-		WHERE email = $2
+		SET password_hash = $1, password_reset_required = FALSE,
+			email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		WHERE email = $2 AND deleted_at IS NULL
 	`
 
 	_, err := r.db.Exec(ctx, query,
@@ -237,12 +432,12 @@ func (r *UserRepo) UpdateUserPassword(ctx context.Context, user *models.UserUpda
 	return nil
 }
 
-// UpdateUser updates an existing user in the database.
+// UpdateUserStatus sets the status of the user with the given email.
 func (r *UserRepo) UpdateUserStatus(ctx context.Context, user *models.UserUpdateStatus) error {
 	query := `
 		UPDATE users
 		SET status = $1, updated_at = NOW()
-		WHERE email = $2
+		WHERE email = $2 AND deleted_at IS NULL
 	`
 
 	_, err := r.db.Exec(ctx, query,
@@ -255,3 +450,179 @@ func (r *UserRepo) UpdateUserStatus(ctx context.Context, user *models.UserUpdate
 
 	return nil
 }
+
+// UpdateUserStatusByID sets the status of the user. It returns ErrUserNotFound
+// if the user does not exist.
+func (r *UserRepo) UpdateUserStatusByID(ctx context.Context, userID string, status string) error {
+	query := `
+		UPDATE users
+		SET status = $1, updated_at = NOW()
+		WHERE id = $2 AND deleted_at IS NULL
+	`
+
+	tag, err := r.db.Exec(ctx, query, status, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update user status: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// SetUserRole assigns a role to the user as an admin would approve it, and
+// returns the previous role. It returns ErrUserNotFound if the user does not exist.
+func (r *UserRepo) SetUserRole(ctx context.Context, userID string, role string) (string, error) {
+	query := `
+		UPDATE users AS u
+		SET role = $1, role_self_assigned = FALSE, updated_at = NOW()
+		FROM (SELECT id, role FROM users WHERE id = $2 AND deleted_at IS NULL FOR UPDATE) AS previous
+		WHERE u.id = previous.id
+		RETURNING previous.role
+	`
+
+	var previousRole string
+	if err := r.db.QueryRow(ctx, query, role, userID).Scan(&previousRole); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrUserNotFound
+		}
+		return "", fmt.Errorf("failed to update user role: %w", err)
+	}
+
+	return previousRole, nil
+}
+
+// SetPasswordResetRequired forces the user to reset their password before the next login.
+func (r *UserRepo) SetPasswordResetRequired(ctx context.Context, userID uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET password_reset_required = TRUE, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	_, err := r.db.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to require password reset: %w", err)
+	}
+
+	return nil
+}
+
+// RestoreUser undeletes a user that has not been purged yet.
+func (r *UserRepo) RestoreUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	query := `
+		UPDATE users
+		SET deleted_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NOT NULL AND purged_at IS NULL
+		RETURNING ` + userColumns
+
+	user, err := scanUser(r.db.QueryRow(ctx, query, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return nil, ErrUserConflict
+		}
+		return nil, fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	return user, nil
+}
+
+// UpdateUserPasswordByID sets a new password hash for the user and clears any pending forced reset.
+func (r *UserRepo) UpdateUserPasswordByID(ctx context.Context, userID string, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1, password_reset_required = FALSE, updated_at = NOW()
+		WHERE id = $2 AND deleted_at IS NULL
+	`
+
+	_, err := r.db.Exec(ctx, query, passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return nil
+}
+
+// SetUserPhone sets the phone number of the user. A number other than the
+// current one starts out unverified.
+func (r *UserRepo) SetUserPhone(ctx context.Context, userID uuid.UUID, phone string) error {
+	query := `
+		UPDATE users
+		SET phone_verified_at = CASE WHEN phone = $1 THEN phone_verified_at END,
+			phone = $1,
+			updated_at = NOW()
+		WHERE id = $2 AND deleted_at IS NULL
+	`
+
+	_, err := r.db.Exec(ctx, query, phone, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set user phone: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyUserPhone marks the phone number of the user verified, provided it is
+// still the number set on the account.
+func (r *UserRepo) VerifyUserPhone(ctx context.Context, userID string, phone string) error {
+	query := `
+		UPDATE users
+		SET phone_verified_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND phone = $2 AND deleted_at IS NULL
+	`
+
+	tag, err := r.db.Exec(ctx, query, userID, phone)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrPhoneTaken
+		}
+		return fmt.Errorf("failed to verify user phone: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPhoneMismatch
+	}
+
+	return nil
+}
+
+// MarkEmailVerified records that the user proved ownership of their email.
+func (r *UserRepo) MarkEmailVerified(ctx context.Context, userID string) error {
+	query := `
+		UPDATE users
+		SET email_verified_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND email_verified_at IS NULL
+	`
+
+	_, err := r.db.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	return nil
+}
+
+// SetAgeVerified records whether the user's date of birth was verified against
+// an identity document. It returns ErrUserNotFound if the user does not exist.
+func (r *UserRepo) SetAgeVerified(ctx context.Context, userID uuid.UUID, verified bool) error {
+	query := `
+		UPDATE users
+		SET age_verified_at = CASE WHEN $1::boolean THEN COALESCE(age_verified_at, NOW()) END, updated_at = NOW()
+		WHERE id = $2 AND deleted_at IS NULL
+	`
+
+	tag, err := r.db.Exec(ctx, query, verified, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update age verification: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+// Package validation registers the custom request validation rules used in
+// binding tags.
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/phone"
+)
+
+// usernamePattern allows 3 to 32 letters, digits, dots and underscores,
+// starting with a letter or digit.
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.]{2,31}$`)
+
+// userStatuses are the account statuses an admin can set.
+var userStatuses = map[string]bool{
+	models.UserStatusPending:  true,
+	models.UserStatusApproved: true,
+	models.UserStatusCanceled: true,
+}
+
+// roles are the roles known to the auth service.
+var roles = map[string]bool{
+	models.RoleUser:     true,
+	models.RoleCourier:  true,
+	models.RoleStaff:    true,
+	models.RoleSupport:  true,
+	models.RoleOrgOwner: true,
+	models.RoleAdmin:    true,
+}
+
+// IsRole reports whether role is a role known to the auth service.
+func IsRole(role string) bool {
+	return roles[role]
+}
+
+// IsUserStatus reports whether status is an account status an admin can set.
+func IsUserStatus(status string) bool {
+	return userStatuses[status]
+}
+
+// Register adds the custom rules to v:
+//
+//	username     3 to 32 letters, digits, dots and underscores
+//	phone        a number that normalizes to E.164
+//	min_age=N    a date of birth at least N years ago
+//	user_status  pending, approved or canceled
+func Register(v *validator.Validate) error {
+	rules := map[string]validator.Func{
+		"username":    isUsername,
+		"phone":       isPhone,
+		"min_age":     hasMinAge,
+		"user_status": isUserStatus,
+	}
+	for tag, fn := range rules {
+		if err := v.RegisterValidation(tag, fn); err != nil {
+			return fmt.Errorf("failed to register %s validation: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+func isUsername(fl validator.FieldLevel) bool {
+	return IsUsername(fl.Field().String())
+}
+
+// IsUsername reports whether username is 3 to 32 letters, digits, dots and underscores.
+func IsUsername(username string) bool {
+	return usernamePattern.MatchString(username)
+}
+
+func isPhone(fl validator.FieldLevel) bool {
+	_, err := phone.Normalize(fl.Field().String())
+	return err == nil
+}
+
+func isUserStatus(fl validator.FieldLevel) bool {
+	return IsUserStatus(fl.Field().String())
+}
+
+// hasMinAge reports whether the date of birth lies at least the given number of
+// years in the past. Dates in the future always fail.
+func hasMinAge(fl validator.FieldLevel) bool {
+	dob, ok := fl.Field().Interface().(time.Time)
+	if !ok {
+		return false
+	}
+	years, err := strconv.Atoi(fl.Param())
+	if err != nil {
+		panic(fmt.Sprintf("min_age: invalid parameter %q", fl.Param()))
+	}
+	return Age(dob, time.Now()) >= years && !dob.After(time.Now())
+}
+
+// Age returns the age in whole years on the given day of someone born on dob.
+func Age(dob time.Time, on time.Time) int {
+	age := on.Year() - dob.Year()
+	if on.Month() < dob.Month() || (on.Month() == dob.Month() && on.Day() < dob.Day()) {
+		age--
+	}
+	return age
+}
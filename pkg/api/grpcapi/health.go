@@ -0,0 +1,35 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/health"
+	authv1 "github.com/time_capsule/Auth-Servic-Timecapsule/proto/auth/v1"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// healthServer implements the standard gRPC health service with the same
+// checks as /readyz, so the service is NOT_SERVING while a dependency is down
+// or the process is draining. Watch is not supported.
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+
+	checker *health.Checker
+}
+
+// Check reports the status of the server ("") or of the auth service.
+func (s *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	switch req.GetService() {
+	case "", authv1.AuthService_ServiceDesc.ServiceName:
+	default:
+		return nil, status.Error(codes.NotFound, "unknown service")
+	}
+
+	resp := &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}
+	if s.checker.Check(ctx).Ready() {
+		resp.Status = healthpb.HealthCheckResponse_SERVING
+	}
+	return resp, nil
+}
@@ -0,0 +1,142 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/logging"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDKey carries the request ID in call and response metadata, like the
+// X-Request-ID header of the REST API.
+const requestIDKey = "x-request-id"
+
+// requestIDInterceptor accepts the request ID sent by the client or generates
+// one, returns it in the response header and attaches it to the logs of the call.
+func requestIDInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var requestID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDKey); len(values) > 0 {
+			requestID = values[0]
+		}
+	}
+	if !logging.ValidRequestID(requestID) {
+		requestID = uuid.New().String()
+	}
+
+	if err := grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, requestID)); err != nil {
+		slog.WarnContext(ctx, "failed to set request ID header", "error", err)
+	}
+	return handler(logging.WithRequestID(ctx, requestID), req)
+}
+
+// loggingInterceptor logs every call and records it in the metrics.
+func loggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	startTime := time.Now()
+
+	resp, err := handler(ctx, req)
+
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.OK, codes.NotFound:
+	case codes.Internal, codes.Unknown, codes.Unavailable, codes.DataLoss:
+		level = slog.LevelError
+	default:
+		level = slog.LevelWarn
+	}
+
+	latency := time.Since(startTime)
+	slog.LogAttrs(ctx, level, "grpc request",
+		slog.String("method", info.FullMethod),
+		slog.String("code", code.String()),
+		slog.Float64("latency_ms", float64(latency.Microseconds())/1000),
+	)
+	metrics.ObserveGRPCRequest(info.FullMethod, code.String(), latency.Seconds())
+
+	return resp, err
+}
+
+// recoveryInterceptor turns a panic in a handler into an Internal error.
+func recoveryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			slog.ErrorContext(ctx, "panic recovered",
+				"panic", fmt.Sprint(recovered),
+				"stack", string(debug.Stack()),
+			)
+			err = status.Error(codes.Internal, "internal error")
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+// apiKeyAuthenticator checks the API key sent in the "authorization" metadata
+// as "Bearer <key>". The health service is open so that probes need no key.
+type apiKeyAuthenticator struct {
+	keyHashes [][]byte
+}
+
+func newAPIKeyAuthenticator(keys []string) *apiKeyAuthenticator {
+	a := &apiKeyAuthenticator{}
+	for _, key := range keys {
+		sum := sha256.Sum256([]byte(key))
+		a.keyHashes = append(a.keyHashes, sum[:])
+	}
+	if len(a.keyHashes) == 0 {
+		slog.Warn("no GRPC_API_KEYS configured, the gRPC API rejects every call")
+	}
+	return a
+}
+
+func (a *apiKeyAuthenticator) authenticate(ctx context.Context, fullMethod string) error {
+	if strings.HasPrefix(fullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+		return status.Error(codes.Unauthenticated, "API key required")
+	}
+
+	// Keys are compared by hash so that the comparison takes the same time
+	// whatever their length.
+	sum := sha256.Sum256([]byte(strings.TrimPrefix(values[0], "Bearer ")))
+	for _, keyHash := range a.keyHashes {
+		if subtle.ConstantTimeCompare(sum[:], keyHash) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid API key")
+}
+
+// unaryInterceptor rejects unary calls without a valid API key.
+func (a *apiKeyAuthenticator) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := a.authenticate(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamInterceptor rejects streaming calls without a valid API key.
+func (a *apiKeyAuthenticator) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := a.authenticate(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,291 @@
+// Package grpcapi serves the gRPC API that internal services use to validate
+// tokens and look up users. It is defined in proto/auth/v1/auth.proto.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/auth"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/health"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/redis"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/user"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/validation"
+	authv1 "github.com/time_capsule/Auth-Servic-Timecapsule/proto/auth/v1"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Page sizes of ListUsers and the most IDs BatchGetUsers accepts, as for the REST user list.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+	maxBatchSize    = 200
+)
+
+// NewServer creates the gRPC server with the auth and health services registered.
+func NewServer(db *pgxpool.Pool, redisClient *redis.Client, checker *health.Checker, cfg *config.Config) *grpc.Server {
+	apiKeys := newAPIKeyAuthenticator(cfg.GRPCAPIKeys)
+	srv := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			requestIDInterceptor,
+			loggingInterceptor,
+			recoveryInterceptor,
+			apiKeys.unaryInterceptor,
+		),
+		grpc.ChainStreamInterceptor(apiKeys.streamInterceptor),
+	)
+
+	authv1.RegisterAuthServiceServer(srv, &authServer{
+		userRepo:    user.NewUserRepo(db),
+		redisClient: redisClient,
+		jwtManager:  auth.NewJWTManager(cfg),
+	})
+	healthpb.RegisterHealthServer(srv, &healthServer{checker: checker})
+
+	return srv
+}
+
+// Stop stops the server gracefully, waiting for in-flight calls until ctx is done.
+func Stop(ctx context.Context, srv *grpc.Server) error {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		srv.Stop()
+		return ctx.Err()
+	}
+}
+
+// authServer implements the AuthService of the gRPC API.
+type authServer struct {
+	authv1.UnimplementedAuthServiceServer
+
+	userRepo    *user.UserRepo
+	redisClient *redis.Client
+	jwtManager  *auth.JWTManager
+}
+
+// ValidateToken verifies an access or impersonation token and returns its claims.
+func (s *authServer) ValidateToken(ctx context.Context, req *authv1.ValidateTokenRequest) (*authv1.ValidateTokenResponse, error) {
+	claims, err := s.verifyToken(ctx, req.GetToken())
+	if err != nil {
+		return nil, err
+	}
+
+	return &authv1.ValidateTokenResponse{
+		UserId:      claims.GetUserID(),
+		Role:        claims.GetUserRole(),
+		SessionId:   claims.GetSessionID(),
+		ActorId:     claims.GetActorID(),
+		AgeVerified: claims.AgeVerified,
+		AgeOver_18:  claims.AgeOver18,
+		ExpiresAt:   timestamppb.New(time.Unix(claims.ExpiresAt, 0)),
+	}, nil
+}
+
+// GetUser returns a user by ID.
+func (s *authServer) GetUser(ctx context.Context, req *authv1.GetUserRequest) (*authv1.User, error) {
+	userID, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user ID")
+	}
+
+	u, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, internalError(ctx, "failed to get user", err)
+	}
+
+	return toProtoUser(u), nil
+}
+
+// BatchGetUsers returns the users with the given IDs and reports the IDs that were not found.
+func (s *authServer) BatchGetUsers(ctx context.Context, req *authv1.BatchGetUsersRequest) (*authv1.BatchGetUsersResponse, error) {
+	if len(req.GetIds()) > maxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d IDs can be requested at once", maxBatchSize)
+	}
+
+	userIDs := make([]uuid.UUID, 0, len(req.GetIds()))
+	requested := map[string]bool{}
+	for _, id := range req.GetIds() {
+		userID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid user ID %q", id)
+		}
+		if !requested[userID.String()] {
+			requested[userID.String()] = true
+			userIDs = append(userIDs, userID)
+		}
+	}
+
+	resp := &authv1.BatchGetUsersResponse{}
+	if len(userIDs) == 0 {
+		return resp, nil
+	}
+	users, err := s.userRepo.GetUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, internalError(ctx, "failed to get users", err)
+	}
+
+	for _, u := range users {
+		resp.Users = append(resp.Users, toProtoUser(u))
+		delete(requested, u.ID)
+	}
+	for _, userID := range userIDs {
+		if requested[userID.String()] {
+			resp.MissingIds = append(resp.MissingIds, userID.String())
+		}
+	}
+
+	return resp, nil
+}
+
+// ListUsers returns one page of users matching the filter, oldest first.
+func (s *authServer) ListUsers(ctx context.Context, req *authv1.ListUsersRequest) (*authv1.ListUsersResponse, error) {
+	filter := models.GetAllUsers{
+		Email:     req.GetEmail(),
+		FullName:  req.GetFullName(),
+		Username:  req.GetUsername(),
+		Role:      req.GetRole(),
+		Status:    req.GetStatus(),
+		Match:     models.MatchPartial,
+		SortBy:    models.SortByCreatedAt,
+		SortOrder: models.SortAsc,
+		Cursor:    req.GetPageToken(),
+		Deleted:   models.DeletedExclude,
+		Limit:     defaultPageSize,
+	}
+	if req.GetExact() {
+		filter.Match = models.MatchExact
+	}
+	if filter.Role != "" && !validation.IsRole(filter.Role) {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown role %q", filter.Role)
+	}
+	if filter.Status != "" && !validation.IsUserStatus(filter.Status) {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown status %q", filter.Status)
+	}
+	if pageSize := req.GetPageSize(); pageSize != 0 {
+		if pageSize < 0 || pageSize > maxPageSize {
+			return nil, status.Errorf(codes.InvalidArgument, "page_size must be between 1 and %d", maxPageSize)
+		}
+		filter.Limit = int(pageSize)
+	}
+
+	list, err := s.userRepo.GetAllUsers(ctx, filter)
+	if err != nil {
+		if errors.Is(err, user.ErrInvalidCursor) {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		return nil, internalError(ctx, "failed to list users", err)
+	}
+
+	resp := &authv1.ListUsersResponse{NextPageToken: list.NextCursor}
+	for _, u := range list.Items {
+		resp.Users = append(resp.Users, toProtoUser(u))
+	}
+	return resp, nil
+}
+
+// CheckPermission reports whether the role of a user, or of a token, grants the permission.
+func (s *authServer) CheckPermission(ctx context.Context, req *authv1.CheckPermissionRequest) (*authv1.CheckPermissionResponse, error) {
+	if req.GetPermission() == "" {
+		return nil, status.Error(codes.InvalidArgument, "permission is required")
+	}
+
+	var role string
+	switch subject := req.GetSubject().(type) {
+	case *authv1.CheckPermissionRequest_UserId:
+		u, err := s.GetUser(ctx, &authv1.GetUserRequest{Id: subject.UserId})
+		if err != nil {
+			return nil, err
+		}
+		role = u.GetRole()
+	case *authv1.CheckPermissionRequest_Token:
+		claims, err := s.verifyToken(ctx, subject.Token)
+		if err != nil {
+			return nil, err
+		}
+		role = claims.GetUserRole()
+	default:
+		return nil, status.Error(codes.InvalidArgument, "user_id or token is required")
+	}
+
+	return &authv1.CheckPermissionResponse{
+		Allowed: auth.HasPermission(role, req.GetPermission()),
+		Role:    role,
+	}, nil
+}
+
+// verifyToken verifies a token and checks that its session has not been
+// revoked, as the REST API does for authenticated requests.
+func (s *authServer) verifyToken(ctx context.Context, token string) (*auth.UserClaims, error) {
+	claims, err := s.jwtManager.Verify(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	revoked, err := auth.IsRevoked(ctx, s.redisClient, claims)
+	if err != nil {
+		return nil, internalError(ctx, "failed to verify session", err)
+	}
+	if revoked {
+		return nil, status.Error(codes.Unauthenticated, "session has been revoked")
+	}
+
+	return claims, nil
+}
+
+// internalError logs err and returns an Internal status that does not expose it.
+func internalError(ctx context.Context, message string, err error) error {
+	slog.ErrorContext(ctx, message, "error", err)
+	return status.Error(codes.Internal, message)
+}
+
+// toProtoUser converts a user to its gRPC representation.
+func toProtoUser(u *models.User) *authv1.User {
+	pu := &authv1.User{
+		Id:               u.ID,
+		Username:         u.Username,
+		Email:            u.Email,
+		EmailVerified:    u.EmailVerifiedAt != nil,
+		PhoneVerified:    u.PhoneVerifiedAt != nil,
+		FullName:         u.FullName,
+		AgeVerified:      u.AgeVerified,
+		Status:           u.Status,
+		Role:             u.Role,
+		RoleSelfAssigned: u.RoleSelfAssigned,
+		CreatedAt:        timestamppb.New(u.CreatedAt),
+		UpdatedAt:        timestamppb.New(u.UpdatedAt),
+	}
+	if u.Phone != nil {
+		pu.Phone = *u.Phone
+	}
+	if !u.DateOfBirth.IsZero() {
+		pu.DateOfBirth = u.DateOfBirth.Format(time.DateOnly)
+	}
+	if u.OrgID != nil {
+		pu.OrgId = *u.OrgID
+	}
+	return pu
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/problem"
+)
+
+// ErrorHandler writes the last error a handler reported with problem.Abort as
+// a problem response, unless the handler already wrote a response.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		problem.Write(c, c.Errors.Last().Err)
+	}
+}
+
+// Recovery turns a panic in a handler into an internal error response and logs
+// the panic with its stack trace.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered interface{}) {
+		slog.ErrorContext(c.Request.Context(), "panic recovered",
+			"panic", fmt.Sprint(recovered),
+			"stack", string(debug.Stack()),
+		)
+		problem.Write(c, problem.Internal.New(""))
+		c.Abort()
+	})
+}
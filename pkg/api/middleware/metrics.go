@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/metrics"
+)
+
+// unmatchedRoute labels requests that matched no route, so that scans of
+// random paths do not create new series.
+const unmatchedRoute = "unmatched"
+
+// Metrics records the count and latency of requests by route template.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		metrics.ObserveHTTPRequest(c.Request.Method, route, strconv.Itoa(c.Writer.Status()), time.Since(start).Seconds())
+	}
+}
@@ -1,13 +1,15 @@
 package middleware
 
 import (
-	"fmt"
+	"log/slog"
+	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Logger is a middleware function that logs request information.
+// Logger is a middleware function that logs request information. The query
+// string is left out as it may carry sign-in and invite tokens.
 func Logger() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Start timer
@@ -16,17 +18,24 @@ func Logger() gin.HandlerFunc {
 		// Process request
 		c.Next()
 
-		// Calculate latency
-		latencyTime := time.Since(startTime)
-		latency := fmt.Sprintf("%v", latencyTime)
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
 
 		// Log request details
-		fmt.Printf("[GIN] %s | %3d | %s | %s | %s \n",
-			startTime.Format("2006/01/02 - 15:04:05"),
-			c.Writer.Status(),
-			latency,
-			c.Request.Method,
-			c.Request.RequestURI,
+		slog.LogAttrs(c.Request.Context(), level, "request",
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(startTime).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("size", c.Writer.Size()),
 		)
 	}
 }
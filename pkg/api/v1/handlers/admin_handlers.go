@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/audit"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/auth"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/problem"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/user"
+)
+
+// AdminHandler handles administrative and support API requests.
+type AdminHandler struct {
+	userRepo   *user.UserRepo
+	auditRepo  *audit.AuditRepo
+	cfg        *config.Config
+	jwtManager *auth.JWTManager
+}
+
+// NewAdminHandler creates a new AdminHandler.
+func NewAdminHandler(db *pgxpool.Pool, cfg *config.Config) *AdminHandler {
+	return &AdminHandler{
+		userRepo:   user.NewUserRepo(db),
+		auditRepo:  audit.NewAuditRepo(db),
+		cfg:        cfg,
+		jwtManager: auth.NewJWTManager(cfg),
+	}
+}
+
+// Impersonate godoc
+// @Summary      Impersonate User
+// @Description  Issues a short-lived token for acting as the given user. The token carries the caller in its "act" claim and every request made with it is audit logged.
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        userId  path      string  true  "User ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /admin/impersonate/{userId} [post]
+func (h *AdminHandler) Impersonate(c *gin.Context) {
+	targetID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+
+	if c.GetString("actorID") != "" {
+		problem.Abort(c, problem.ImpersonationForbidden.New("Cannot impersonate from an impersonated session"))
+		return
+	}
+	actorID := c.GetString("userID")
+	if actorID == targetID.String() {
+		problem.Abort(c, problem.InvalidParameter.New("Cannot impersonate yourself"))
+		return
+	}
+
+	target, err := h.userRepo.GetUserByID(c.Request.Context(), targetID)
+	if err != nil {
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
+		return
+	}
+	// Users who can impersonate others are not impersonable themselves, so
+	// support staff cannot borrow an admin's privileges.
+	if auth.HasPermission(target.Role, auth.PermImpersonate) {
+		problem.Abort(c, problem.ImpersonationForbidden.New("Privileged accounts cannot be impersonated"))
+		return
+	}
+
+	duration := time.Duration(h.cfg.ImpersonationExpiry) * time.Minute
+	token, err := h.jwtManager.GenerateImpersonation(target, actorID, duration)
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to generate token"))
+		return
+	}
+
+	event := audit.FromContext(c, audit.ActionImpersonationStart)
+	event.TargetID = target.ID
+	event.Diff = audit.Details(map[string]interface{}{
+		"expires_in":   int(duration.Seconds()),
+		"allow_writes": h.cfg.ImpersonationAllowWrites,
+	})
+	h.auditRepo.Record(c.Request.Context(), event)
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_in": int(duration.Seconds()),
+	})
+}
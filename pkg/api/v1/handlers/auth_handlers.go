@@ -2,143 +2,281 @@ package handlers
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/audit"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/auth"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/background"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/device"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/email"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/identity"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/metrics"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/oidc"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/phone"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/problem"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/redis"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/sms"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/user"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/validation"
+)
+
+// deviceRevokeLinkExpiry is how long the link in a new sign-in email stays valid.
+const deviceRevokeLinkExpiry = 7 * 24 * time.Hour
+
+// Scopes of single-use codes kept in Redis. A code is only accepted for the purpose it was sent for.
+const (
+	otpScopePhoneVerify   = "phone_verify"
+	otpScopePhoneLogin    = "phone_login"
+	otpScopePhoneChange   = "phone_change"
+	otpScopePasswordReset = "password_reset"
+	otpScopeEmailLogin    = "email_login"
+	otpScopeEmailLink     = "email_link"
+	otpScopeDeviceRevoke  = "device_revoke"
 )
 
 // AuthHandler handles authentication-related API requests.
 type AuthHandler struct {
-	userRepo    *user.UserRepo
-	redisClient *redis.Client
-	cfg         *config.Config
-	jwtManager  *auth.JWTManager
+	userRepo     *user.UserRepo
+	auditRepo    *audit.AuditRepo
+	deviceRepo   *device.DeviceRepo
+	identityRepo *identity.IdentityRepo
+	redisClient  *redis.Client
+	smsSender    sms.SMSSender
+	providers    *oidc.Registry
+	tasks        *background.Group
+	cfg          *config.Config
+	jwtManager   *auth.JWTManager
 }
 
 // NewAuthHandler creates a new AuthHandler.
-func NewAuthHandler(db *pgxpool.Pool, redisClient *redis.Client, cfg *config.Config) *AuthHandler {
+func NewAuthHandler(db *pgxpool.Pool, redisClient *redis.Client, smsSender sms.SMSSender, providers *oidc.Registry, tasks *background.Group, cfg *config.Config) *AuthHandler {
 	return &AuthHandler{
-		userRepo:    user.NewUserRepo(db),
-		redisClient: redisClient,
-		cfg:         cfg,
-		jwtManager:  auth.NewJWTManager(cfg),
+		userRepo:     user.NewUserRepo(db),
+		auditRepo:    audit.NewAuditRepo(db),
+		deviceRepo:   device.NewDeviceRepo(db),
+		identityRepo: identity.NewIdentityRepo(db),
+		redisClient:  redisClient,
+		smsSender:    smsSender,
+		providers:    providers,
+		tasks:        tasks,
+		cfg:          cfg,
+		jwtManager:   auth.NewJWTManager(cfg),
 	}
 }
 
 // Register godoc
 // @Summary      Register a new user
-// @Description  Registers a new user and sends an OTP to their email for verification.
+// @Description  Registers a new customer or courier applicant with an email or a phone number and sends an OTP to it for verification. If both are given the email is verified and the phone can be verified later. Higher roles must be requested separately.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
 // @Param        user  body     models.UserCreate  true  "User registration data"
 // @Success      201  {object}  map[string]interface{}
-// @Failure      400  {object}  map[string]interface{}
-// @Failure      409  {object}  map[string]interface{}
-// @Failure      500  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      502  {object}  problem.Problem
 // @Router       /auth/register [post]
 func (h *AuthHandler) Register(c *gin.Context) {
-	var input models.User
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var req models.UserCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Abort(c, problem.Bind(err))
 		return
 	}
 
-	// Check if user already exists
-	_, err := h.userRepo.GetUserByEmail(context.Background(), input.Email)
-	if err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
+	// Only the fields of the registration DTO are copied; the role is limited
+	// to customer or courier applicant and couriers stay pending until approved.
+	input := models.User{
+		Username:    req.Username,
+		Email:       req.Email,
+		FullName:    req.FullName,
+		DateOfBirth: req.DateOfBirth,
+		Role:        req.Role,
+	}
+	if input.Role == "" {
+		input.Role = models.RoleUser
+	}
+	if !checkMinimumAge(c, h.cfg, input.Role, input.DateOfBirth) {
 		return
 	}
 
-	// Hash the password
-	hashedPassword, err := auth.HashPassword(input.PasswordHash)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
-		return
+	if req.Phone != "" {
+		normalized, err := phone.Normalize(req.Phone)
+		if err != nil {
+			problem.Abort(c, problem.PhoneInvalid.New(err.Error()))
+			return
+		}
+		if _, err := h.userRepo.GetUserByPhone(c.Request.Context(), normalized); err == nil {
+			problem.Abort(c, problem.PhoneTaken.New("User with this phone already exists"))
+			return
+		}
+		input.Phone = &normalized
 	}
-	input.PasswordHash = hashedPassword
 
-	// Generate OTP
-	otp := auth.GenerateOTP()
+	// Check if user already exists
+	if input.Email != "" {
+		_, err := h.userRepo.GetUserByEmail(c.Request.Context(), input.Email)
+		if err == nil {
+			problem.Abort(c, problem.EmailTaken.New("User with this email already exists"))
+			return
+		}
+	}
 
-	// Save OTP in Redis
-	err = h.redisClient.SaveOTP(context.Background(), input.Email, otp, 5*time.Minute)
+	// Generate OTP
+	otp, err := auth.GenerateOTP()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save OTP"})
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to generate OTP"))
 		return
 	}
 
-	// Send OTP email
-	err = email.SendOTP(h.cfg, input.Email, otp)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send OTP email" + err.Error()})
-		return
+	message := "User registered successfully. Please verify your email."
+	if input.Email != "" {
+		// Save OTP in Redis
+		err = h.redisClient.SaveOTP(c.Request.Context(), input.Email, otp, 5*time.Minute)
+		if err != nil {
+			problem.Abort(c, problem.Internal.Wrap(err, "Failed to save OTP"))
+			return
+		}
+
+		// Send OTP email
+		err = email.SendOTP(c.Request.Context(), h.cfg, input.Email, otp)
+		if err != nil {
+			problem.Abort(c, problem.UpstreamUnavailable.Wrap(err, "Failed to send OTP email"))
+			return
+		}
+	} else {
+		if !h.sendPhoneOTP(c, otpScopePhoneVerify, *input.Phone, *input.Phone, otp) {
+			return
+		}
+		message = "User registered successfully. Please verify your phone."
 	}
 
-	// Create the user (without saving the password yet)
-	input.PasswordHash = "" // Don't save the password until OTP is verified
-	if err := h.userRepo.CreateUser(context.Background(), &input); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+	// Create the user without a password; it is set once the OTP is verified
+	if err := h.userRepo.CreateUser(c.Request.Context(), &input); err != nil {
+		if errors.Is(err, user.ErrUserConflict) {
+			problem.Abort(c, problem.UserConflict.New("Username or email is already in use"))
+			return
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to create user"))
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully. Please verify your email."})
+	c.JSON(http.StatusCreated, gin.H{"message": message})
 }
 
 // VerifyOTP godoc
 // @Summary      Verify OTP
-// @Description  Verifies the OTP sent to the user's email during registration.
+// @Description  Verifies the OTP sent to the user's email or phone during registration and sets the password.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
-// @Param        input  body      VerifyOTPInput  true  "Email and OTP"
+// @Param        input  body      VerifyOTPInput  true  "Email or phone, OTP and password"
 // @Success      200  {object}  map[string]interface{}
-// @Failure      400  {object}  map[string]interface{}
-// @Failure      401  {object}  map[string]interface{}
-// @Failure      404  {object}  map[string]interface{}
-// @Failure      500  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
 // @Router       /auth/verify-otp [post]
 func (h *AuthHandler) VerifyOTP(c *gin.Context) {
-	var input struct {
-		Email    string `json:"email"`
-		OTP      string `json:"otp"`
-		Password string `json:"password"`
-	}
+	var input VerifyOTPInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+
+	if input.Phone != "" {
+		h.verifyPhoneRegistration(c, input.Phone, input.OTP, input.Password)
 		return
 	}
 
 	// Verify OTP against Redis
-	isValid, err := h.redisClient.VerifyOTP(context.Background(), input.Email, input.OTP)
+	isValid, err := h.redisClient.VerifyOTP(c.Request.Context(), input.Email, input.OTP)
+	if errors.Is(err, redis.ErrOTPExpired) {
+		problem.Abort(c, problem.OTPExpired.New("OTP has expired, request a new one"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify OTP"})
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to verify OTP"))
 		return
 	}
 	if !isValid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid OTP"})
+		problem.Abort(c, problem.OTPInvalid.New("Invalid OTP"))
 		return
 	}
 
 	// Update the user with the hashed password
-	hashedPassword, err := auth.HashPassword(input.Password) // Use OTP as the password for now
+	hashedPassword, err := auth.HashPassword(c.Request.Context(), input.Password) // Use OTP as the password for now
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to hash password"))
+		return
+	}
+
+	if err := h.userRepo.UpdateUserPassword(c.Request.Context(), &models.UserUpdatePass{Email: input.Email, PasswordHash: hashedPassword}); err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to update user"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "OTP verified successfully"})
+}
+
+// verifyPhoneRegistration completes a registration made with a phone number.
+func (h *AuthHandler) verifyPhoneRegistration(c *gin.Context, rawPhone string, otp string, password string) {
+	normalized, err := phone.Normalize(rawPhone)
+	if err != nil {
+		problem.Abort(c, problem.PhoneInvalid.New(err.Error()))
+		return
+	}
+
+	isValid, err := h.redisClient.ConsumeScopedOTP(c.Request.Context(), otpScopePhoneVerify, normalized, otp)
+	if errors.Is(err, redis.ErrOTPExpired) {
+		problem.Abort(c, problem.OTPExpired.New("OTP has expired, request a new one"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to verify OTP"))
+		return
+	}
+	if !isValid {
+		problem.Abort(c, problem.OTPInvalid.New("Invalid OTP"))
 		return
 	}
 
-	if err := h.userRepo.UpdateUserPassword(context.Background(), &models.UserUpdatePass{Email: input.Email, PasswordHash: hashedPassword}); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+	u, err := h.userRepo.GetPendingUserByPhone(c.Request.Context(), normalized)
+	if err != nil {
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(c.Request.Context(), password)
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to hash password"))
+		return
+	}
+
+	if err := h.userRepo.VerifyUserPhone(c.Request.Context(), u.ID, normalized); err != nil {
+		if errors.Is(err, user.ErrPhoneTaken) {
+			problem.Abort(c, problem.PhoneTaken.New("User with this phone already exists"))
+			return
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to update user"))
+		return
+	}
+	if err := h.userRepo.UpdateUserPasswordByID(c.Request.Context(), u.ID, hashedPassword); err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to update user"))
 		return
 	}
 
@@ -147,66 +285,340 @@ func (h *AuthHandler) VerifyOTP(c *gin.Context) {
 
 // Login godoc
 // @Summary      Login
-// @Description  Authenticates a user and issues a JWT token.
+// @Description  Authenticates a user by email or verified phone number and password, and issues a JWT token with a refresh token for the session. Sign-ins from a new device are reported to the user.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
 // @Param        input  body      LoginInput  true  "User login credentials"
 // @Success      200  {object}  map[string]interface{}
-// @Failure      400  {object}  map[string]interface{}
-// @Failure      401  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
 // @Router       /auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
-	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var input LoginInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.Abort(c, problem.Bind(err))
 		return
 	}
 
 	// Get the user from the database
-	user, err := h.userRepo.GetUserByEmail(context.Background(), input.Email)
+	field, value := "email", input.Email
+	var (
+		user *models.User
+		err  error
+	)
+	if input.Phone != "" {
+		field = "phone"
+		if value, err = phone.Normalize(input.Phone); err != nil {
+			problem.Abort(c, problem.PhoneInvalid.New(err.Error()))
+			return
+		}
+		user, err = h.userRepo.GetUserByPhone(c.Request.Context(), value)
+	} else {
+		user, err = h.userRepo.GetUserByEmail(c.Request.Context(), input.Email)
+	}
+	invalidCredentials := fmt.Sprintf("Invalid %s or password", field)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		h.recordLoginFailure(c, "", field, value, "unknown_"+field)
+		problem.Abort(c, problem.InvalidCredentials.New(invalidCredentials))
 		return
 	}
-	if user.Role == "courier" && user.Status != "approved" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Your account should have been approved."})
+	if user.Role == models.RoleCourier && user.Status != models.UserStatusApproved {
+		h.recordLoginFailure(c, user.ID, field, value, "not_approved")
+		problem.Abort(c, problem.AccountNotApproved.New("Your account should have been approved."))
 		return
 	}
 	// Compare the provided password with the stored hash
-	if !auth.CheckPasswordHash(input.Password, user.PasswordHash) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+	if !auth.CheckPasswordHash(c.Request.Context(), input.Password, user.PasswordHash) {
+		h.recordLoginFailure(c, user.ID, field, value, "invalid_password")
+		problem.Abort(c, problem.InvalidCredentials.New(invalidCredentials))
+		return
+	}
+	if user.PasswordResetRequired {
+		h.recordLoginFailure(c, user.ID, field, value, "password_reset_required")
+		problem.Abort(c, problem.PasswordResetRequired.New("Password reset required. Use forgot password to set a new one."))
+		return
+	}
+
+	h.startSession(c, user)
+}
+
+// RequestPhoneLoginOTP godoc
+// @Summary      Request Phone Login Code
+// @Description  Sends a one-time login code by SMS to a verified phone number. The response is the same whether or not the number is registered.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      PhoneOTPRequestInput  true  "Phone number"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Router       /auth/login/phone-otp/request [post]
+func (h *AuthHandler) RequestPhoneLoginOTP(c *gin.Context) {
+	var input PhoneOTPRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+	normalized, err := phone.Normalize(input.Phone)
+	if err != nil {
+		problem.Abort(c, problem.PhoneInvalid.New(err.Error()))
+		return
+	}
+
+	if u, err := h.userRepo.GetUserByPhone(c.Request.Context(), normalized); err == nil {
+		// Sent in the background so that the response time does not reveal whether the number is registered.
+		ctx := context.WithoutCancel(c.Request.Context())
+		h.tasks.Go(func() {
+			otp, err := auth.GenerateOTP()
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to generate login OTP", "user_id", u.ID, "error", err)
+				return
+			}
+			err = h.redisClient.SaveScopedOTP(ctx, otpScopePhoneLogin, normalized, otp, 5*time.Minute)
+			if err != nil {
+				if !errors.Is(err, redis.ErrOTPCooldown) {
+					slog.ErrorContext(ctx, "failed to save login OTP", "user_id", u.ID, "error", err)
+				}
+				return
+			}
+			if err := sms.SendOTP(ctx, h.smsSender, normalized, otp); err != nil {
+				slog.ErrorContext(ctx, "failed to send login OTP", "user_id", u.ID, "error", err)
+			}
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the number is registered, a login code has been sent."})
+}
+
+// LoginWithPhoneOTP godoc
+// @Summary      Login With Phone Code
+// @Description  Authenticates a user with a verified phone number and the code sent to it, and issues a JWT token.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      PhoneOTPLoginInput  true  "Phone number and code"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /auth/login/phone-otp [post]
+func (h *AuthHandler) LoginWithPhoneOTP(c *gin.Context) {
+	var input PhoneOTPLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+	normalized, err := phone.Normalize(input.Phone)
+	if err != nil {
+		problem.Abort(c, problem.PhoneInvalid.New(err.Error()))
 		return
 	}
 
-	// Generate JWT token
-	token, err := h.jwtManager.Generate(user)
+	isValid, err := h.redisClient.ConsumeScopedOTP(c.Request.Context(), otpScopePhoneLogin, normalized, input.OTP)
+	// A code that expired is reported like a wrong one so as not to reveal pending sign-ins.
+	if err != nil && !errors.Is(err, redis.ErrOTPExpired) {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to verify OTP"))
+		return
+	}
+	user, err := h.userRepo.GetUserByPhone(c.Request.Context(), normalized)
+	if !isValid || err != nil {
+		userID := ""
+		if err == nil {
+			userID = user.ID
+		}
+		h.recordLoginFailure(c, userID, "phone", normalized, "invalid_otp")
+		problem.Abort(c, problem.OTPInvalid.New("Invalid phone or code"))
+		return
+	}
+	h.startPasswordlessSession(c, user, "phone", normalized)
+}
+
+// startPasswordlessSession starts a session for a user who proved ownership of
+// their email or phone with a code or link, applying the same account checks
+// as a password login.
+func (h *AuthHandler) startPasswordlessSession(c *gin.Context, user *models.User, field string, value string) {
+	if user.Role == models.RoleCourier && user.Status != models.UserStatusApproved {
+		h.recordLoginFailure(c, user.ID, field, value, "not_approved")
+		problem.Abort(c, problem.AccountNotApproved.New("Your account should have been approved."))
+		return
+	}
+	if user.PasswordResetRequired {
+		h.recordLoginFailure(c, user.ID, field, value, "password_reset_required")
+		problem.Abort(c, problem.PasswordResetRequired.New("Password reset required. Use forgot password to set a new one."))
+		return
+	}
+
+	h.startSession(c, user)
+}
+
+// startSession issues an access and a refresh token for a new session of the authenticated user and
+// records the sign-in.
+func (h *AuthHandler) startSession(c *gin.Context, user *models.User) {
+	// Generate JWT token for a new session
+	sessionID := uuid.New().String()
+	authTime := time.Now()
+	token, err := h.jwtManager.Generate(user, sessionID, authTime)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to generate token"))
+		return
+	}
+	refreshToken, stored, err := h.newRefreshToken(user.ID, sessionID, authTime)
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to generate token"))
+		return
+	}
+	if err := h.redisClient.SaveRefreshToken(c.Request.Context(), sessionID, stored, h.refreshTokenExpiry()); err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to save refresh token"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	h.checkDevice(c, user, sessionID)
+
+	metrics.LoginSucceeded()
+	event := audit.FromContext(c, audit.ActionLogin)
+	event.ActorID = user.ID
+	event.TargetID = user.ID
+	h.auditRepo.Record(c.Request.Context(), event)
+
+	c.JSON(http.StatusOK, h.sessionTokens(token, refreshToken))
+}
+
+// Refresh godoc
+// @Summary      Refresh Token
+// @Description  Exchanges a refresh token for a new access token of the same session. Refresh tokens are single-use: the response carries the next one. Revoked sessions, deleted accounts and accounts that can no longer sign in are refused.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      RefreshInput  true  "Refresh token"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /auth/refresh [post]
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var input RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+
+	sessionID, tokenHash, ok := auth.ParseRefreshToken(input.RefreshToken)
+	if !ok {
+		problem.Abort(c, problem.InvalidToken.New("Refresh token is invalid or has expired"))
+		return
+	}
+	current, err := h.redisClient.GetRefreshToken(c.Request.Context(), sessionID)
+	if errors.Is(err, redis.ErrRefreshTokenNotFound) {
+		problem.Abort(c, problem.InvalidToken.New("Refresh token is invalid or has expired"))
+		return
+	}
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to get refresh token"))
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(current.TokenHash), []byte(tokenHash)) != 1 {
+		problem.Abort(c, problem.InvalidToken.New("Refresh token is invalid or has expired"))
+		return
+	}
+
+	// The refresh token is checked like an access token issued when it was, so it
+	// stops working once its session, or every session of the user, is revoked.
+	revoked, err := auth.IsRevoked(c.Request.Context(), h.redisClient, &auth.UserClaims{ID: current.UserID, Sid: sessionID, Iat: current.IssuedAt})
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to verify session"))
+		return
+	}
+	if revoked {
+		problem.Abort(c, problem.SessionRevoked.New("Session has been revoked"))
+		return
+	}
+
+	userID, err := uuid.Parse(current.UserID)
+	if err != nil {
+		problem.Abort(c, problem.InvalidToken.New("Refresh token is invalid or has expired"))
+		return
+	}
+	user, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		problem.Abort(c, problem.InvalidToken.New("Refresh token is invalid or has expired"))
+		return
+	}
+	if user.Role == models.RoleCourier && user.Status != models.UserStatusApproved {
+		problem.Abort(c, problem.AccountNotApproved.New("Your account should have been approved."))
+		return
+	}
+	if user.PasswordResetRequired {
+		problem.Abort(c, problem.PasswordResetRequired.New("Password reset required. Use forgot password to set a new one."))
+		return
+	}
+
+	// The new access token carries the current role and age claims of the user,
+	// and the time they signed in
+	authTime := time.Unix(current.AuthTime, 0)
+	token, err := h.jwtManager.Generate(user, sessionID, authTime)
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to generate token"))
+		return
+	}
+	refreshToken, next, err := h.newRefreshToken(user.ID, sessionID, authTime)
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to generate token"))
+		return
+	}
+	err = h.redisClient.RotateRefreshToken(c.Request.Context(), sessionID, current, next, h.refreshTokenExpiry())
+	if errors.Is(err, redis.ErrRefreshTokenNotFound) {
+		problem.Abort(c, problem.InvalidToken.New("Refresh token is invalid or has expired"))
+		return
+	}
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to save refresh token"))
+		return
+	}
+
+	c.JSON(http.StatusOK, h.sessionTokens(token, refreshToken))
+}
+
+// newRefreshToken generates a refresh token for the session and the record to store for it.
+func (h *AuthHandler) newRefreshToken(userID string, sessionID string, authTime time.Time) (string, *redis.RefreshToken, error) {
+	token, tokenHash, err := auth.GenerateRefreshToken(sessionID)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, &redis.RefreshToken{UserID: userID, TokenHash: tokenHash, IssuedAt: time.Now().Unix(), AuthTime: authTime.Unix()}, nil
+}
+
+// refreshTokenExpiry returns how long an unused refresh token stays valid.
+func (h *AuthHandler) refreshTokenExpiry() time.Duration {
+	return time.Duration(h.cfg.RefreshTokenExpiry) * 24 * time.Hour
+}
+
+// sessionTokens is the response body of a sign-in or refresh.
+func (h *AuthHandler) sessionTokens(token string, refreshToken string) gin.H {
+	return gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(h.jwtManager.TokenDuration().Seconds()),
+	}
 }
 
 // Validate godoc
 // @Summary      Validate Token
-// @Description  Validates a JWT token and returns the user ID and role.
+// @Description  Validates a JWT token and returns the user ID and role, plus the actor ID for impersonation tokens.
 // @Tags         auth
 // @Security     ApiKeyAuth
 // @Accept       json
 // @Produce      json
 // @Success      200  {object}  map[string]interface{}
-// @Failure      401  {object}  map[string]interface{}
+// @Failure      401  {object}  problem.Problem
 // @Router       /auth/validate [get]
 func (h *AuthHandler) Validate(c *gin.Context) {
 	// Get the token from the Authorization header
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		problem.Abort(c, problem.Unauthenticated.New("Authorization header required"))
 		return
 	}
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
@@ -214,61 +626,104 @@ func (h *AuthHandler) Validate(c *gin.Context) {
 	// Verify the token
 	claims, err := h.jwtManager.Verify(tokenString)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		problem.Abort(c, problem.InvalidToken.New("Invalid token"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":   claims.GetUserID(),
-		"role": claims.GetUserRole(),
-	})
+	response := gin.H{
+		"id":           claims.GetUserID(),
+		"role":         claims.GetUserRole(),
+		"age_verified": claims.AgeVerified,
+		"age_over_18":  claims.AgeOver18,
+	}
+	if actorID := claims.GetActorID(); actorID != "" {
+		response["actor_id"] = actorID
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 // ForgotPassword godoc
 // @Summary      Forgot Password
-// @Description  Initiates the password reset process by sending an OTP to the user's email.
+// @Description  Initiates the password reset process by sending an OTP to the user's email, or by SMS to their verified phone number.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
-// @Param        input  body      ForgotPasswordInput  true  "User's email address"
+// @Param        input  body      ForgotPasswordInput  true  "User's email address or phone number"
 // @Success      200  {object}  map[string]interface{}
-// @Failure      400  {object}  map[string]interface{}
-// @Failure      404  {object}  map[string]interface{}
-// @Failure      500  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      502  {object}  problem.Problem
 // @Router       /auth/forgot-password [post]
 func (h *AuthHandler) ForgotPassword(c *gin.Context) {
-	var input struct {
-		Email string `json:"email"`
-	}
+	var input ForgotPasswordInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error while binding email" + err.Error()})
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+
+	if input.Phone != "" {
+		normalized, err := phone.Normalize(input.Phone)
+		if err != nil {
+			problem.Abort(c, problem.PhoneInvalid.New(err.Error()))
+			return
+		}
+		u, err := h.userRepo.GetUserByPhone(c.Request.Context(), normalized)
+		if err != nil {
+			problem.Abort(c, problem.UserNotFound.New("User not found"))
+			return
+		}
+		otp, err := auth.GenerateOTP()
+		if err != nil {
+			problem.Abort(c, problem.Internal.Wrap(err, "Failed to generate OTP"))
+			return
+		}
+		if !h.sendPhoneOTP(c, otpScopePasswordReset, normalized, normalized, otp) {
+			return
+		}
+
+		event := audit.FromContext(c, audit.ActionPasswordResetRequest)
+		event.TargetID = u.ID
+		h.auditRepo.Record(c.Request.Context(), event)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password reset OTP sent to your phone."})
 		return
 	}
 
 	// Check if user exists
-	_, err := h.userRepo.GetUserByEmail(context.Background(), input.Email)
+	u, err := h.userRepo.GetUserByEmail(c.Request.Context(), input.Email)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
 		return
 	}
 
 	// Generate OTP
-	otp := auth.GenerateOTP()
+	otp, err := auth.GenerateOTP()
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to generate OTP"))
+		return
+	}
 
 	// Save OTP in Redis (with a longer expiration, e.g., 15 minutes)
-	err = h.redisClient.SaveOTP(context.Background(), input.Email, otp, 15*time.Minute)
+	err = h.redisClient.SaveOTP(c.Request.Context(), input.Email, otp, 15*time.Minute)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save OTP"})
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to save OTP"))
 		return
 	}
 
 	// Send OTP email
-	err = email.SendOTP(h.cfg, input.Email, otp)
+	err = email.SendOTP(c.Request.Context(), h.cfg, input.Email, otp)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send OTP email"})
+		problem.Abort(c, problem.UpstreamUnavailable.Wrap(err, "Failed to send OTP email"))
 		return
 	}
 
+	event := audit.FromContext(c, audit.ActionPasswordResetRequest)
+	event.TargetID = u.ID
+	h.auditRepo.Record(c.Request.Context(), event)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Password reset OTP sent to your email."})
 }
 
@@ -278,99 +733,390 @@ func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 // @Tags         auth
 // @Accept       json
 // @Produce      json
-// @Param        input  body      ResetPasswordInput  true  "Email, OTP, and new password"
+// @Param        input  body      ResetPasswordInput  true  "Email or phone, OTP, and new password"
 // @Success      200  {object}  map[string]interface{}
-// @Failure      400  {object}  map[string]interface{}
-// @Failure      401  {object}  map[string]interface{}
-// @Failure      404  {object}  map[string]interface{}
-// @Failure      500  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
 // @Router       /auth/reset-password [post]
 func (h *AuthHandler) ResetPassword(c *gin.Context) {
-	var input struct {
-		Email              string `json:"email" binding:"required,email"`
-		OTP                string `json:"otp" binding:"required"`
-		NewPassword        string `json:"new_password" binding:"required"`
-		ConfirmNewPassword string `json:"confirm_new_password" binding:"required,eqfield=NewPassword"`
-	}
+	var input ResetPasswordInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+
+	if input.Phone != "" {
+		h.resetPasswordByPhone(c, input.Phone, input.OTP, input.NewPassword)
 		return
 	}
 
 	// Verify OTP against Redis
-	isValid, err := h.redisClient.VerifyOTP(context.Background(), input.Email, input.OTP)
+	isValid, err := h.redisClient.VerifyOTP(c.Request.Context(), input.Email, input.OTP)
+	if errors.Is(err, redis.ErrOTPExpired) {
+		problem.Abort(c, problem.OTPExpired.New("OTP has expired, request a new one"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify OTP"})
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to verify OTP"))
 		return
 	}
 	if !isValid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid OTP"})
+		problem.Abort(c, problem.OTPInvalid.New("Invalid OTP"))
 		return
 	}
 
 	// Hash the new password
-	hashedPassword, err := auth.HashPassword(input.NewPassword)
+	hashedPassword, err := auth.HashPassword(c.Request.Context(), input.NewPassword)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to hash password"))
 		return
 	}
 
 	// Update the user's password in the database
-	if err := h.userRepo.UpdateUserPassword(context.Background(), &models.UserUpdatePass{Email: input.Email, PasswordHash: hashedPassword}); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+	if err := h.userRepo.UpdateUserPassword(c.Request.Context(), &models.UserUpdatePass{Email: input.Email, PasswordHash: hashedPassword}); err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to update password"))
+		return
+	}
+
+	event := audit.FromContext(c, audit.ActionPasswordReset)
+	if u, err := h.userRepo.GetUserByEmail(c.Request.Context(), input.Email); err == nil {
+		event.ActorID = u.ID
+		event.TargetID = u.ID
+	}
+	h.auditRepo.Record(c.Request.Context(), event)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
+
+// resetPasswordByPhone resets the password of the user with the verified phone number.
+func (h *AuthHandler) resetPasswordByPhone(c *gin.Context, rawPhone string, otp string, newPassword string) {
+	normalized, err := phone.Normalize(rawPhone)
+	if err != nil {
+		problem.Abort(c, problem.PhoneInvalid.New(err.Error()))
 		return
 	}
 
+	isValid, err := h.redisClient.ConsumeScopedOTP(c.Request.Context(), otpScopePasswordReset, normalized, otp)
+	if errors.Is(err, redis.ErrOTPExpired) {
+		problem.Abort(c, problem.OTPExpired.New("OTP has expired, request a new one"))
+		return
+	}
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to verify OTP"))
+		return
+	}
+	if !isValid {
+		problem.Abort(c, problem.OTPInvalid.New("Invalid OTP"))
+		return
+	}
+
+	u, err := h.userRepo.GetUserByPhone(c.Request.Context(), normalized)
+	if err != nil {
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(c.Request.Context(), newPassword)
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to hash password"))
+		return
+	}
+	if err := h.userRepo.UpdateUserPasswordByID(c.Request.Context(), u.ID, hashedPassword); err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to update password"))
+		return
+	}
+
+	event := audit.FromContext(c, audit.ActionPasswordReset)
+	event.ActorID = u.ID
+	event.TargetID = u.ID
+	h.auditRepo.Record(c.Request.Context(), event)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
 }
 
 // ApproveUser 	 godoc
 // @Summary      Approve users.
-// @Description  Approve users account for requesting courier.
+// @Description  Approve users account for requesting courier. Requires the admin role.
 // @Tags         auth
+// @Security     ApiKeyAuth
 // @Accept       json
 // @Produce      json
 // @Param        input  body    models.UserUpdateStatus  true  "Email and status"
 // @Success      200  {object}  map[string]interface{}
-// @Failure      400  {object}  map[string]interface{}
-// @Failure      401  {object}  map[string]interface{}
-// @Failure      404  {object}  map[string]interface{}
-// @Failure      500  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
 // @Router       /auth/approve-user [post]
 func (h *AuthHandler) ApproveUser(c *gin.Context) {
 	var req models.UserUpdateStatus
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.Abort(c, problem.Bind(err))
 		return
 	}
-	if err := h.userRepo.UpdateUserStatus(context.Background(), &models.UserUpdateStatus{Email: req.Email, Status: req.Status}); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update status"})
+	u, err := h.userRepo.GetUserByEmail(c.Request.Context(), req.Email)
+	if err != nil {
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
+		return
+	}
+	if err := h.userRepo.UpdateUserStatus(c.Request.Context(), &models.UserUpdateStatus{Email: req.Email, Status: req.Status}); err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to update status"))
 		return
 	}
+
+	event := audit.FromContext(c, audit.ActionUserStatusChange)
+	event.TargetID = u.ID
+	event.Diff = audit.Changes(map[string]interface{}{"status": u.Status}, map[string]interface{}{"status": req.Status})
+	h.auditRepo.Record(c.Request.Context(), event)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Status updated successfully"})
 }
 
+// RevokeDeviceSession godoc
+// @Summary      Revoke Sessions From Sign-in Alert
+// @Description  Takes the token of the link in a new sign-in alert. The link opens the web app, which posts the token here once the owner confirms. Signs out every session of the account, forgets the device and requires a password reset before the next login, since the password must be assumed compromised. Each link works once.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      DeviceRevokeInput  true  "Token from the sign-in alert link"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /auth/sessions/revoke [post]
+func (h *AuthHandler) RevokeDeviceSession(c *gin.Context) {
+	var input DeviceRevokeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+
+	claims, err := h.jwtManager.VerifyDeviceRevokeToken(input.Token)
+	if err != nil {
+		problem.Abort(c, problem.LinkInvalid.New("Link is invalid or has expired"))
+		return
+	}
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		problem.Abort(c, problem.LinkInvalid.New("Link is invalid or has expired"))
+		return
+	}
+
+	isValid, err := h.redisClient.ConsumeScopedOTP(c.Request.Context(), otpScopeDeviceRevoke, claims.SessionID, auth.HashToken(claims.Nonce))
+	if err != nil && !errors.Is(err, redis.ErrOTPExpired) {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to verify link"))
+		return
+	}
+	if !isValid {
+		problem.Abort(c, problem.LinkInvalid.New("Link is invalid or has expired"))
+		return
+	}
+
+	// Sessions started later from the same device, which is no longer new, are signed out too.
+	if err := h.redisClient.RevokeUserSessions(c.Request.Context(), claims.UserID, h.cfg.SessionLifetime()); err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to revoke sessions"))
+		return
+	}
+	if err := h.userRepo.SetPasswordResetRequired(c.Request.Context(), userID); err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to require password reset"))
+		return
+	}
+	if err := h.deviceRepo.DeleteDevice(c.Request.Context(), claims.UserID, claims.DeviceID); err != nil && !errors.Is(err, device.ErrDeviceNotFound) {
+		slog.ErrorContext(c.Request.Context(), "failed to forget device", "device_id", claims.DeviceID, "error", err)
+	}
+
+	event := audit.FromContext(c, audit.ActionSessionRevoke)
+	event.ActorID = claims.UserID
+	event.TargetID = claims.UserID
+	event.Diff = audit.Details(map[string]interface{}{
+		"session_id":              claims.SessionID,
+		"device_id":               claims.DeviceID,
+		"all_sessions":            true,
+		"password_reset_required": true,
+	})
+	h.auditRepo.Record(c.Request.Context(), event)
+
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions have been signed out. Reset your password to sign in again."})
+}
+
+// checkDevice remembers the device the user signed in from and, if the user has
+// signed in before from other devices, emails them about the new one.
+func (h *AuthHandler) checkDevice(c *gin.Context, user *models.User, sessionID string) {
+	fingerprint, ipPrefix := device.Fingerprint(c.Request.UserAgent(), c.ClientIP())
+	d := &models.KnownDevice{
+		UserID:      user.ID,
+		Fingerprint: fingerprint,
+		UserAgent:   c.Request.UserAgent(),
+		IPPrefix:    ipPrefix,
+		ExpiresAt:   device.ExpiresAt(h.cfg.DeviceExpiry),
+	}
+
+	isNew, err := h.deviceRepo.TouchDevice(c.Request.Context(), d)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to record device", "user_id", user.ID, "error", err)
+		return
+	}
+	if !isNew {
+		return
+	}
+	// The very first device of an account is not suspicious.
+	if count, err := h.deviceRepo.CountDevices(c.Request.Context(), user.ID); err != nil || count <= 1 {
+		return
+	}
+
+	event := audit.FromContext(c, audit.ActionNewDevice)
+	event.ActorID = user.ID
+	event.TargetID = user.ID
+	event.Diff = audit.Details(map[string]interface{}{
+		"session_id": sessionID,
+		"device_id":  d.ID,
+		"ip_prefix":  d.IPPrefix,
+	})
+	h.auditRepo.Record(c.Request.Context(), event)
+
+	nonce, err := auth.GenerateNonce()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to generate revoke link", "user_id", user.ID, "error", err)
+		return
+	}
+	// Keyed by session, so that every alert gets its own link.
+	err = h.redisClient.SaveScopedOTP(c.Request.Context(), otpScopeDeviceRevoke, sessionID, auth.HashToken(nonce), deviceRevokeLinkExpiry)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to save revoke link", "user_id", user.ID, "error", err)
+		return
+	}
+	revokeToken, err := h.jwtManager.GenerateDeviceRevokeToken(user.ID, sessionID, d.ID, nonce, time.Now().Add(deviceRevokeLinkExpiry))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to generate revoke link", "user_id", user.ID, "error", err)
+		return
+	}
+	// The link opens the web app, which posts the token once the owner confirms,
+	// so that mail scanners and link previews do not sign the owner out.
+	link := fmt.Sprintf("%s/sessions/revoke?token=%s", h.cfg.FrontendURL, url.QueryEscape(revokeToken))
+
+	ip := c.ClientIP()
+	ctx := context.WithoutCancel(c.Request.Context())
+	h.tasks.Go(func() {
+		var err error
+		if user.Email != "" {
+			err = email.SendNewDeviceAlert(ctx, h.cfg, user.Email, d.UserAgent, ip, time.Now(), link)
+		} else if user.Phone != nil && user.PhoneVerifiedAt != nil {
+			// Phone-only accounts get a short alert by SMS instead.
+			message := fmt.Sprintf("New sign-in to your account from %s. Not you? Sign out everywhere: %s", ip, link)
+			err = h.smsSender.Send(ctx, *user.Phone, message)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to send new device alert", "user_id", user.ID, "error", err)
+		}
+	})
+}
+
+// recordLoginFailure records a failed login attempt and the reason it was
+// rejected. field is the kind of identifier used: "email", "phone" or
+// "provider". Emails and phone numbers are personal data, which the audit log
+// cannot erase: they are left out when the user is known and masked otherwise.
+func (h *AuthHandler) recordLoginFailure(c *gin.Context, userID string, field string, value string, reason string) {
+	metrics.LoginFailed(reason)
+
+	event := audit.FromContext(c, audit.ActionLoginFailed)
+	event.TargetID = userID
+	details := map[string]interface{}{"reason": reason}
+	switch {
+	case field == "provider":
+		details[field] = value
+	case userID != "":
+		details["field"] = field
+	case field == "phone":
+		details[field] = phone.Mask(value)
+	default:
+		details[field] = email.Mask(value)
+	}
+	event.Diff = audit.Details(details)
+	h.auditRepo.Record(c.Request.Context(), event)
+}
+
+// checkMinimumAge reports whether someone born on dob is old enough for the
+// role. If not, it writes the error response and returns false.
+func checkMinimumAge(c *gin.Context, cfg *config.Config, role string, dob time.Time) bool {
+	minAge := cfg.MinimumAge(role)
+	if minAge <= 0 || (!dob.IsZero() && validation.Age(dob, time.Now()) >= minAge) {
+		return true
+	}
+	problem.Abort(c, problem.AgeRequirementNotMet.Newf("The %s role requires a minimum age of %d", role, minAge).
+		WithField("date_of_birth", fmt.Sprintf("must be a date at least %d years ago", minAge)))
+	return false
+}
+
+// sendPhoneOTP saves a scoped OTP for the identifier and sends it by SMS. On
+// failure it writes the error response and returns false.
+func (h *AuthHandler) sendPhoneOTP(c *gin.Context, scope string, identifier string, to string, otp string) bool {
+	err := h.redisClient.SaveScopedOTP(c.Request.Context(), scope, identifier, otp, 5*time.Minute)
+	if err != nil {
+		if errors.Is(err, redis.ErrOTPCooldown) {
+			problem.Abort(c, problem.OTPCooldown.New("A code was sent recently. Please wait before requesting another."))
+			return false
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to save OTP"))
+		return false
+	}
+
+	if err := sms.SendOTP(c.Request.Context(), h.smsSender, to, otp); err != nil {
+		problem.Abort(c, problem.UpstreamUnavailable.Wrap(err, "Failed to send OTP SMS"))
+		return false
+	}
+	return true
+}
+
 // Input Structs
 type ForgotPasswordInput struct {
-	Email string `json:"email"`
+	Email string `json:"email" binding:"required_without=Phone,omitempty,email"`
+	Phone string `json:"phone" binding:"required_without=Email,omitempty,phone"`
 }
 
 type ResetPasswordInput struct {
-	Email              string `json:"email" binding:"required,email"`
-	OTP                string `json:"otp" binding:"required"`
-	NewPassword        string `json:"new_password" binding:"required"`
+	Email              string `json:"email" binding:"required_without=Phone,omitempty,email"`
+	Phone              string `json:"phone" binding:"required_without=Email,omitempty,phone"`
+	OTP                string `json:"otp" binding:"required,len=6,numeric"`
+	NewPassword        string `json:"new_password" binding:"required,min=8,max=72"`
 	ConfirmNewPassword string `json:"confirm_new_password" binding:"required,eqfield=NewPassword"`
 }
 
-// LoginInput represents the input for the login endpoint.
+// LoginInput represents the input for the login endpoint. Either the email or
+// the phone number is required.
 type LoginInput struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"required_without=Phone,omitempty,email"`
+	Phone    string `json:"phone" binding:"required_without=Email,omitempty,phone"`
+	Password string `json:"password" binding:"required,max=72"`
+}
+
+// DeviceRevokeInput represents the input for signing out from a new sign-in alert.
+type DeviceRevokeInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// RefreshInput represents the input for refreshing an access token.
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// PhoneOTPRequestInput represents the input for requesting a phone login code.
+type PhoneOTPRequestInput struct {
+	Phone string `json:"phone" binding:"required,phone"`
+}
+
+// PhoneOTPLoginInput represents the input for logging in with a phone login code.
+type PhoneOTPLoginInput struct {
+	Phone string `json:"phone" binding:"required,phone"`
+	OTP   string `json:"otp" binding:"required,len=6,numeric"`
 }
 
 // VerifyOTPInput represents the input for the OTP verification endpoint.
+// Either the email or the phone number is required.
 type VerifyOTPInput struct {
-	Email    string `json:"email" binding:"required,email"`
-	OTP      string `json:"otp" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"required_without=Phone,omitempty,email"`
+	Phone    string `json:"phone" binding:"required_without=Email,omitempty,phone"`
+	OTP      string `json:"otp" binding:"required,len=6,numeric"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
 }
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/device"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/problem"
+)
+
+// DeviceHandler handles the known devices of users.
+type DeviceHandler struct {
+	deviceRepo *device.DeviceRepo
+}
+
+// NewDeviceHandler creates a new DeviceHandler.
+func NewDeviceHandler(db *pgxpool.Pool) *DeviceHandler {
+	return &DeviceHandler{
+		deviceRepo: device.NewDeviceRepo(db),
+	}
+}
+
+// GetUserDevices godoc
+// @Summary      Get Known Devices
+// @Description  Lists the devices the user has signed in from that have not expired yet.
+// @Tags         users
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        userId  path      string  true  "User ID"
+// @Success      200  {array}   models.KnownDevice
+// @Failure      400  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /users/{userId}/devices [get]
+func (h *DeviceHandler) GetUserDevices(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+
+	devices, err := h.deviceRepo.GetUserDevices(c.Request.Context(), userID)
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to get devices"))
+		return
+	}
+
+	c.JSON(http.StatusOK, devices)
+}
+
+// DeleteUserDevice godoc
+// @Summary      Forget Known Device
+// @Description  Forgets a device, so the next sign-in from it triggers a new device alert.
+// @Tags         users
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        userId    path      string  true  "User ID"
+// @Param        deviceId  path      string  true  "Device ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /users/{userId}/devices/{deviceId} [delete]
+func (h *DeviceHandler) DeleteUserDevice(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+	deviceID, err := uuid.Parse(c.Param("deviceId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid device ID"))
+		return
+	}
+
+	if err := h.deviceRepo.DeleteDevice(c.Request.Context(), userID.String(), deviceID.String()); err != nil {
+		if errors.Is(err, device.ErrDeviceNotFound) {
+			problem.Abort(c, problem.DeviceNotFound.New("Device not found"))
+			return
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to delete device"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device removed successfully"})
+}
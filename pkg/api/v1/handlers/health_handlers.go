@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/health"
+)
+
+// HealthHandler handles probes from the orchestrator and load balancers.
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+// NewHealthHandler creates a new HealthHandler.
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{
+		checker: checker,
+	}
+}
+
+// Live godoc
+// @Summary      Liveness Probe
+// @Description  Reports that the process is running. It does not check dependencies, so a failing database does not get the service restarted.
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Router       /healthz [get]
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// Ready godoc
+// @Summary      Readiness Probe
+// @Description  Reports whether the service accepts traffic, with the result of each dependency check: PostgreSQL, Redis, the SMTP server and the migration version. Fails as soon as a shutdown starts.
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  health.Report
+// @Failure      503  {object}  health.Report
+// @Router       /readyz [get]
+func (h *HealthHandler) Ready(c *gin.Context) {
+	report := h.checker.Check(c.Request.Context())
+	if !report.Ready() {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
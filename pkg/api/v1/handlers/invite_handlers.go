@@ -0,0 +1,428 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/audit"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/auth"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/email"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/invite"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/problem"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/user"
+)
+
+// invitableRoles lists the roles each inviter role may assign.
+var invitableRoles = map[string][]string{
+	models.RoleAdmin:    {models.RoleUser, models.RoleCourier, models.RoleStaff, models.RoleSupport, models.RoleOrgOwner, models.RoleAdmin},
+	models.RoleOrgOwner: {models.RoleCourier, models.RoleStaff},
+}
+
+// InviteHandler handles invitation-related API requests.
+type InviteHandler struct {
+	inviteRepo *invite.InviteRepo
+	userRepo   *user.UserRepo
+	auditRepo  *audit.AuditRepo
+	cfg        *config.Config
+	jwtManager *auth.JWTManager
+}
+
+// NewInviteHandler creates a new InviteHandler.
+func NewInviteHandler(db *pgxpool.Pool, cfg *config.Config) *InviteHandler {
+	return &InviteHandler{
+		inviteRepo: invite.NewInviteRepo(db),
+		userRepo:   user.NewUserRepo(db),
+		auditRepo:  audit.NewAuditRepo(db),
+		cfg:        cfg,
+		jwtManager: auth.NewJWTManager(cfg),
+	}
+}
+
+// CreateInvite godoc
+// @Summary      Create Invite
+// @Description  Invites a new user with a preassigned role and organization. Admins may assign any role, org owners may invite staff and couriers into their own organization.
+// @Tags         invites
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        invite  body      models.InviteCreate  true  "Invite data"
+// @Success      201  {object}  models.Invite
+// @Failure      400  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      502  {object}  problem.Problem
+// @Router       /invites [post]
+func (h *InviteHandler) CreateInvite(c *gin.Context) {
+	var input models.InviteCreate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+
+	inviter, ok := h.getInviter(c)
+	if !ok {
+		return
+	}
+
+	if !canInviteRole(inviter.Role, input.Role) {
+		problem.Abort(c, problem.InviteRoleForbidden.New("You are not allowed to invite users with this role"))
+		return
+	}
+	if inviter.Role == models.RoleOrgOwner {
+		if inviter.OrgID == nil {
+			problem.Abort(c, problem.OrgRequired.New("You do not belong to an organization"))
+			return
+		}
+		input.OrgID = inviter.OrgID
+	}
+	if input.OrgID != nil {
+		if _, err := uuid.Parse(*input.OrgID); err != nil {
+			problem.Abort(c, problem.InvalidParameter.New("Invalid organization ID"))
+			return
+		}
+	}
+
+	// Check if user already exists
+	if _, err := h.userRepo.GetUserByEmail(c.Request.Context(), input.Email); err == nil {
+		problem.Abort(c, problem.EmailTaken.New("User with this email already exists"))
+		return
+	}
+
+	nonce, err := auth.GenerateNonce()
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to generate invite"))
+		return
+	}
+
+	inv := &models.Invite{
+		Email:     input.Email,
+		Role:      input.Role,
+		OrgID:     input.OrgID,
+		TokenHash: auth.HashToken(nonce),
+		InvitedBy: inviter.ID,
+		ExpiresAt: time.Now().Add(time.Duration(h.cfg.InviteExpiry) * time.Hour),
+	}
+	if err := h.inviteRepo.CreateInvite(c.Request.Context(), inv); err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to create invite"))
+		return
+	}
+
+	if err := h.sendInvite(c.Request.Context(), inv, nonce); err != nil {
+		problem.Abort(c, problem.UpstreamUnavailable.Wrap(err, "Failed to send invite email"))
+		return
+	}
+
+	h.recordInviteEvent(c, audit.ActionInviteCreate, inv, "")
+
+	c.JSON(http.StatusCreated, inv)
+}
+
+// GetAllInvites godoc
+// @Summary      Get All Invites
+// @Description  Lists invites. Org owners only see invites for their own organization.
+// @Tags         invites
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        email   query     string  false  "Email"
+// @Param        status  query     string  false  "Status (pending, accepted, revoked, expired)"
+// @Param        org_id  query     string  false  "Organization ID"
+// @Success      200  {array}   models.Invite
+// @Failure      403  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /invites [get]
+func (h *InviteHandler) GetAllInvites(c *gin.Context) {
+	inviter, ok := h.getInviter(c)
+	if !ok {
+		return
+	}
+
+	var req models.GetAllInvites
+	req.Email = c.Query("email")
+	req.Status = c.Query("status")
+	req.OrgID = c.Query("org_id")
+	if inviter.Role == models.RoleOrgOwner {
+		if inviter.OrgID == nil {
+			problem.Abort(c, problem.OrgRequired.New("You do not belong to an organization"))
+			return
+		}
+		req.OrgID = *inviter.OrgID
+	}
+	if req.OrgID != "" {
+		if _, err := uuid.Parse(req.OrgID); err != nil {
+			problem.Abort(c, problem.InvalidParameter.New("Invalid organization ID"))
+			return
+		}
+	}
+
+	invites, err := h.inviteRepo.GetAllInvites(c.Request.Context(), req)
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to get invites"))
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// ResendInvite godoc
+// @Summary      Resend Invite
+// @Description  Issues a fresh link for a pending or expired invite and emails it again. Previously sent links stop working.
+// @Tags         invites
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        inviteId  path      string  true  "Invite ID"
+// @Success      200  {object}  models.Invite
+// @Failure      400  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      502  {object}  problem.Problem
+// @Router       /invites/{inviteId}/resend [post]
+func (h *InviteHandler) ResendInvite(c *gin.Context) {
+	inv, ok := h.getManagedInvite(c)
+	if !ok {
+		return
+	}
+
+	nonce, err := auth.GenerateNonce()
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to generate invite"))
+		return
+	}
+	expiresAt := time.Now().Add(time.Duration(h.cfg.InviteExpiry) * time.Hour)
+
+	err = h.inviteRepo.UpdateInviteToken(c.Request.Context(), inv.ID, auth.HashToken(nonce), expiresAt)
+	if err != nil {
+		if errors.Is(err, invite.ErrInviteNotPending) {
+			problem.Abort(c, problem.InviteNotPending.New("Invite has already been accepted or revoked"))
+			return
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to update invite"))
+		return
+	}
+	inv.ExpiresAt = expiresAt
+	inv.Status = "pending"
+
+	if err := h.sendInvite(c.Request.Context(), inv, nonce); err != nil {
+		problem.Abort(c, problem.UpstreamUnavailable.Wrap(err, "Failed to send invite email"))
+		return
+	}
+
+	h.recordInviteEvent(c, audit.ActionInviteResend, inv, "")
+
+	c.JSON(http.StatusOK, inv)
+}
+
+// RevokeInvite godoc
+// @Summary      Revoke Invite
+// @Description  Revokes a pending invite so its link can no longer be used.
+// @Tags         invites
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        inviteId  path      string  true  "Invite ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /invites/{inviteId} [delete]
+func (h *InviteHandler) RevokeInvite(c *gin.Context) {
+	inv, ok := h.getManagedInvite(c)
+	if !ok {
+		return
+	}
+
+	if err := h.inviteRepo.RevokeInvite(c.Request.Context(), inv.ID); err != nil {
+		if errors.Is(err, invite.ErrInviteNotPending) {
+			problem.Abort(c, problem.InviteNotPending.New("Invite has already been accepted or revoked"))
+			return
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to revoke invite"))
+		return
+	}
+
+	h.recordInviteEvent(c, audit.ActionInviteRevoke, inv, "")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite revoked successfully"})
+}
+
+// AcceptInvite godoc
+// @Summary      Accept Invite
+// @Description  Accepts an invite using the token from the invite link and creates the account with the chosen password.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      models.InviteAccept  true  "Invite token and account details"
+// @Success      201  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      410  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /auth/invites/accept [post]
+func (h *InviteHandler) AcceptInvite(c *gin.Context) {
+	var input models.InviteAccept
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+
+	claims, err := h.jwtManager.VerifyInviteToken(input.Token)
+	if err != nil {
+		problem.Abort(c, problem.InviteInvalid.New("Invite link is invalid or has expired"))
+		return
+	}
+
+	inviteID, err := uuid.Parse(claims.Invite)
+	if err != nil {
+		problem.Abort(c, problem.InviteInvalid.New("Invite link is invalid or has expired"))
+		return
+	}
+	inv, err := h.inviteRepo.GetInviteByID(c.Request.Context(), inviteID)
+	if err != nil {
+		problem.Abort(c, problem.InviteInvalid.New("Invite link is invalid or has expired"))
+		return
+	}
+
+	if !checkMinimumAge(c, h.cfg, inv.Role, input.DateOfBirth) {
+		return
+	}
+
+	// Check if user already exists
+	if _, err := h.userRepo.GetUserByEmail(c.Request.Context(), inv.Email); err == nil {
+		problem.Abort(c, problem.EmailTaken.New("User with this email already exists"))
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(c.Request.Context(), input.Password)
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to hash password"))
+		return
+	}
+
+	newUser := &models.User{
+		Username:     input.Username,
+		PasswordHash: hashedPassword,
+		FullName:     input.FullName,
+		DateOfBirth:  input.DateOfBirth,
+	}
+	err = h.inviteRepo.AcceptInvite(c.Request.Context(), inv.ID, auth.HashToken(claims.Nonce), newUser)
+	if err != nil {
+		if errors.Is(err, invite.ErrInviteNotPending) {
+			problem.Abort(c, problem.InviteInvalid.New("Invite link is invalid or has expired"))
+			return
+		}
+		if errors.Is(err, invite.ErrUserConflict) {
+			problem.Abort(c, problem.UserConflict.New("Username or email is already in use"))
+			return
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to accept invite"))
+		return
+	}
+
+	h.recordInviteEvent(c, audit.ActionInviteAccept, inv, newUser.ID)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Invite accepted successfully", "id": newUser.ID})
+}
+
+// getInviter loads the authenticated user issuing or managing invites.
+func (h *InviteHandler) getInviter(c *gin.Context) (*models.User, bool) {
+	inviterID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidToken.New("Invalid token"))
+		return nil, false
+	}
+
+	inviter, err := h.userRepo.GetUserByID(c.Request.Context(), inviterID)
+	if err != nil {
+		problem.Abort(c, problem.InvalidToken.New("Invalid token"))
+		return nil, false
+	}
+
+	return inviter, true
+}
+
+// getManagedInvite loads the invite from the path and checks that the caller may manage it.
+func (h *InviteHandler) getManagedInvite(c *gin.Context) (*models.Invite, bool) {
+	inviteID, err := uuid.Parse(c.Param("inviteId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid invite ID"))
+		return nil, false
+	}
+
+	inviter, ok := h.getInviter(c)
+	if !ok {
+		return nil, false
+	}
+
+	inv, err := h.inviteRepo.GetInviteByID(c.Request.Context(), inviteID)
+	if err != nil {
+		problem.Abort(c, problem.InviteNotFound.New("Invite not found"))
+		return nil, false
+	}
+
+	if inviter.Role != models.RoleAdmin {
+		if inviter.OrgID == nil || inv.OrgID == nil || *inviter.OrgID != *inv.OrgID {
+			problem.Abort(c, problem.Forbidden.New("Unauthorized access"))
+			return nil, false
+		}
+	}
+
+	return inv, true
+}
+
+// sendInvite emails the invite link built from the given nonce. The link
+// opens the sign-up page of the web app, which posts the token together with
+// the new account's details to /auth/invites/accept.
+func (h *InviteHandler) sendInvite(ctx context.Context, inv *models.Invite, nonce string) error {
+	token, err := h.jwtManager.GenerateInviteToken(inv.ID, nonce, inv.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/invites/accept?token=%s", h.cfg.FrontendURL, url.QueryEscape(token))
+	return email.SendInvite(ctx, h.cfg, inv.Email, inv.Role, link)
+}
+
+// recordInviteEvent records an invite lifecycle event in the audit log.
+func (h *InviteHandler) recordInviteEvent(c *gin.Context, action string, inv *models.Invite, targetID string) {
+	event := audit.FromContext(c, action)
+	event.TargetID = targetID
+	if action == audit.ActionInviteAccept {
+		// The invitee is not authenticated yet and acts on their own behalf.
+		event.ActorID = targetID
+	}
+	details := map[string]interface{}{
+		"invite_id": inv.ID,
+		"email":     email.Mask(inv.Email),
+		"role":      inv.Role,
+	}
+	if inv.OrgID != nil {
+		details["org_id"] = *inv.OrgID
+	}
+	event.Diff = audit.Details(details)
+	h.auditRepo.Record(c.Request.Context(), event)
+}
+
+// canInviteRole reports whether a user with inviterRole may invite someone as role.
+func canInviteRole(inviterRole string, role string) bool {
+	for _, allowed := range invitableRoles[inviterRole] {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
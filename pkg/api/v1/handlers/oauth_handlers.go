@@ -0,0 +1,544 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/audit"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/identity"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/oidc"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/problem"
+)
+
+const (
+	// oauthStateExpiry is how long a social sign-in may take from redirect to callback.
+	oauthStateExpiry = 10 * time.Minute
+	// oauthStateCookie binds a social sign-in to the browser that started it.
+	oauthStateCookie = "oauth_state"
+	// usernameAttempts is how many generated usernames are tried for a new social login user.
+	usernameAttempts = 3
+)
+
+// oauthState is kept in Redis under the state parameter while a social sign-in is in progress.
+type oauthState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	LinkUserID   string `json:"link_user_id,omitempty"` // Set when linking from account settings
+}
+
+// OAuthLogin godoc
+// @Summary      Sign In With Provider
+// @Description  Redirects to the provider (google, apple, ...) to sign in. Providers that sign in with an embedded widget, such as Telegram, send the widget data straight to the callback instead.
+// @Tags         auth
+// @Produce      json
+// @Param        provider  path  string  true  "Provider name"
+// @Success      302
+// @Failure      400  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /auth/oauth/{provider}/login [get]
+func (h *AuthHandler) OAuthLogin(c *gin.Context) {
+	provider, err := h.providers.Get(c.Param("provider"))
+	if err != nil {
+		problem.Abort(c, problem.ProviderNotFound.New("Sign-in provider not found"))
+		return
+	}
+
+	authURL, err := h.beginOAuth(c, provider, "")
+	if err != nil {
+		if errors.Is(err, oidc.ErrRedirectNotSupported) {
+			problem.Abort(c, problem.RedirectNotSupported.New("This provider signs in with its widget; send the widget data to the callback"))
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to start sign-in", "provider", provider.Name(), "error", err)
+		problem.Abort(c, problem.Internal.New("Failed to start sign-in"))
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OAuthCallback godoc
+// @Summary      Provider Callback
+// @Description  Completes a sign-in with a provider and issues a JWT token. A known provider account signs in to its user; a new one is linked to the user with the same email if both the provider and the account have verified it, and otherwise gets a new account. Unverified emails that match an existing account must be linked from the account settings. Completes linking when the sign-in was started from the account settings.
+// @Tags         auth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        provider  path   string  true   "Provider name"
+// @Param        state     query  string  false  "State from the sign-in redirect"
+// @Param        code      query  string  false  "Authorization code"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      502  {object}  problem.Problem
+// @Router       /auth/oauth/{provider}/callback [get]
+// @Router       /auth/oauth/{provider}/callback [post]
+func (h *AuthHandler) OAuthCallback(c *gin.Context) {
+	provider, err := h.providers.Get(c.Param("provider"))
+	if err != nil {
+		problem.Abort(c, problem.ProviderNotFound.New("Sign-in provider not found"))
+		return
+	}
+	// Apple posts the response back, the others redirect with a query string.
+	if err := c.Request.ParseForm(); err != nil {
+		problem.Abort(c, problem.InvalidRequest.New("Invalid callback parameters"))
+		return
+	}
+	params := c.Request.Form
+
+	// Widget providers have no state; redirect providers refuse a callback without one.
+	var (
+		state *oauthState
+		req   *oidc.AuthRequest
+	)
+	if stateParam := params.Get("state"); stateParam != "" {
+		if state, err = h.consumeOAuthState(c, provider.Name(), stateParam); err != nil {
+			problem.Abort(c, problem.OAuthStateInvalid.New("Sign-in request is invalid or has expired"))
+			return
+		}
+		req = &oidc.AuthRequest{State: stateParam, Nonce: state.Nonce, CodeVerifier: state.CodeVerifier}
+	}
+
+	account, err := provider.Callback(c.Request.Context(), params, req)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidResponse) {
+			h.recordLoginFailure(c, "", "provider", provider.Name(), "invalid_provider_response")
+			problem.Abort(c, problem.ProviderFailed.New("Sign-in with "+provider.Name()+" failed"))
+			return
+		}
+		slog.WarnContext(c.Request.Context(), "failed to complete sign-in", "provider", provider.Name(), "error", err)
+		problem.Abort(c, problem.UpstreamUnavailable.New("Failed to reach the sign-in provider"))
+		return
+	}
+
+	if state != nil && state.LinkUserID != "" {
+		h.linkIdentity(c, state.LinkUserID, account)
+		return
+	}
+	h.signInWithIdentity(c, account)
+}
+
+// GetUserIdentities godoc
+// @Summary      Get Linked Accounts
+// @Description  Lists the provider accounts (Google, Apple, Telegram, ...) the user can sign in with.
+// @Tags         users
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        userId  path      string  true  "User ID"
+// @Success      200  {array}   models.UserIdentity
+// @Failure      400  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /users/{userId}/identities [get]
+func (h *AuthHandler) GetUserIdentities(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+
+	identities, err := h.identityRepo.GetUserIdentities(c.Request.Context(), userID)
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to get linked accounts"))
+		return
+	}
+
+	c.JSON(http.StatusOK, identities)
+}
+
+// LinkIdentity godoc
+// @Summary      Link Account
+// @Description  Starts linking a provider account to the user and returns the URL to send the user to; the provider callback completes the link. Widget providers, such as Telegram, take the widget data in the body and are linked immediately.
+// @Tags         users
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        userId    path      string                  true   "User ID"
+// @Param        provider  path      string                  true   "Provider name"
+// @Param        input     body      map[string]interface{}  false  "Widget data, for widget providers only"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /users/{userId}/identities/{provider} [post]
+func (h *AuthHandler) LinkIdentity(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+	provider, err := h.providers.Get(c.Param("provider"))
+	if err != nil {
+		problem.Abort(c, problem.ProviderNotFound.New("Sign-in provider not found"))
+		return
+	}
+
+	authURL, err := h.beginOAuth(c, provider, userID.String())
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+		return
+	}
+	if !errors.Is(err, oidc.ErrRedirectNotSupported) {
+		slog.ErrorContext(c.Request.Context(), "failed to start linking", "provider", provider.Name(), "error", err)
+		problem.Abort(c, problem.Internal.New("Failed to start linking"))
+		return
+	}
+
+	params, err := bindWidgetData(c)
+	if err != nil {
+		problem.Abort(c, problem.InvalidRequest.New("Invalid widget data"))
+		return
+	}
+	account, err := provider.Callback(c.Request.Context(), params, nil)
+	if err != nil {
+		problem.Abort(c, problem.ProviderFailed.New("Widget data is invalid or has expired"))
+		return
+	}
+
+	h.linkIdentity(c, userID.String(), account)
+}
+
+// UnlinkIdentity godoc
+// @Summary      Unlink Account
+// @Description  Unlinks a provider account. The last way to sign in cannot be removed: the user needs a password, a verified email or phone, or another linked account.
+// @Tags         users
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        userId    path      string  true  "User ID"
+// @Param        provider  path      string  true  "Provider name"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /users/{userId}/identities/{provider} [delete]
+func (h *AuthHandler) UnlinkIdentity(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+	providerName := c.Param("provider")
+
+	u, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
+		return
+	}
+	identities, err := h.identityRepo.GetUserIdentities(c.Request.Context(), userID)
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to get linked accounts"))
+		return
+	}
+	canSignIn := u.PasswordHash != "" || u.EmailVerifiedAt != nil || u.PhoneVerifiedAt != nil
+	for _, i := range identities {
+		if i.Provider != providerName {
+			canSignIn = true
+		}
+	}
+	if !canSignIn {
+		problem.Abort(c, problem.LastSignInMethod.New("This is the only way to sign in to the account. Set a password first."))
+		return
+	}
+
+	if err := h.identityRepo.DeleteIdentity(c.Request.Context(), userID, providerName); err != nil {
+		if errors.Is(err, identity.ErrIdentityNotFound) {
+			problem.Abort(c, problem.IdentityNotFound.New("Linked account not found"))
+			return
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to unlink account"))
+		return
+	}
+
+	event := audit.FromContext(c, audit.ActionIdentityUnlink)
+	event.TargetID = u.ID
+	event.Diff = audit.Details(map[string]interface{}{"provider": providerName})
+	h.auditRepo.Record(c.Request.Context(), event)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlinked successfully"})
+}
+
+// beginOAuth stores the state of a new sign-in and returns the provider URL to redirect to.
+func (h *AuthHandler) beginOAuth(c *gin.Context, provider oidc.Provider, linkUserID string) (string, error) {
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		return "", err
+	}
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), req)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(oauthState{
+		Provider:     provider.Name(),
+		Nonce:        req.Nonce,
+		CodeVerifier: req.CodeVerifier,
+		LinkUserID:   linkUserID,
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := h.redisClient.SaveOAuthState(c.Request.Context(), req.State, string(data), oauthStateExpiry); err != nil {
+		return "", err
+	}
+	h.setOAuthStateCookie(c, req.State, int(oauthStateExpiry.Seconds()))
+
+	return authURL, nil
+}
+
+// consumeOAuthState looks up the state of a sign-in. The state is only
+// accepted from the browser that started the sign-in, and only once.
+func (h *AuthHandler) consumeOAuthState(c *gin.Context, providerName string, stateParam string) (*oauthState, error) {
+	cookie, _ := c.Cookie(oauthStateCookie)
+	h.setOAuthStateCookie(c, "", -1)
+
+	data, err := h.redisClient.ConsumeOAuthState(c.Request.Context(), stateParam)
+	if err != nil {
+		return nil, err
+	}
+	if data == "" || cookie != stateParam {
+		return nil, errors.New("unknown OAuth state")
+	}
+
+	var state oauthState
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return nil, err
+	}
+	if state.Provider != providerName {
+		return nil, errors.New("OAuth state was issued for another provider")
+	}
+	return &state, nil
+}
+
+// setOAuthStateCookie sets the state cookie, or clears it with a negative maxAge.
+// Over HTTPS the cookie is SameSite=None because Apple posts the response back
+// from its own site, which SameSite=Lax cookies are not sent with.
+func (h *AuthHandler) setOAuthStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := strings.HasPrefix(h.cfg.AppBaseURL, "https://")
+	if secure {
+		c.SetSameSite(http.SameSiteNoneMode)
+	} else {
+		c.SetSameSite(http.SameSiteLaxMode)
+	}
+	c.SetCookie(oauthStateCookie, value, maxAge, "/auth/oauth", "", secure, true)
+}
+
+// signInWithIdentity signs in the user the provider account belongs to,
+// linking or creating the user on the first sign-in.
+func (h *AuthHandler) signInWithIdentity(c *gin.Context, account *oidc.Identity) {
+	existing, err := h.identityRepo.GetIdentity(c.Request.Context(), account.Provider, account.Subject)
+	switch {
+	case err == nil:
+		userID, err := uuid.Parse(existing.UserID)
+		if err != nil {
+			problem.Abort(c, problem.Internal.Wrap(err, "Failed to get user"))
+			return
+		}
+		u, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
+		if err != nil {
+			// The user was deleted; the identity stays linked so it can be restored.
+			h.recordLoginFailure(c, existing.UserID, "provider", account.Provider, "user_deleted")
+			problem.Abort(c, problem.InvalidCredentials.New("Account not found"))
+			return
+		}
+		if err := h.identityRepo.TouchIdentity(c.Request.Context(), existing.ID, account.Email); err != nil {
+			slog.ErrorContext(c.Request.Context(), "failed to update identity", "identity_id", existing.ID, "error", err)
+		}
+		h.startPasswordlessSession(c, u, "provider", account.Provider)
+		return
+	case !errors.Is(err, identity.ErrIdentityNotFound):
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to get linked account"))
+		return
+	}
+
+	if account.Email != "" {
+		if u, err := h.userRepo.GetUserByEmail(c.Request.Context(), account.Email); err == nil {
+			// Linking on an email match is only safe when both sides proved the
+			// address; otherwise whoever controls either side could take over the other.
+			if !account.EmailVerified || u.EmailVerifiedAt == nil {
+				h.recordLoginFailure(c, u.ID, "provider", account.Provider, "link_required")
+				problem.Abort(c, problem.IdentityLinkRequired.Newf("An account with this email already exists. Sign in and link %s from your account settings.", account.Provider))
+				return
+			}
+			if !h.createIdentity(c, u.ID, account, true) {
+				return
+			}
+			h.startPasswordlessSession(c, u, "provider", account.Provider)
+			return
+		}
+	}
+
+	u, ok := h.createUserWithIdentity(c, account)
+	if !ok {
+		return
+	}
+	h.startSession(c, u)
+}
+
+// linkIdentity links the provider account to the user and responds.
+func (h *AuthHandler) linkIdentity(c *gin.Context, userID string, account *oidc.Identity) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+	u, err := h.userRepo.GetUserByID(c.Request.Context(), id)
+	if err != nil {
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
+		return
+	}
+	if !h.createIdentity(c, u.ID, account, false) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account linked successfully"})
+}
+
+// createIdentity links the provider account to the user and records it in the
+// audit log. It reports whether it succeeded; on failure the response is written.
+func (h *AuthHandler) createIdentity(c *gin.Context, userID string, account *oidc.Identity, automatic bool) bool {
+	i := &models.UserIdentity{
+		UserID:   userID,
+		Provider: account.Provider,
+		Subject:  account.Subject,
+		Email:    optionalString(account.Email),
+	}
+	if err := h.identityRepo.CreateIdentity(c.Request.Context(), i); err != nil {
+		if errors.Is(err, identity.ErrIdentityExists) {
+			problem.Abort(c, problem.IdentityConflict.Newf("This %s account is linked to another user, or another %s account is already linked", account.Provider, account.Provider))
+			return false
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to link account"))
+		return false
+	}
+
+	event := audit.FromContext(c, audit.ActionIdentityLink)
+	event.ActorID = userID
+	event.TargetID = userID
+	event.Diff = audit.Details(map[string]interface{}{
+		"provider":  account.Provider,
+		"automatic": automatic,
+	})
+	h.auditRepo.Record(c.Request.Context(), event)
+
+	return true
+}
+
+// createUserWithIdentity creates a customer account for a provider account
+// that signs in for the first time. The email is only kept when the provider
+// verified it, so that nobody can claim an address they do not own.
+func (h *AuthHandler) createUserWithIdentity(c *gin.Context, account *oidc.Identity) (*models.User, bool) {
+	u := &models.User{
+		FullName: account.Name,
+		Role:     models.RoleUser,
+	}
+	if account.EmailVerified {
+		u.Email = account.Email
+	}
+	i := &models.UserIdentity{
+		Provider: account.Provider,
+		Subject:  account.Subject,
+		Email:    optionalString(account.Email),
+	}
+
+	var err error
+	for attempt := 0; attempt < usernameAttempts; attempt++ {
+		u.Username = generateUsername(account)
+		err = h.identityRepo.CreateUserWithIdentity(c.Request.Context(), u, i, account.EmailVerified)
+		if !errors.Is(err, identity.ErrUserConflict) {
+			break
+		}
+	}
+	if err != nil {
+		if errors.Is(err, identity.ErrIdentityExists) {
+			problem.Abort(c, problem.IdentityConflict.New("This account was just linked, try signing in again"))
+			return nil, false
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to create user"))
+		return nil, false
+	}
+
+	created, err := h.userRepo.GetUserByID(c.Request.Context(), uuid.MustParse(u.ID))
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to get user"))
+		return nil, false
+	}
+
+	event := audit.FromContext(c, audit.ActionIdentityLink)
+	event.ActorID = created.ID
+	event.TargetID = created.ID
+	event.Diff = audit.Details(map[string]interface{}{
+		"provider": account.Provider,
+		"new_user": true,
+	})
+	h.auditRepo.Record(c.Request.Context(), event)
+
+	return created, true
+}
+
+// generateUsername derives a username from the email or name of the provider
+// account, with a random suffix so that it is unique.
+func generateUsername(account *oidc.Identity) string {
+	base := account.Name
+	if at := strings.Index(account.Email, "@"); at > 0 {
+		base = account.Email[:at]
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(base) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		}
+		if b.Len() == 20 {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		b.WriteString(account.Provider)
+	}
+
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return b.String() + "_" + hex.EncodeToString(suffix)
+}
+
+// bindWidgetData reads the fields of a sign-in widget from a JSON object.
+// Numbers are kept as sent, as they are part of the signed data.
+func bindWidgetData(c *gin.Context) (url.Values, error) {
+	dec := json.NewDecoder(c.Request.Body)
+	dec.UseNumber()
+
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	for key, value := range fields {
+		params.Set(key, fmt.Sprint(value))
+	}
+	return params, nil
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/background"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/db"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/oidc"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/oidc/oidctest"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/problem"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/redis"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/sms"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/pkg/api/middleware"
+)
+
+// testDatabaseEnv names the database the tests that need Postgres run
+// against. The database is migrated to the latest version; it should not hold
+// data anyone cares about.
+const testDatabaseEnv = "TEST_POSTGRES_DATABASE"
+
+// oauthTest is a router serving the social sign-in endpoints with the mock
+// provider registered as "mock", and a second provider "other" backed by the
+// same server.
+type oauthTest struct {
+	server  *oidctest.Server
+	handler *AuthHandler
+	router  *gin.Engine
+}
+
+// newOAuthTest sets up the sign-in endpoints. Without a pool only requests
+// that fail before touching the database can be served. A nil client talks to
+// the mock provider directly.
+func newOAuthTest(t *testing.T, pool *pgxpool.Pool, client *http.Client) *oauthTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	server, err := oidctest.NewServer("test-client", "test-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	if client == nil {
+		client = server.Client()
+	}
+
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.AppBaseURL = "http://auth.test"
+
+	providers, err := oidc.NewRegistry(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"mock", "other"} {
+		provider, err := oidc.NewOIDCProvider(server.ProviderConfig(name), oidc.CallbackURL(cfg.AppBaseURL, name), client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		providers.Register(provider)
+	}
+
+	mr := miniredis.RunT(t)
+	redisClient := &redis.Client{Client: goredis.NewClient(&goredis.Options{Addr: mr.Addr()})}
+	t.Cleanup(func() { redisClient.Close() })
+
+	tasks := background.NewGroup()
+	h := NewAuthHandler(pool, redisClient, sms.NewConsoleSender(io.Discard), providers, tasks, &cfg)
+
+	router := gin.New()
+	router.Use(middleware.ErrorHandler())
+	router.GET("/auth/oauth/:provider/login", h.OAuthLogin)
+	router.GET("/auth/oauth/:provider/callback", h.OAuthCallback)
+	router.DELETE("/users/:userId/identities/:provider", h.UnlinkIdentity)
+
+	return &oauthTest{server: server, handler: h, router: router}
+}
+
+// testDB connects to the test database, migrated to the latest version, and
+// skips the test when none is configured.
+func testDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	name := os.Getenv(testDatabaseEnv)
+	if name == "" {
+		t.Skipf("%s is not set", testDatabaseEnv)
+	}
+
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.PostgresDatabase = name
+	if err := db.Migrate(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := db.Connect(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func (o *oauthTest) serve(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	o.router.ServeHTTP(w, req)
+	return w
+}
+
+// beginSignIn starts a sign-in with the provider and approves it at the mock
+// provider as the given account, or as the server's default one when account
+// is nil. It returns the callback parameters and the state cookie.
+func (o *oauthTest) beginSignIn(t *testing.T, provider string, account url.Values) (url.Values, *http.Cookie) {
+	t.Helper()
+	w := o.serve(httptest.NewRequest(http.MethodGet, "/auth/oauth/"+provider+"/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status = %d, body = %s", w.Code, w.Body)
+	}
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oauthStateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("login did not set the state cookie")
+	}
+
+	authURL, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authURL.Query()
+	for key, values := range account {
+		query[key] = values
+	}
+	authURL.RawQuery = query.Encode()
+
+	client := *o.server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := client.Get(authURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := resp.Location()
+	if err != nil {
+		t.Fatalf("authorization response has no redirect: %v", err)
+	}
+	return callback.Query(), cookie
+}
+
+// callback delivers the provider's response to the callback, with the state
+// cookie if given.
+func (o *oauthTest) callback(provider string, params url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/auth/oauth/"+provider+"/callback?"+params.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	return o.serve(req)
+}
+
+// signIn signs in with the mock provider as the given account.
+func (o *oauthTest) signIn(t *testing.T, account url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	params, cookie := o.beginSignIn(t, "mock", account)
+	return o.callback("mock", params, cookie)
+}
+
+// mockAccount returns the query parameters that make the mock provider sign in
+// as a new account with the given email.
+func mockAccount(email string, verified bool) url.Values {
+	v := url.Values{}
+	v.Set("sub", uuid.NewString())
+	v.Set("email", email)
+	v.Set("name", "OAuth Test")
+	if verified {
+		v.Set("email_verified", "true")
+	}
+	return v
+}
+
+// uniqueEmail returns an email no other test run uses, since the test
+// database is not cleaned up.
+func uniqueEmail() string {
+	return "oauth-" + uuid.NewString() + "@example.com"
+}
+
+func assertProblem(t *testing.T, w *httptest.ResponseRecorder, code problem.Code) {
+	t.Helper()
+	var p problem.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("status = %d, body = %s: %v", w.Code, w.Body, err)
+	}
+	if w.Code != code.Status || p.Code != code.ID {
+		t.Fatalf("status = %d, code = %q, want %d %q (body %s)", w.Code, p.Code, code.Status, code.ID, w.Body)
+	}
+}
+
+func assertSignedIn(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+	var body struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Token == "" || body.RefreshToken == "" {
+		t.Fatalf("response has no tokens: %s", w.Body)
+	}
+}
+
+func TestOAuthCallbackState(t *testing.T) {
+	o := newOAuthTest(t, nil, nil)
+
+	t.Run("missing cookie uses up the state", func(t *testing.T) {
+		params, cookie := o.beginSignIn(t, "mock", nil)
+		assertProblem(t, o.callback("mock", params, nil), problem.OAuthStateInvalid)
+		assertProblem(t, o.callback("mock", params, cookie), problem.OAuthStateInvalid)
+	})
+
+	t.Run("cookie of another sign-in", func(t *testing.T) {
+		_, cookie := o.beginSignIn(t, "mock", nil)
+		params, _ := o.beginSignIn(t, "mock", nil)
+		assertProblem(t, o.callback("mock", params, cookie), problem.OAuthStateInvalid)
+	})
+
+	t.Run("unknown state", func(t *testing.T) {
+		params, cookie := o.beginSignIn(t, "mock", nil)
+		params.Set("state", "unknown")
+		cookie.Value = "unknown"
+		assertProblem(t, o.callback("mock", params, cookie), problem.OAuthStateInvalid)
+	})
+
+	t.Run("state of another provider", func(t *testing.T) {
+		params, cookie := o.beginSignIn(t, "mock", nil)
+		assertProblem(t, o.callback("other", params, cookie), problem.OAuthStateInvalid)
+		assertProblem(t, o.callback("mock", params, cookie), problem.OAuthStateInvalid)
+	})
+}
+
+func TestOAuthSignIn(t *testing.T) {
+	pool := testDB(t)
+	o := newOAuthTest(t, pool, nil)
+
+	t.Run("new account and next sign-in", func(t *testing.T) {
+		account := mockAccount(uniqueEmail(), true)
+		assertSignedIn(t, o.signIn(t, account))
+
+		linked, err := o.handler.identityRepo.GetIdentity(context.Background(), "mock", account.Get("sub"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSignedIn(t, o.signIn(t, account))
+
+		again, err := o.handler.identityRepo.GetIdentity(context.Background(), "mock", account.Get("sub"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.UserID != linked.UserID {
+			t.Errorf("second sign-in went to user %s, want %s", again.UserID, linked.UserID)
+		}
+	})
+
+	t.Run("state is used once", func(t *testing.T) {
+		params, cookie := o.beginSignIn(t, "mock", mockAccount(uniqueEmail(), true))
+		assertSignedIn(t, o.callback("mock", params, cookie))
+		assertProblem(t, o.callback("mock", params, cookie), problem.OAuthStateInvalid)
+	})
+
+	t.Run("links verified email", func(t *testing.T) {
+		email := uniqueEmail()
+		u := &models.User{Username: "oauth_" + uuid.NewString()[:8], Email: email, PasswordHash: "hash", Role: models.RoleUser}
+		if err := o.handler.userRepo.CreateVerifiedUser(context.Background(), u); err != nil {
+			t.Fatal(err)
+		}
+
+		account := mockAccount(email, true)
+		assertSignedIn(t, o.signIn(t, account))
+
+		linked, err := o.handler.identityRepo.GetIdentity(context.Background(), "mock", account.Get("sub"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if linked.UserID != u.ID {
+			t.Errorf("identity linked to user %s, want %s", linked.UserID, u.ID)
+		}
+	})
+
+	t.Run("refuses unverified provider email", func(t *testing.T) {
+		email := uniqueEmail()
+		u := &models.User{Username: "oauth_" + uuid.NewString()[:8], Email: email, PasswordHash: "hash", Role: models.RoleUser}
+		if err := o.handler.userRepo.CreateVerifiedUser(context.Background(), u); err != nil {
+			t.Fatal(err)
+		}
+
+		assertProblem(t, o.signIn(t, mockAccount(email, false)), problem.IdentityLinkRequired)
+	})
+
+	t.Run("refuses unverified account email", func(t *testing.T) {
+		email := uniqueEmail()
+		u := &models.User{Username: "oauth_" + uuid.NewString()[:8], Email: email, PasswordHash: "hash", Role: models.RoleUser}
+		if err := o.handler.userRepo.CreateUser(context.Background(), u); err != nil {
+			t.Fatal(err)
+		}
+
+		assertProblem(t, o.signIn(t, mockAccount(email, true)), problem.IdentityLinkRequired)
+	})
+}
+
+// jwksRedirect sends requests for the provider's JWKS to another server, as
+// if the provider published keys it did not sign the ID token with.
+type jwksRedirect struct {
+	target *url.URL
+}
+
+func (rt jwksRedirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == "/jwks" {
+		req = req.Clone(req.Context())
+		req.URL.Host = rt.target.Host
+		req.Host = rt.target.Host
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestOAuthCallbackRejectsForeignSignature(t *testing.T) {
+	pool := testDB(t)
+
+	foreign, err := oidctest.NewServer("test-client", "test-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer foreign.Close()
+	target, err := url.Parse(foreign.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := newOAuthTest(t, pool, &http.Client{Transport: jwksRedirect{target: target}})
+	assertProblem(t, o.signIn(t, mockAccount(uniqueEmail(), true)), problem.ProviderFailed)
+}
+
+func TestUnlinkIdentity(t *testing.T) {
+	pool := testDB(t)
+	o := newOAuthTest(t, pool, nil)
+	ctx := context.Background()
+
+	// The provider does not vouch for the email, so the new account keeps none
+	// and can only sign in with the provider.
+	account := mockAccount(uniqueEmail(), false)
+	assertSignedIn(t, o.signIn(t, account))
+	linked, err := o.handler.identityRepo.GetIdentity(ctx, "mock", account.Get("sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlink := func(provider string) *httptest.ResponseRecorder {
+		return o.serve(httptest.NewRequest(http.MethodDelete, "/users/"+linked.UserID+"/identities/"+provider, nil))
+	}
+
+	assertProblem(t, unlink("mock"), problem.LastSignInMethod)
+
+	other := &models.UserIdentity{UserID: linked.UserID, Provider: "other", Subject: uuid.NewString()}
+	if err := o.handler.identityRepo.CreateIdentity(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if w := unlink("mock"); w.Code != http.StatusOK {
+		t.Fatalf("unlink with another identity: status = %d, body = %s", w.Code, w.Body)
+	}
+
+	assertProblem(t, unlink("other"), problem.LastSignInMethod)
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/auth"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/email"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/problem"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/redis"
+)
+
+const (
+	// emailLinkExpiry is how long a passwordless sign-in link stays valid.
+	emailLinkExpiry = 15 * time.Minute
+	// emailOTPExpiry is how long a passwordless sign-in code stays valid.
+	emailOTPExpiry = 5 * time.Minute
+)
+
+// passwordlessSentMessage is returned whether or not the email is registered.
+const passwordlessSentMessage = "If the email is registered, a sign-in message has been sent."
+
+// RequestEmailLink godoc
+// @Summary      Request Sign-in Link
+// @Description  Emails a single-use sign-in link that expires in 15 minutes. The response is the same whether or not the email is registered.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      PasswordlessRequestInput  true  "Email"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Router       /auth/login/email-link [post]
+func (h *AuthHandler) RequestEmailLink(c *gin.Context) {
+	var input PasswordlessRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+	emailAddr := strings.TrimSpace(input.Email)
+
+	// Sent in the background so that the response time does not reveal whether the email is registered.
+	ctx := context.WithoutCancel(c.Request.Context())
+	h.tasks.Go(func() {
+		u, err := h.userRepo.GetUserByEmail(ctx, emailAddr)
+		if err != nil {
+			return
+		}
+
+		nonce, err := auth.GenerateNonce()
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to generate login link", "user_id", u.ID, "error", err)
+			return
+		}
+		err = h.redisClient.SaveScopedOTP(ctx, otpScopeEmailLink, u.ID, auth.HashToken(nonce), emailLinkExpiry)
+		if err != nil {
+			if !errors.Is(err, redis.ErrOTPCooldown) {
+				slog.ErrorContext(ctx, "failed to save login link", "user_id", u.ID, "error", err)
+			}
+			return
+		}
+		token, err := h.jwtManager.GenerateEmailLoginToken(u.ID, nonce, time.Now().Add(emailLinkExpiry))
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to generate login link", "user_id", u.ID, "error", err)
+			return
+		}
+
+		// The link opens the web app, which posts the token to sign in. Opening it
+		// does not use it up, as mail scanners that fetch links would.
+		link := fmt.Sprintf("%s/login/email-link?token=%s", h.cfg.FrontendURL, url.QueryEscape(token))
+		if err := email.SendLoginLink(ctx, h.cfg, u.Email, link, emailLinkExpiry); err != nil {
+			slog.ErrorContext(ctx, "failed to send login link", "user_id", u.ID, "error", err)
+		}
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": passwordlessSentMessage})
+}
+
+// VerifyEmailLink godoc
+// @Summary      Sign In With Link
+// @Description  Signs in with the token of the link from the sign-in email and issues a JWT token. The link opens the web app, which posts the token here. Each link works once.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      EmailLinkLoginInput  true  "Token from the sign-in link"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /auth/login/email-link/verify [post]
+func (h *AuthHandler) VerifyEmailLink(c *gin.Context) {
+	var input EmailLinkLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+
+	claims, err := h.jwtManager.VerifyEmailLoginToken(input.Token)
+	if err != nil {
+		problem.Abort(c, problem.LinkInvalid.New("Link is invalid or has expired"))
+		return
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		problem.Abort(c, problem.LinkInvalid.New("Link is invalid or has expired"))
+		return
+	}
+	u, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		problem.Abort(c, problem.LinkInvalid.New("Link is invalid or has expired"))
+		return
+	}
+
+	isValid, err := h.redisClient.ConsumeScopedOTP(c.Request.Context(), otpScopeEmailLink, u.ID, auth.HashToken(claims.Nonce))
+	if err != nil && !errors.Is(err, redis.ErrOTPExpired) {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to verify link"))
+		return
+	}
+	if !isValid {
+		h.recordLoginFailure(c, u.ID, "email", u.Email, "invalid_link")
+		problem.Abort(c, problem.LinkInvalid.New("Link is invalid or has expired"))
+		return
+	}
+	// Opening the link proves the address.
+	if err := h.userRepo.MarkEmailVerified(c.Request.Context(), u.ID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to mark email verified", "user_id", u.ID, "error", err)
+	}
+
+	h.startPasswordlessSession(c, u, "email", u.Email)
+}
+
+// RequestEmailOTP godoc
+// @Summary      Request Sign-in Code
+// @Description  Emails a single-use sign-in code that expires in 5 minutes. The response is the same whether or not the email is registered.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      PasswordlessRequestInput  true  "Email"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Router       /auth/login/email-otp [post]
+func (h *AuthHandler) RequestEmailOTP(c *gin.Context) {
+	var input PasswordlessRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+	emailAddr := strings.TrimSpace(input.Email)
+
+	// Sent in the background so that the response time does not reveal whether the email is registered.
+	ctx := context.WithoutCancel(c.Request.Context())
+	h.tasks.Go(func() {
+		u, err := h.userRepo.GetUserByEmail(ctx, emailAddr)
+		if err != nil {
+			return
+		}
+
+		otp, err := auth.GenerateOTP()
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to generate login code", "user_id", u.ID, "error", err)
+			return
+		}
+		err = h.redisClient.SaveScopedOTP(ctx, otpScopeEmailLogin, u.Email, otp, emailOTPExpiry)
+		if err != nil {
+			if !errors.Is(err, redis.ErrOTPCooldown) {
+				slog.ErrorContext(ctx, "failed to save login code", "user_id", u.ID, "error", err)
+			}
+			return
+		}
+		if err := email.SendOTP(ctx, h.cfg, u.Email, otp); err != nil {
+			slog.ErrorContext(ctx, "failed to send login code", "user_id", u.ID, "error", err)
+		}
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": passwordlessSentMessage})
+}
+
+// VerifyEmailOTP godoc
+// @Summary      Sign In With Code
+// @Description  Signs in with the code from the sign-in email and issues a JWT token.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      EmailOTPLoginInput  true  "Email and code"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /auth/login/email-otp/verify [post]
+func (h *AuthHandler) VerifyEmailOTP(c *gin.Context) {
+	var input EmailOTPLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+	emailAddr := strings.TrimSpace(input.Email)
+
+	isValid, err := h.redisClient.ConsumeScopedOTP(c.Request.Context(), otpScopeEmailLogin, emailAddr, input.OTP)
+	// A code that expired is reported like a wrong one so as not to reveal pending sign-ins.
+	if err != nil && !errors.Is(err, redis.ErrOTPExpired) {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to verify OTP"))
+		return
+	}
+	u, err := h.userRepo.GetUserByEmail(c.Request.Context(), emailAddr)
+	if !isValid || err != nil {
+		userID := ""
+		if err == nil {
+			userID = u.ID
+		}
+		h.recordLoginFailure(c, userID, "email", emailAddr, "invalid_otp")
+		problem.Abort(c, problem.OTPInvalid.New("Invalid email or code"))
+		return
+	}
+	if err := h.userRepo.MarkEmailVerified(c.Request.Context(), u.ID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to mark email verified", "user_id", u.ID, "error", err)
+	}
+
+	h.startPasswordlessSession(c, u, "email", emailAddr)
+}
+
+// PasswordlessRequestInput represents the input for requesting a sign-in link or code.
+type PasswordlessRequestInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// EmailLinkLoginInput represents the input for signing in with an emailed link.
+type EmailLinkLoginInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// EmailOTPLoginInput represents the input for signing in with an emailed code.
+type EmailOTPLoginInput struct {
+	Email string `json:"email" binding:"required,email"`
+	OTP   string `json:"otp" binding:"required,len=6,numeric"`
+}
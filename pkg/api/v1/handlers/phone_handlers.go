@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/audit"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/auth"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/phone"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/problem"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/redis"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/sms"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/user"
+)
+
+// PhoneHandler handles adding and verifying the phone number of an account.
+type PhoneHandler struct {
+	userRepo    *user.UserRepo
+	auditRepo   *audit.AuditRepo
+	redisClient *redis.Client
+	smsSender   sms.SMSSender
+}
+
+// NewPhoneHandler creates a new PhoneHandler.
+func NewPhoneHandler(db *pgxpool.Pool, redisClient *redis.Client, smsSender sms.SMSSender) *PhoneHandler {
+	return &PhoneHandler{
+		userRepo:    user.NewUserRepo(db),
+		auditRepo:   audit.NewAuditRepo(db),
+		redisClient: redisClient,
+		smsSender:   smsSender,
+	}
+}
+
+// SetPhone godoc
+// @Summary      Set Phone
+// @Description  Sets the user's phone number and sends a verification code to it by SMS. A new number cannot be used to sign in until it is verified.
+// @Tags         users
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        userId  path      string              true  "User ID"
+// @Param        input   body      models.PhoneUpdate  true  "Phone number in international format"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      429  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Failure      502  {object}  problem.Problem
+// @Router       /users/{userId}/phone [put]
+func (h *PhoneHandler) SetPhone(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+
+	var input models.PhoneUpdate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+	normalized, err := phone.Normalize(input.Phone)
+	if err != nil {
+		problem.Abort(c, problem.PhoneInvalid.New(err.Error()))
+		return
+	}
+
+	u, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
+		return
+	}
+	if u.Phone != nil && *u.Phone == normalized && u.PhoneVerifiedAt != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Phone is already verified"})
+		return
+	}
+	if owner, err := h.userRepo.GetUserByPhone(c.Request.Context(), normalized); err == nil && owner.ID != u.ID {
+		problem.Abort(c, problem.PhoneTaken.New("Phone is already used by another account"))
+		return
+	}
+
+	otp, err := auth.GenerateOTP()
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to generate OTP"))
+		return
+	}
+	if err := h.redisClient.SaveScopedOTP(c.Request.Context(), otpScopePhoneChange, u.ID, otp, 5*time.Minute); err != nil {
+		if errors.Is(err, redis.ErrOTPCooldown) {
+			problem.Abort(c, problem.OTPCooldown.New("A code was sent recently. Please wait before requesting another."))
+			return
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to save OTP"))
+		return
+	}
+	if err := h.userRepo.SetUserPhone(c.Request.Context(), userID, normalized); err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to set phone"))
+		return
+	}
+	if err := sms.SendOTP(c.Request.Context(), h.smsSender, normalized, otp); err != nil {
+		problem.Abort(c, problem.UpstreamUnavailable.Wrap(err, "Failed to send OTP SMS"))
+		return
+	}
+
+	before := map[string]interface{}{"phone": nil}
+	if u.Phone != nil {
+		before["phone"] = *u.Phone
+	}
+	event := audit.FromContext(c, audit.ActionUserUpdate)
+	event.TargetID = u.ID
+	event.Diff = audit.Changes(before, map[string]interface{}{"phone": normalized}, "phone")
+	h.auditRepo.Record(c.Request.Context(), event)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification code sent to " + phone.Mask(normalized)})
+}
+
+// VerifyPhone godoc
+// @Summary      Verify Phone
+// @Description  Verifies the user's phone number with the code sent by SMS.
+// @Tags         users
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        userId  path      string              true  "User ID"
+// @Param        input   body      models.PhoneVerify  true  "Verification code"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /users/{userId}/phone/verify [post]
+func (h *PhoneHandler) VerifyPhone(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+
+	var input models.PhoneVerify
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+
+	u, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
+	if err != nil || u.Phone == nil {
+		problem.Abort(c, problem.PhoneNotSet.New("No phone number to verify"))
+		return
+	}
+
+	isValid, err := h.redisClient.ConsumeScopedOTP(c.Request.Context(), otpScopePhoneChange, u.ID, input.OTP)
+	if errors.Is(err, redis.ErrOTPExpired) {
+		problem.Abort(c, problem.OTPExpired.New("OTP has expired, request a new one"))
+		return
+	}
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to verify OTP"))
+		return
+	}
+	if !isValid {
+		problem.Abort(c, problem.OTPInvalid.New("Invalid OTP"))
+		return
+	}
+
+	if err := h.userRepo.VerifyUserPhone(c.Request.Context(), u.ID, *u.Phone); err != nil {
+		switch {
+		case errors.Is(err, user.ErrPhoneTaken):
+			problem.Abort(c, problem.PhoneTaken.New("Phone is already used by another account"))
+		case errors.Is(err, user.ErrPhoneMismatch):
+			problem.Abort(c, problem.PhoneChanged.New("Phone number has changed, request a new code"))
+		default:
+			problem.Abort(c, problem.Internal.Wrap(err, "Failed to verify phone"))
+		}
+		return
+	}
+
+	event := audit.FromContext(c, audit.ActionPhoneVerified)
+	event.TargetID = u.ID
+	event.Diff = audit.Details(map[string]interface{}{"phone": phone.Mask(*u.Phone)})
+	h.auditRepo.Record(c.Request.Context(), event)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Phone verified successfully"})
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/audit"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/auth"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/background"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/dataexport"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/problem"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/redis"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/user"
+)
+
+// PrivacyHandler handles personal data export and erasure requests.
+type PrivacyHandler struct {
+	exportRepo  *dataexport.ExportRepo
+	builder     *dataexport.Builder
+	userRepo    *user.UserRepo
+	auditRepo   *audit.AuditRepo
+	redisClient *redis.Client
+	tasks       *background.Group
+	cfg         *config.Config
+}
+
+// NewPrivacyHandler creates a new PrivacyHandler.
+func NewPrivacyHandler(db *pgxpool.Pool, redisClient *redis.Client, tasks *background.Group, cfg *config.Config) *PrivacyHandler {
+	return &PrivacyHandler{
+		exportRepo:  dataexport.NewExportRepo(db),
+		builder:     dataexport.NewBuilder(db),
+		userRepo:    user.NewUserRepo(db),
+		auditRepo:   audit.NewAuditRepo(db),
+		redisClient: redisClient,
+		tasks:       tasks,
+		cfg:         cfg,
+	}
+}
+
+// ExportUserData godoc
+// @Summary      Export User Data
+// @Description  Returns the user's latest personal data export, starting a new one if there is none. The archive contains the profile, known devices (sessions), login history, audit events, role requests and invites; the service does not record consents. Poll until the status is ready, then download it.
+// @Tags         users
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        userId  path      string  true   "User ID"
+// @Param        format  query     string  false  "Archive format (zip, json)"
+// @Success      200  {object}  models.DataExport
+// @Success      202  {object}  models.DataExport
+// @Failure      400  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /users/{userId}/export [get]
+func (h *PrivacyHandler) ExportUserData(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+
+	format := c.DefaultQuery("format", dataexport.FormatZIP)
+	if format != dataexport.FormatZIP && format != dataexport.FormatJSON {
+		problem.Abort(c, problem.InvalidParameter.New("format must be zip or json"))
+		return
+	}
+
+	if _, err := h.userRepo.GetUserByID(c.Request.Context(), userID); err != nil {
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
+		return
+	}
+
+	export, err := h.exportRepo.GetLatestExport(c.Request.Context(), userID, format)
+	if err == nil {
+		status := http.StatusAccepted
+		if export.Status == "ready" {
+			status = http.StatusOK
+		}
+		c.JSON(status, export)
+		return
+	}
+	if !errors.Is(err, dataexport.ErrExportNotFound) {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to get data export"))
+		return
+	}
+
+	requestedBy := c.GetString("userID")
+	export = &models.DataExport{
+		UserID:      userID.String(),
+		RequestedBy: &requestedBy,
+		Format:      format,
+		ExpiresAt:   dataexport.ExpiresAt(h.cfg.DataExportExpiry),
+	}
+	if err := h.exportRepo.CreateExport(c.Request.Context(), export); err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to create data export"))
+		return
+	}
+
+	ctx := context.WithoutCancel(c.Request.Context())
+	h.tasks.Go(func() { h.builder.Run(ctx, export) })
+
+	event := audit.FromContext(c, audit.ActionUserDataExport)
+	event.TargetID = export.UserID
+	event.Diff = audit.Details(map[string]interface{}{"export_id": export.ID, "format": format})
+	h.auditRepo.Record(c.Request.Context(), event)
+
+	c.JSON(http.StatusAccepted, export)
+}
+
+// DownloadUserData godoc
+// @Summary      Download User Data
+// @Description  Downloads a ready personal data export.
+// @Tags         users
+// @Security     ApiKeyAuth
+// @Produce      application/zip
+// @Produce      json
+// @Param        userId    path      string  true  "User ID"
+// @Param        exportId  path      string  true  "Export ID"
+// @Success      200  {file}    file
+// @Failure      400  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /users/{userId}/export/{exportId}/download [get]
+func (h *PrivacyHandler) DownloadUserData(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+	exportID, err := uuid.Parse(c.Param("exportId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid export ID"))
+		return
+	}
+
+	export, archive, err := h.exportRepo.GetExportArchive(c.Request.Context(), userID, exportID)
+	if err != nil {
+		switch {
+		case errors.Is(err, dataexport.ErrExportNotFound):
+			problem.Abort(c, problem.ExportNotFound.New("Data export not found"))
+		case errors.Is(err, dataexport.ErrExportNotReady):
+			problem.Abort(c, problem.ExportNotReady.New("Data export is "+export.Status))
+		default:
+			problem.Abort(c, problem.Internal.Wrap(err, "Failed to get data export"))
+		}
+		return
+	}
+
+	contentType := "application/zip"
+	if export.Format == dataexport.FormatJSON {
+		contentType = "application/json"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="user-data-%s.%s"`, export.UserID, export.Format))
+	c.Data(http.StatusOK, contentType, archive)
+}
+
+// recentSignIn is how long after signing in users without a password may
+// erase their own account.
+const recentSignIn = 10 * time.Minute
+
+// confirmErasure checks that users erasing their own account are who they
+// claim: with their password, or for accounts without one (social, passwordless
+// and phone sign-in) by having signed in recently.
+func confirmErasure(c *gin.Context, u *models.User, input models.UserErasure) bool {
+	if u.PasswordHash != "" {
+		if !auth.CheckPasswordHash(c.Request.Context(), input.Password, u.PasswordHash) {
+			problem.Abort(c, problem.InvalidCredentials.New("Invalid password"))
+			return false
+		}
+		return true
+	}
+
+	authTime := c.GetInt64("authTime")
+	if authTime == 0 || time.Since(time.Unix(authTime, 0)) > recentSignIn {
+		problem.Abort(c, problem.RecentSignInRequired.Newf("Sign in again within %d minutes before erasing your account", int(recentSignIn.Minutes())))
+		return false
+	}
+	return true
+}
+
+// EraseUser godoc
+// @Summary      Erase User
+// @Description  Anonymizes the user's email, username, full name and date of birth in place and deletes the account. The user ID is kept so references held by other services stay valid. All sessions of the account are signed out. Users erasing their own account must confirm with their password, or sign in again first if the account has none.
+// @Tags         users
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        userId  path      string              true   "User ID"
+// @Param        input   body      models.UserErasure  false  "Password confirmation"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      401  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /users/{userId}/erasure [post]
+func (h *PrivacyHandler) EraseUser(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+
+	var input models.UserErasure
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			problem.Abort(c, problem.Bind(err))
+			return
+		}
+	}
+
+	erased, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
+		return
+	}
+
+	if c.GetString("userID") == erased.ID && !confirmErasure(c, erased, input) {
+		return
+	}
+
+	if err := h.userRepo.EraseUser(c.Request.Context(), userID); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			problem.Abort(c, problem.UserNotFound.New("User not found"))
+			return
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to erase user"))
+		return
+	}
+
+	event := audit.FromContext(c, audit.ActionUserErase)
+	event.TargetID = erased.ID
+	h.auditRepo.Record(c.Request.Context(), event)
+
+	// Sign out every session so the tokens of the erased account stop working at once
+	if err := h.redisClient.RevokeUserSessions(c.Request.Context(), erased.ID, h.cfg.SessionLifetime()); err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to revoke sessions"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User data erased successfully"})
+}
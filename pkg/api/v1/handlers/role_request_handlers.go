@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/audit"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/problem"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/rolerequest"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/user"
+)
+
+// RoleRequestHandler handles self-service role requests and their admin review.
+type RoleRequestHandler struct {
+	roleRequestRepo *rolerequest.RoleRequestRepo
+	userRepo        *user.UserRepo
+	auditRepo       *audit.AuditRepo
+	cfg             *config.Config
+}
+
+// NewRoleRequestHandler creates a new RoleRequestHandler.
+func NewRoleRequestHandler(db *pgxpool.Pool, cfg *config.Config) *RoleRequestHandler {
+	return &RoleRequestHandler{
+		roleRequestRepo: rolerequest.NewRoleRequestRepo(db),
+		userRepo:        user.NewUserRepo(db),
+		auditRepo:       audit.NewAuditRepo(db),
+		cfg:             cfg,
+	}
+}
+
+// CreateRoleRequest godoc
+// @Summary      Request Role
+// @Description  Requests a role above the one chosen at registration. The role is only granted once an admin approves the request.
+// @Tags         role-requests
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        userId  path      string                    true  "User ID"
+// @Param        input   body      models.RoleRequestCreate  true  "Requested role and reason"
+// @Success      201  {object}  models.RoleRequest
+// @Failure      400  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /users/{userId}/role-requests [post]
+func (h *RoleRequestHandler) CreateRoleRequest(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+
+	var input models.RoleRequestCreate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+
+	u, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
+		return
+	}
+	if u.Role == input.Role && !u.RoleSelfAssigned {
+		problem.Abort(c, problem.RoleUnchanged.New("User already has this role"))
+		return
+	}
+	if !checkMinimumAge(c, h.cfg, input.Role, u.DateOfBirth) {
+		return
+	}
+
+	req := &models.RoleRequest{
+		UserID:        u.ID,
+		RequestedRole: input.Role,
+		Reason:        input.Reason,
+	}
+	if err := h.roleRequestRepo.CreateRoleRequest(c.Request.Context(), req); err != nil {
+		if errors.Is(err, rolerequest.ErrPendingRequestExists) {
+			problem.Abort(c, problem.RoleRequestPending.New("A role request is already pending review"))
+			return
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to create role request"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, req)
+}
+
+// GetUserRoleRequests godoc
+// @Summary      Get User Role Requests
+// @Description  Lists the role requests made by a user.
+// @Tags         role-requests
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        userId  path      string  true  "User ID"
+// @Success      200  {array}   models.RoleRequest
+// @Failure      400  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /users/{userId}/role-requests [get]
+func (h *RoleRequestHandler) GetUserRoleRequests(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+
+	requests, err := h.roleRequestRepo.GetAllRoleRequests(c.Request.Context(), models.GetAllRoleRequests{UserID: userID.String()})
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to get role requests"))
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+// GetAllRoleRequests godoc
+// @Summary      Get All Role Requests
+// @Description  Lists role requests for admin review.
+// @Tags         role-requests
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        status   query     string  false  "Status (pending, approved, rejected)"
+// @Param        user_id  query     string  false  "User ID"
+// @Success      200  {array}   models.RoleRequest
+// @Failure      400  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /role-requests [get]
+func (h *RoleRequestHandler) GetAllRoleRequests(c *gin.Context) {
+	var filter models.GetAllRoleRequests
+	filter.Status = c.Query("status")
+	filter.UserID = c.Query("user_id")
+	if filter.UserID != "" {
+		if _, err := uuid.Parse(filter.UserID); err != nil {
+			problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+			return
+		}
+	}
+
+	requests, err := h.roleRequestRepo.GetAllRoleRequests(c.Request.Context(), filter)
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to get role requests"))
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+// ApproveRoleRequest godoc
+// @Summary      Approve Role Request
+// @Description  Approves a pending role request and grants the requested role to the user. Users cannot approve their own request.
+// @Tags         role-requests
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        requestId  path      string                    true   "Role request ID"
+// @Param        input      body      models.RoleRequestReview  false  "Review note"
+// @Success      200  {object}  models.RoleRequest
+// @Failure      400  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /role-requests/{requestId}/approve [post]
+func (h *RoleRequestHandler) ApproveRoleRequest(c *gin.Context) {
+	h.reviewRoleRequest(c, true)
+}
+
+// RejectRoleRequest godoc
+// @Summary      Reject Role Request
+// @Description  Rejects a pending role request. Users cannot reject their own request.
+// @Tags         role-requests
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        requestId  path      string                    true   "Role request ID"
+// @Param        input      body      models.RoleRequestReview  false  "Review note"
+// @Success      200  {object}  models.RoleRequest
+// @Failure      400  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /role-requests/{requestId}/reject [post]
+func (h *RoleRequestHandler) RejectRoleRequest(c *gin.Context) {
+	h.reviewRoleRequest(c, false)
+}
+
+func (h *RoleRequestHandler) reviewRoleRequest(c *gin.Context, approve bool) {
+	requestID, err := uuid.Parse(c.Param("requestId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid role request ID"))
+		return
+	}
+
+	var input models.RoleRequestReview
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			problem.Abort(c, problem.Bind(err))
+			return
+		}
+	}
+
+	// The date of birth may have changed since the request was made.
+	if approve && !h.checkRequesterAge(c, requestID) {
+		return
+	}
+
+	req, previousRole, err := h.roleRequestRepo.ReviewRoleRequest(c.Request.Context(), requestID, c.GetString("userID"), approve, input.Note)
+	if err != nil {
+		switch {
+		case errors.Is(err, rolerequest.ErrRequestNotPending):
+			problem.Abort(c, problem.RoleRequestNotPending.New("Role request is not pending"))
+		case errors.Is(err, rolerequest.ErrOwnRequest):
+			problem.Abort(c, problem.RoleRequestOwn.New("You cannot review your own role request"))
+		default:
+			problem.Abort(c, problem.Internal.Wrap(err, "Failed to review role request"))
+		}
+		return
+	}
+
+	event := audit.FromContext(c, audit.ActionRoleRequestReject)
+	event.TargetID = req.UserID
+	details := map[string]interface{}{
+		"role_request_id": req.ID,
+		"requested_role":  req.RequestedRole,
+	}
+	if approve {
+		event.Action = audit.ActionUserRoleChange
+		details["role"] = map[string]interface{}{"from": previousRole, "to": req.RequestedRole}
+	}
+	event.Diff = audit.Details(details)
+	h.auditRepo.Record(c.Request.Context(), event)
+
+	c.JSON(http.StatusOK, req)
+}
+
+// checkRequesterAge checks that the user who made the role request is old
+// enough for the requested role. If not, it writes the error response and returns false.
+func (h *RoleRequestHandler) checkRequesterAge(c *gin.Context, requestID uuid.UUID) bool {
+	req, err := h.roleRequestRepo.GetRoleRequestByID(c.Request.Context(), requestID)
+	if err != nil {
+		problem.Abort(c, problem.RoleRequestNotPending.New("Role request is not pending"))
+		return false
+	}
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to review role request"))
+		return false
+	}
+	u, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
+		return false
+	}
+	return checkMinimumAge(c, h.cfg, req.RequestedRole, u.DateOfBirth)
+}
@@ -1,62 +1,133 @@
 package handlers
 
 import (
-	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/audit"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/problem"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/user"
 )
 
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+
+	defaultUserSearchSize = 20
+	maxUserSearchSize     = 100
+)
+
 // UserHandler handles user-related API requests.
 type UserHandler struct {
-	userRepo *user.UserRepo
+	userRepo  *user.UserRepo
+	auditRepo *audit.AuditRepo
+	cfg       *config.Config
 }
 
 // NewUserHandler creates a new UserHandler.
-func NewUserHandler(db *pgxpool.Pool) *UserHandler {
+func NewUserHandler(db *pgxpool.Pool, cfg *config.Config) *UserHandler {
 	return &UserHandler{
-		userRepo: user.NewUserRepo(db),
+		userRepo:  user.NewUserRepo(db),
+		auditRepo: audit.NewAuditRepo(db),
+		cfg:       cfg,
 	}
 }
 
 // GetAllUsers godoc
 // @Summary      Get All Users
-// @Description  Retrieves a list of all users.
+// @Description  Retrieves a page of users. Requires the users:search permission. Text filters match substrings unless match=exact; role and status always match exactly.
 // @Tags         users
 // @Security     ApiKeyAuth
 // @Accept       json
 // @Produce      json
-// @Param        email  query      string  false  "Email"
-// @Param 		 fullname query string false "Fullname"
-// @Param 		 username query string false "Username"
-// @Param 		 status query string false "Status"
-// @Param 		 role query string false "Role"
-// @Success      200  {array}   models.User
-// @Failure      500  {object}  map[string]interface{}
+// @Param        email               query     string  false  "Email"
+// @Param        fullname            query     string  false  "Fullname"
+// @Param        username            query     string  false  "Username"
+// @Param        status              query     string  false  "Status"
+// @Param        role                query     string  false  "Role"
+// @Param        role_self_assigned  query     bool    false  "Elevated role self-assigned at registration, awaiting an admin review; admins only"
+// @Param        match               query     string  false  "Text filter matching (partial, exact)"
+// @Param        created_from        query     string  false  "Created at or after (RFC 3339)"
+// @Param        created_to          query     string  false  "Created before (RFC 3339)"
+// @Param        sort                query     string  false  "Sort field (created_at, username, email)"
+// @Param        order               query     string  false  "Sort order (asc, desc)"
+// @Param        limit               query     int     false  "Page size (default 50, max 200)"
+// @Param        cursor              query     string  false  "Cursor from the previous page"
+// @Param        include_total       query     bool    false  "Include the total number of matching users"
+// @Param        deleted             query     string  false  "Deleted users (exclude, include, only); admins only"
+// @Success      200  {object}  models.UserList
+// @Failure      400  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
 // @Router       /users [get]
 func (h *UserHandler) GetAllUsers(c *gin.Context) {
-	var (
-		userReq models.GetAllUsers
-	)
-	userReq.Email = c.Query("email")
-	userReq.FullName = c.Query("fullname")
-	userReq.Username = c.Query("username")
-	userReq.Status = c.Query("status")
-	userReq.Role = c.Query("role")
+	userReq, err := parseUserFilter(c)
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New(err.Error()))
+		return
+	}
 
-	users, err := h.userRepo.GetAllUsers(context.Background(), userReq)
+	users, err := h.userRepo.GetAllUsers(c.Request.Context(), userReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get users"})
+		if errors.Is(err, user.ErrInvalidCursor) {
+			problem.Abort(c, problem.InvalidParameter.New("Invalid cursor"))
+			return
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to get users"))
 		return
 	}
 
 	c.JSON(http.StatusOK, users)
 }
 
+// SearchUsers godoc
+// @Summary      Search Users
+// @Description  Fuzzy search over username, full name, email and phone, ranked by similarity. Matching text is wrapped in <mark> tags in the highlights.
+// @Tags         users
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        q      query     string  true   "Search query"
+// @Param        limit  query     int     false  "Maximum results (default 20, max 100)"
+// @Success      200  {array}   models.UserSearchResult
+// @Failure      400  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /users/search [get]
+func (h *UserHandler) SearchUsers(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		problem.Abort(c, problem.InvalidParameter.New("q is required"))
+		return
+	}
+
+	limit := defaultUserSearchSize
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxUserSearchSize {
+			problem.Abort(c, problem.InvalidParameter.New(fmt.Sprintf("limit must be between 1 and %d", maxUserSearchSize)))
+			return
+		}
+		limit = n
+	}
+
+	results, err := h.userRepo.SearchUsers(c.Request.Context(), q, limit)
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to search users"))
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
 // GetUserByID godoc
 // @Summary      Get User by ID
 // @Description  Retrieves a user by their ID.
@@ -66,20 +137,20 @@ func (h *UserHandler) GetAllUsers(c *gin.Context) {
 // @Produce      json
 // @Param        userId  path      string  true  "User ID"
 // @Success      200  {object}  models.User
-// @Failure      400  {object}  map[string]interface{}
-// @Failure      404  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
 // @Router       /users/{userId} [get]
 func (h *UserHandler) GetUserByID(c *gin.Context) {
 	userIDStr := c.Param("userId")
 	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
 		return
 	}
 
-	user, err := h.userRepo.GetUserByID(context.Background(), userID)
+	user, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
 		return
 	}
 
@@ -88,7 +159,7 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 
 // UpdateUser godoc
 // @Summary      Update User
-// @Description  Updates a user's information.
+// @Description  Updates a user's information. The date of birth must still meet the minimum age of the user's role.
 // @Tags         users
 // @Security     ApiKeyAuth
 // @Accept       json
@@ -96,51 +167,276 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 // @Param        userId  path      string  true  "User ID"
 // @Param        user  body      models.User  true  "Updated user data"
 // @Success      200  {object}  map[string]interface{}
-// @Failure      400  {object}  map[string]interface{}
-// @Failure      500  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      403  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
 // @Router       /users/{userId} [put]
 func (h *UserHandler) UpdateUser(c *gin.Context) {
-	userID := c.Param("userId")
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
 
 	var input models.UserUpdate
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.Abort(c, problem.Bind(err))
 		return
 	}
-	input.ID = userID // Ensure the ID is set correctly
+	input.ID = userID.String() // Ensure the ID is set correctly
 
-	if err := h.userRepo.UpdateUser(context.Background(), &input); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+	before, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
+		return
+	}
+	if !checkMinimumAge(c, h.cfg, before.Role, input.DateOfBirth) {
 		return
 	}
 
+	if err := h.userRepo.UpdateUser(c.Request.Context(), &input); err != nil {
+		if errors.Is(err, user.ErrUserConflict) {
+			problem.Abort(c, problem.UserConflict.New("Username is already in use"))
+			return
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to update user"))
+		return
+	}
+
+	event := audit.FromContext(c, audit.ActionUserUpdate)
+	event.TargetID = input.ID
+	event.Diff = audit.Changes(
+		map[string]interface{}{"username": before.Username, "full_name": before.FullName, "date_of_birth": before.DateOfBirth.Format("2006-01-02")},
+		map[string]interface{}{"username": input.Username, "full_name": input.FullName, "date_of_birth": input.DateOfBirth.Format("2006-01-02")},
+		"full_name", "date_of_birth",
+	)
+	h.auditRepo.Record(c.Request.Context(), event)
+
 	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
 }
 
 // DeleteUser godoc
 // @Summary      Delete User
-// @Description  Deletes a user by their ID.
+// @Description  Soft-deletes a user. The account can be restored by an admin until it is purged after the grace period.
 // @Tags         users
 // @Security     ApiKeyAuth
 // @Accept       json
 // @Produce      json
 // @Param        userId  path      string  true  "User ID"
 // @Success      200  {object}  map[string]interface{}
-// @Failure      400  {object}  map[string]interface{}
-// @Failure      500  {object}  map[string]interface{}
+// @Failure      400  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
 // @Router       /users/{userId} [delete]
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	userIDStr := c.Param("userId")
 	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+
+	deleted, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
 		return
 	}
 
-	if err := h.userRepo.DeleteUser(context.Background(), userID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+	if err := h.userRepo.DeleteUser(c.Request.Context(), userID); err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to delete user"))
 		return
 	}
 
+	event := audit.FromContext(c, audit.ActionUserDelete)
+	event.TargetID = deleted.ID
+	event.Diff = audit.Details(map[string]interface{}{
+		"username": deleted.Username,
+		"role":     deleted.Role,
+		"status":   deleted.Status,
+	})
+	h.auditRepo.Record(c.Request.Context(), event)
+
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
+
+// RestoreUser godoc
+// @Summary      Restore User
+// @Description  Restores a soft-deleted user that has not been purged yet.
+// @Tags         users
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        userId  path      string  true  "User ID"
+// @Success      200  {object}  models.User
+// @Failure      400  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      409  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /users/{userId}/restore [post]
+func (h *UserHandler) RestoreUser(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+
+	restored, err := h.userRepo.RestoreUser(c.Request.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrUserNotFound):
+			problem.Abort(c, problem.UserNotFound.New("Deleted user not found"))
+		case errors.Is(err, user.ErrUserConflict):
+			problem.Abort(c, problem.UserConflict.New("Username or email is now used by another account"))
+		default:
+			problem.Abort(c, problem.Internal.Wrap(err, "Failed to restore user"))
+		}
+		return
+	}
+
+	event := audit.FromContext(c, audit.ActionUserRestore)
+	event.TargetID = restored.ID
+	h.auditRepo.Record(c.Request.Context(), event)
+
+	c.JSON(http.StatusOK, restored)
+}
+
+// SetAgeVerification godoc
+// @Summary      Set Age Verification
+// @Description  Records whether the user's date of birth was checked against an identity document. Tokens issued afterwards carry the age_verified and age_over_18 claims. Changing the date of birth clears the verification. Requires the admin role.
+// @Tags         users
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        userId  path      string                        true  "User ID"
+// @Param        input   body      models.AgeVerificationUpdate  true  "Review outcome"
+// @Success      200  {object}  models.User
+// @Failure      400  {object}  problem.Problem
+// @Failure      404  {object}  problem.Problem
+// @Failure      500  {object}  problem.Problem
+// @Router       /users/{userId}/age-verification [put]
+func (h *UserHandler) SetAgeVerification(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		problem.Abort(c, problem.InvalidParameter.New("Invalid user ID"))
+		return
+	}
+
+	var input models.AgeVerificationUpdate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Abort(c, problem.Bind(err))
+		return
+	}
+
+	before, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		problem.Abort(c, problem.UserNotFound.New("User not found"))
+		return
+	}
+
+	if err := h.userRepo.SetAgeVerified(c.Request.Context(), userID, *input.Verified); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			problem.Abort(c, problem.UserNotFound.New("User not found"))
+			return
+		}
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to update age verification"))
+		return
+	}
+
+	after, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		problem.Abort(c, problem.Internal.Wrap(err, "Failed to get user"))
+		return
+	}
+
+	event := audit.FromContext(c, audit.ActionAgeVerification)
+	event.TargetID = after.ID
+	details := map[string]interface{}{
+		"age_verified": map[string]interface{}{"from": before.AgeVerified, "to": after.AgeVerified},
+	}
+	if input.Note != "" {
+		details["note"] = input.Note
+	}
+	event.Diff = audit.Details(details)
+	h.auditRepo.Record(c.Request.Context(), event)
+
+	c.JSON(http.StatusOK, after)
+}
+
+// parseUserFilter reads the user list filters, sorting and pagination parameters.
+func parseUserFilter(c *gin.Context) (models.GetAllUsers, error) {
+	userReq := models.GetAllUsers{
+		Email:     c.Query("email"),
+		FullName:  c.Query("fullname"),
+		Username:  c.Query("username"),
+		Status:    c.Query("status"),
+		Role:      c.Query("role"),
+		Match:     c.DefaultQuery("match", models.MatchPartial),
+		SortBy:    c.DefaultQuery("sort", models.SortByCreatedAt),
+		SortOrder: c.DefaultQuery("order", models.SortAsc),
+		Cursor:    c.Query("cursor"),
+		Deleted:   c.DefaultQuery("deleted", models.DeletedExclude),
+		Limit:     defaultUserPageSize,
+	}
+
+	if userReq.Match != models.MatchPartial && userReq.Match != models.MatchExact {
+		return userReq, fmt.Errorf("match must be %s or %s", models.MatchPartial, models.MatchExact)
+	}
+	switch userReq.SortBy {
+	case models.SortByCreatedAt, models.SortByUsername, models.SortByEmail:
+	default:
+		return userReq, fmt.Errorf("sort must be one of %s, %s, %s", models.SortByCreatedAt, models.SortByUsername, models.SortByEmail)
+	}
+	if userReq.SortOrder != models.SortAsc && userReq.SortOrder != models.SortDesc {
+		return userReq, fmt.Errorf("order must be %s or %s", models.SortAsc, models.SortDesc)
+	}
+	switch userReq.Deleted {
+	case models.DeletedExclude:
+	case models.DeletedInclude, models.DeletedOnly:
+		if c.GetString("userRole") != models.RoleAdmin {
+			return userReq, fmt.Errorf("only admins can list deleted users")
+		}
+	default:
+		return userReq, fmt.Errorf("deleted must be one of %s, %s, %s", models.DeletedExclude, models.DeletedInclude, models.DeletedOnly)
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxUserPageSize {
+			return userReq, fmt.Errorf("limit must be between 1 and %d", maxUserPageSize)
+		}
+		userReq.Limit = n
+	}
+	if selfAssigned := c.Query("role_self_assigned"); selfAssigned != "" {
+		b, err := strconv.ParseBool(selfAssigned)
+		if err != nil {
+			return userReq, fmt.Errorf("role_self_assigned must be a boolean")
+		}
+		if c.GetString("userRole") != models.RoleAdmin {
+			return userReq, fmt.Errorf("only admins can filter by self-assigned role")
+		}
+		userReq.SelfAssigned = &b
+	}
+	if includeTotal := c.Query("include_total"); includeTotal != "" {
+		b, err := strconv.ParseBool(includeTotal)
+		if err != nil {
+			return userReq, fmt.Errorf("include_total must be a boolean")
+		}
+		userReq.IncludeTotal = b
+	}
+
+	for param, dst := range map[string]**time.Time{"created_from": &userReq.CreatedFrom, "created_to": &userReq.CreatedTo} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return userReq, fmt.Errorf("%s must be an RFC 3339 timestamp", param)
+		}
+		*dst = &t
+	}
+
+	return userReq, nil
+}
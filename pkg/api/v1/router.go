@@ -1,16 +1,31 @@
 package v1
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/config"
 	_ "github.com/time_capsule/Auth-Servic-Timecapsule/docs"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/audit"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/auth"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/background"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/health"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/logging"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/models"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/oidc"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/problem"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/redis"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/sms"
+	"github.com/time_capsule/Auth-Servic-Timecapsule/internal/validation"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/pkg/api/middleware"
 	"github.com/time_capsule/Auth-Servic-Timecapsule/pkg/api/v1/handlers"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // @title           Swagger Example API
@@ -32,18 +47,56 @@ import (
 // @in                          header
 // @name                        Authorization
 // @description					Description for what is this security definition being used
-func SetupRouter(db *pgxpool.Pool, redisClient *redis.Client, cfg *config.Config) *gin.Engine {
-	router := gin.Default()
+func SetupRouter(db *pgxpool.Pool, redisClient *redis.Client, smsSender sms.SMSSender, providers *oidc.Registry, tasks *background.Group, checker *health.Checker, cfg *config.Config) *gin.Engine {
+	router := gin.New()
 
 	// Swagger setup
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	// Apply global middleware
+	// Apply global middleware; the request ID and tracing come first so that
+	// every log line and span of the request carries them
+	router.Use(middleware.RequestID())
+	router.Use(otelgin.Middleware(cfg.TracingServiceName, otelgin.WithFilter(traceRequest)))
 	router.Use(middleware.Logger())
+	router.Use(middleware.Metrics())
+	router.Use(middleware.ErrorHandler())
+	router.Use(middleware.Recovery()) // Innermost, so that panics are logged and counted like other errors
+
+	// Custom binding rules; validation errors name fields as they appear in the request body
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		if err := validation.Register(v); err != nil {
+			logging.Fatal("failed to register validators", err)
+		}
+		problem.RegisterJSONFieldNames(v)
+	}
+
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(func(c *gin.Context) {
+		problem.Abort(c, problem.RouteNotFound.New("No route matches "+c.Request.URL.Path))
+	})
+	router.NoMethod(func(c *gin.Context) {
+		problem.Abort(c, problem.MethodNotAllowed.New(c.Request.Method+" is not allowed on "+c.Request.URL.Path))
+	})
+
+	// Revoked sessions are rejected and impersonated requests are written to the audit log by the auth middleware
+	authMiddleware := auth.AuthMiddleware(cfg, redisClient, audit.NewAuditRepo(db))
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db, redisClient, cfg)
-	userHandler := handlers.NewUserHandler(db)
+	authHandler := handlers.NewAuthHandler(db, redisClient, smsSender, providers, tasks, cfg)
+	userHandler := handlers.NewUserHandler(db, cfg)
+	inviteHandler := handlers.NewInviteHandler(db, cfg)
+	roleRequestHandler := handlers.NewRoleRequestHandler(db, cfg)
+	adminHandler := handlers.NewAdminHandler(db, cfg)
+	auditHandler := handlers.NewAuditHandler(db)
+	deviceHandler := handlers.NewDeviceHandler(db)
+	privacyHandler := handlers.NewPrivacyHandler(db, redisClient, tasks, cfg)
+	phoneHandler := handlers.NewPhoneHandler(db, redisClient, smsSender)
+	healthHandler := handlers.NewHealthHandler(checker)
+
+	// Probes
+	router.GET("/healthz", healthHandler.Live)
+	router.GET("/readyz", healthHandler.Ready)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	// API version 1 group
 	v1 := router.Group("")
@@ -54,22 +107,90 @@ func SetupRouter(db *pgxpool.Pool, redisClient *redis.Client, cfg *config.Config
 			authR.POST("/register", authHandler.Register)
 			authR.POST("/verify-otp", authHandler.VerifyOTP) // Route for OTP verification
 			authR.POST("/login", authHandler.Login)
-			authR.GET("/validate", auth.AuthMiddleware(cfg), authHandler.Validate)
+			authR.POST("/refresh", authHandler.Refresh)
+			authR.POST("/login/phone-otp/request", authHandler.RequestPhoneLoginOTP)
+			authR.POST("/login/phone-otp", authHandler.LoginWithPhoneOTP)
+			authR.POST("/login/email-link", authHandler.RequestEmailLink)
+			authR.POST("/login/email-link/verify", authHandler.VerifyEmailLink)
+			authR.POST("/login/email-otp", authHandler.RequestEmailOTP)
+			authR.POST("/login/email-otp/verify", authHandler.VerifyEmailOTP)
+			authR.GET("/oauth/:provider/login", authHandler.OAuthLogin)
+			authR.GET("/oauth/:provider/callback", authHandler.OAuthCallback)
+			authR.POST("/oauth/:provider/callback", authHandler.OAuthCallback)
+			authR.GET("/validate", authMiddleware, authHandler.Validate)
 			authR.POST("/forgot-password", authHandler.ForgotPassword)
 			authR.POST("/reset-password", authHandler.ResetPassword)
-			authR.POST("/approve-user", authHandler.ApproveUser)
+			authR.POST("/approve-user", authMiddleware, auth.RoleMiddleware(models.RoleAdmin), authHandler.ApproveUser)
+			authR.POST("/invites/accept", inviteHandler.AcceptInvite)
+			authR.POST("/sessions/revoke", authHandler.RevokeDeviceSession)
+		}
+
+		// Invite routes
+		invites := v1.Group("/invites")
+		{
+			invites.Use(authMiddleware, auth.RoleMiddleware(models.RoleAdmin, models.RoleOrgOwner))
+			invites.POST("", inviteHandler.CreateInvite)
+			invites.GET("", inviteHandler.GetAllInvites)
+			invites.POST("/:inviteId/resend", inviteHandler.ResendInvite)
+			invites.DELETE("/:inviteId", inviteHandler.RevokeInvite)
 		}
 
 		// User routes
 		users := v1.Group("/users")
 		{
-			users.Use(auth.AuthMiddleware(cfg)) // Protect user routes with auth middleware
-			users.GET("", userHandler.GetAllUsers)
+			users.Use(authMiddleware) // Protect user routes with auth middleware
+			users.GET("", auth.PermissionMiddleware(auth.PermUserSearch), userHandler.GetAllUsers)
+			users.GET("/search", auth.PermissionMiddleware(auth.PermUserSearch), userHandler.SearchUsers)
 			users.GET("/:userId", auth.AuthorizationMiddleware(), userHandler.GetUserByID)
 			users.PUT("/:userId", auth.AuthorizationMiddleware(), userHandler.UpdateUser)
-			users.DELETE("/:userId", userHandler.DeleteUser)
+			users.DELETE("/:userId", auth.AuthorizationMiddleware(), userHandler.DeleteUser)
+			users.POST("/:userId/restore", auth.RoleMiddleware(models.RoleAdmin), userHandler.RestoreUser)
+			users.PUT("/:userId/age-verification", auth.RoleMiddleware(models.RoleAdmin), userHandler.SetAgeVerification)
+			users.GET("/:userId/export", auth.AuthorizationMiddleware(), privacyHandler.ExportUserData)
+			users.GET("/:userId/export/:exportId/download", auth.AuthorizationMiddleware(), privacyHandler.DownloadUserData)
+			users.POST("/:userId/erasure", auth.AuthorizationMiddleware(), privacyHandler.EraseUser)
+			users.PUT("/:userId/phone", auth.AuthorizationMiddleware(), phoneHandler.SetPhone)
+			users.POST("/:userId/phone/verify", auth.AuthorizationMiddleware(), phoneHandler.VerifyPhone)
+			users.GET("/:userId/identities", auth.AuthorizationMiddleware(), authHandler.GetUserIdentities)
+			users.POST("/:userId/identities/:provider", auth.AuthorizationMiddleware(), authHandler.LinkIdentity)
+			users.DELETE("/:userId/identities/:provider", auth.AuthorizationMiddleware(), authHandler.UnlinkIdentity)
+			users.POST("/:userId/role-requests", auth.AuthorizationMiddleware(), roleRequestHandler.CreateRoleRequest)
+			users.GET("/:userId/role-requests", auth.AuthorizationMiddleware(), roleRequestHandler.GetUserRoleRequests)
+			users.GET("/:userId/devices", auth.AuthorizationMiddleware(), deviceHandler.GetUserDevices)
+			users.DELETE("/:userId/devices/:deviceId", auth.AuthorizationMiddleware(), deviceHandler.DeleteUserDevice)
+		}
+
+		// Role request review routes
+		roleRequests := v1.Group("/role-requests")
+		{
+			roleRequests.Use(authMiddleware, auth.RoleMiddleware(models.RoleAdmin))
+			roleRequests.GET("", roleRequestHandler.GetAllRoleRequests)
+			roleRequests.POST("/:requestId/approve", roleRequestHandler.ApproveRoleRequest)
+			roleRequests.POST("/:requestId/reject", roleRequestHandler.RejectRoleRequest)
+		}
+
+		// Admin and support routes
+		admin := v1.Group("/admin")
+		{
+			admin.Use(authMiddleware)
+			admin.POST("/impersonate/:userId", auth.PermissionMiddleware(auth.PermImpersonate), adminHandler.Impersonate)
+			admin.GET("/audit-events", auth.PermissionMiddleware(auth.PermAuditRead), auditHandler.GetAllAuditEvents)
+			admin.GET("/audit-events/export", auth.PermissionMiddleware(auth.PermAuditRead), auditHandler.ExportAuditEvents)
+			admin.GET("/audit-events/verify", auth.PermissionMiddleware(auth.PermAuditRead), auditHandler.VerifyAuditEvents)
 		}
 	}
 
 	return router
 }
+
+// untracedPaths are polled by infrastructure and would only add noise to traces.
+var untracedPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// traceRequest reports whether a span is recorded for the request.
+func traceRequest(r *http.Request) bool {
+	return !untracedPaths[r.URL.Path]
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Register registers a new account and sends a code to its email or phone
+// number, to be confirmed with VerifyOTP. It returns the message of the API.
+func (c *Client) Register(ctx context.Context, req RegisterRequest) (string, error) {
+	var resp messageResponse
+	err := c.do(ctx, request{method: http.MethodPost, path: "/auth/register", body: req}, &resp)
+	return resp.Message, err
+}
+
+// VerifyOTP verifies a new account with the code sent by Register and sets its password.
+func (c *Client) VerifyOTP(ctx context.Context, req VerifyOTPRequest) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/auth/verify-otp", body: req}, nil)
+}
+
+// Login signs in and makes the new session the session of the client.
+func (c *Client) Login(ctx context.Context, req LoginRequest) (Tokens, error) {
+	var resp tokenResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/auth/login", body: req}, &resp); err != nil {
+		return Tokens{}, err
+	}
+	tokens := resp.tokens(time.Now())
+	c.SetTokens(tokens)
+	return tokens, nil
+}
+
+// Refresh exchanges the refresh token for new tokens of its session, which
+// become the session of the client. Refresh tokens can only be used once.
+// Requests refresh the access token when needed, so it rarely has to be
+// called directly.
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	if refreshToken == "" {
+		return Tokens{}, ErrNoSession
+	}
+
+	var resp tokenResponse
+	body := map[string]string{"refresh_token": refreshToken}
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/auth/refresh", body: body}, &resp); err != nil {
+		return Tokens{}, err
+	}
+	tokens := resp.tokens(time.Now())
+	c.SetTokens(tokens)
+	return tokens, nil
+}
+
+// Validate returns the user and role of the access token of the session.
+func (c *Client) Validate(ctx context.Context) (*TokenInfo, error) {
+	var info TokenInfo
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/auth/validate", auth: true}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
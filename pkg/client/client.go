@@ -0,0 +1,332 @@
+// Package client is a Go client for the REST API of the auth service.
+//
+// A Client signs in once and keeps the tokens of its session: the access
+// token is refreshed before it expires, or when the API rejects it, and the
+// rotated tokens can be persisted with WithTokenHandler. Idempotent requests
+// are retried with backoff when the service is unavailable.
+//
+// Failed requests return an *Error carrying the error code of the API:
+//
+//	_, err := c.Login(ctx, client.LoginRequest{Email: email, Password: password})
+//	if errors.Is(err, client.CodeInvalidCredentials) {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout    = 30 * time.Second
+	defaultMaxRetries = 3
+	defaultMinBackoff = 200 * time.Millisecond
+	defaultMaxBackoff = 5 * time.Second
+
+	// refreshLeeway refreshes access tokens that expire within it before
+	// using them, so a request does not fail on a token expiring in transit.
+	refreshLeeway = 30 * time.Second
+)
+
+// ErrNoSession is returned by requests that need a signed-in session when the
+// client has none.
+var ErrNoSession = errors.New("auth api: not signed in")
+
+// Client is a client of the auth service. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	userAgent  string
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	onTokens   func(Tokens)
+
+	mu     sync.Mutex
+	tokens Tokens
+
+	// refreshMu makes concurrent requests with an expired token wait for a
+	// single refresh, as the refresh token can only be used once.
+	refreshMu sync.Mutex
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithUserAgent sets the User-Agent header of requests.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithRetries sets how many times a failed idempotent request is retried.
+// Zero disables retries.
+func WithRetries(maxRetries int) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+	}
+}
+
+// WithBackoff sets the delay before the first retry and the cap on the delay,
+// which doubles with every retry.
+func WithBackoff(min, max time.Duration) Option {
+	return func(c *Client) {
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+// WithTokens resumes a session with previously issued tokens.
+func WithTokens(tokens Tokens) Option {
+	return func(c *Client) {
+		c.tokens = tokens
+	}
+}
+
+// WithTokenHandler sets a function that is called with the tokens of the
+// session whenever they change, to persist them. The previous refresh token
+// is no longer valid once it is called.
+func WithTokenHandler(fn func(Tokens)) Option {
+	return func(c *Client) {
+		c.onTokens = fn
+	}
+}
+
+// New returns a client of the auth service at baseURL, such as
+// "https://auth.example.com".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		userAgent:  "timecapsule-auth-go",
+		maxRetries: defaultMaxRetries,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Tokens returns the tokens of the current session.
+func (c *Client) Tokens() Tokens {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens
+}
+
+// SetTokens replaces the tokens of the current session.
+func (c *Client) SetTokens(tokens Tokens) {
+	c.mu.Lock()
+	c.tokens = tokens
+	c.mu.Unlock()
+
+	if c.onTokens != nil {
+		c.onTokens(tokens)
+	}
+}
+
+// request is a request to the API.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   interface{}
+	auth   bool // Send the access token of the session
+}
+
+// do sends the request and decodes the response into out, if not nil.
+func (c *Client) do(ctx context.Context, req request, out interface{}) error {
+	var body []byte
+	if req.body != nil {
+		var err error
+		body, err = json.Marshal(req.body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		var token string
+		if req.auth {
+			var err error
+			token, err = c.accessToken(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		resp, err := c.send(ctx, req, body, token)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !c.retryable(req, attempt) {
+				return fmt.Errorf("failed to send request: %w", err)
+			}
+			if err := c.sleep(ctx, attempt, 0); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			apiErr := decodeError(resp)
+			resp.Body.Close()
+
+			// The access token expired or was signed with a rotated key: refresh
+			// it once and repeat the request
+			if req.auth && !refreshed && errors.Is(apiErr, CodeInvalidToken) && c.Tokens().RefreshToken != "" {
+				refreshed = true
+				if err := c.refresh(ctx, token); err != nil {
+					return err
+				}
+				attempt--
+				continue
+			}
+			if apiErr.Temporary() && c.retryable(req, attempt) {
+				if err := c.sleep(ctx, attempt, retryAfter(resp)); err != nil {
+					return err
+				}
+				continue
+			}
+			return apiErr
+		}
+
+		defer resp.Body.Close()
+		if out == nil {
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		return nil
+	}
+}
+
+// send sends a single attempt of the request.
+func (c *Client) send(ctx context.Context, req request, body []byte, token string) (*http.Response, error) {
+	target := c.baseURL + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c.httpClient.Do(httpReq)
+}
+
+// retryable reports whether a failed attempt of the request is retried.
+// Requests that are not idempotent are never retried, as a failed attempt
+// may still have been processed.
+func (c *Client) retryable(req request, attempt int) bool {
+	if attempt >= c.maxRetries {
+		return false
+	}
+	switch req.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// sleep waits before retrying the attempt: the delay requested by the
+// service, or an exponential backoff with jitter.
+func (c *Client) sleep(ctx context.Context, attempt int, delay time.Duration) error {
+	if delay <= 0 {
+		delay = c.minBackoff << attempt
+		if delay > c.maxBackoff || delay <= 0 {
+			delay = c.maxBackoff
+		}
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryAfter returns the delay of the Retry-After header in seconds, if any.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// accessToken returns the access token of the session, refreshing it first
+// when it is about to expire.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	tokens := c.Tokens()
+	if tokens.AccessToken == "" {
+		return "", ErrNoSession
+	}
+	if tokens.RefreshToken != "" && !tokens.ExpiresAt.IsZero() && time.Until(tokens.ExpiresAt) < refreshLeeway {
+		if err := c.refresh(ctx, tokens.AccessToken); err != nil {
+			return "", err
+		}
+		tokens = c.Tokens()
+	}
+	return tokens.AccessToken, nil
+}
+
+// refresh replaces the access token stale with a new one, unless another
+// request has already done so.
+func (c *Client) refresh(ctx context.Context, stale string) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	tokens := c.Tokens()
+	if tokens.AccessToken != stale {
+		return nil
+	}
+	_, err := c.Refresh(ctx, tokens.RefreshToken)
+	return err
+}
@@ -0,0 +1,154 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Code is a stable error code reported by the API. Codes can be matched with
+// errors.Is:
+//
+//	if errors.Is(err, client.CodeInvalidCredentials) { ... }
+type Code string
+
+func (c Code) Error() string {
+	return string(c)
+}
+
+// Error codes reported by the API.
+const (
+	CodeInvalidRequest      Code = "request.invalid"
+	CodeValidationFailed    Code = "request.validation_failed"
+	CodeInvalidParameter    Code = "request.invalid_parameter"
+	CodeRouteNotFound       Code = "route.not_found"
+	CodeMethodNotAllowed    Code = "route.method_not_allowed"
+	CodeInternal            Code = "internal"
+	CodeUpstreamUnavailable Code = "upstream.unavailable"
+
+	CodeUnauthenticated        Code = "auth.unauthenticated"
+	CodeInvalidToken           Code = "auth.invalid_token"
+	CodeSessionRevoked         Code = "auth.session_revoked"
+	CodeForbidden              Code = "auth.forbidden"
+	CodeInvalidCredentials     Code = "auth.invalid_credentials"
+	CodeAccountNotApproved     Code = "auth.account_not_approved"
+	CodePasswordResetRequired  Code = "auth.password_reset_required"
+	CodeImpersonationForbidden Code = "auth.impersonation_forbidden"
+	CodeImpersonationReadOnly  Code = "auth.impersonation_read_only"
+	CodeRecentSignInRequired   Code = "auth.recent_sign_in_required"
+	CodeLinkInvalid            Code = "auth.link_invalid"
+	CodeProviderNotFound       Code = "auth.provider_not_found"
+	CodeProviderFailed         Code = "auth.provider_failed"
+	CodeOAuthStateInvalid      Code = "auth.oauth_state_invalid"
+	CodeRedirectNotSupported   Code = "auth.redirect_not_supported"
+	CodeOTPInvalid             Code = "otp.invalid"
+	CodeOTPExpired             Code = "otp.expired"
+	CodeOTPCooldown            Code = "otp.cooldown"
+
+	CodeUserNotFound          Code = "user.not_found"
+	CodeEmailTaken            Code = "user.email_taken"
+	CodePhoneTaken            Code = "user.phone_taken"
+	CodeUserConflict          Code = "user.conflict"
+	CodeRoleUnchanged         Code = "user.role_unchanged"
+	CodeLastSignInMethod      Code = "user.last_sign_in_method"
+	CodeAgeRequirementNotMet  Code = "user.age_requirement_not_met"
+	CodePhoneInvalid          Code = "phone.invalid"
+	CodePhoneNotSet           Code = "phone.not_set"
+	CodePhoneChanged          Code = "phone.changed"
+	CodeIdentityNotFound      Code = "identity.not_found"
+	CodeIdentityConflict      Code = "identity.conflict"
+	CodeIdentityLinkRequired  Code = "identity.link_required"
+	CodeInviteNotFound        Code = "invite.not_found"
+	CodeInviteInvalid         Code = "invite.invalid"
+	CodeInviteNotPending      Code = "invite.not_pending"
+	CodeInviteRoleForbidden   Code = "invite.role_forbidden"
+	CodeOrgRequired           Code = "org.required"
+	CodeRoleRequestNotPending Code = "role_request.not_pending"
+	CodeRoleRequestPending    Code = "role_request.already_pending"
+	CodeRoleRequestOwn        Code = "role_request.own"
+	CodeExportNotFound        Code = "export.not_found"
+	CodeExportNotReady        Code = "export.not_ready"
+	CodeDeviceNotFound        Code = "device.not_found"
+)
+
+// Error is an error response of the API.
+type Error struct {
+	StatusCode int
+	Code       Code
+	Title      string
+	Detail     string
+	Fields     map[string]string // Per-field validation messages, keyed by field name
+	RequestID  string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("auth api: %d %s", e.StatusCode, e.Code)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// Is reports whether the error has the target code.
+func (e *Error) Is(target error) bool {
+	code, ok := target.(Code)
+	return ok && e.Code == code
+}
+
+// Temporary reports whether the request may succeed when retried later.
+func (e *Error) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// problem is the body of an error response.
+type problem struct {
+	Title  string            `json:"title"`
+	Status int               `json:"status"`
+	Detail string            `json:"detail"`
+	Code   string            `json:"code"`
+	Errors map[string]string `json:"errors"`
+}
+
+// decodeError reads an error response. Responses that are not problem
+// details, such as those of a proxy, are reported with a code derived from
+// the status.
+func decodeError(resp *http.Response) *Error {
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Request-ID"),
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var p problem
+	if strings.Contains(resp.Header.Get("Content-Type"), "json") && json.Unmarshal(body, &p) == nil && p.Code != "" {
+		e.Code = Code(p.Code)
+		e.Title = p.Title
+		e.Detail = p.Detail
+		e.Fields = p.Errors
+		return e
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		e.Code = CodeUnauthenticated
+	case resp.StatusCode == http.StatusForbidden:
+		e.Code = CodeForbidden
+	case resp.StatusCode == http.StatusNotFound:
+		e.Code = CodeRouteNotFound
+	case resp.StatusCode == http.StatusInternalServerError:
+		e.Code = CodeInternal
+	case resp.StatusCode > http.StatusInternalServerError:
+		e.Code = CodeUpstreamUnavailable
+	default:
+		e.Code = CodeInvalidRequest
+	}
+	e.Title = http.StatusText(resp.StatusCode)
+	e.Detail = strings.TrimSpace(string(body))
+	return e
+}
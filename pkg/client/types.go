@@ -0,0 +1,199 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Roles known to the auth service.
+const (
+	RoleUser     = "user"
+	RoleCourier  = "courier"
+	RoleStaff    = "staff"
+	RoleSupport  = "support"
+	RoleOrgOwner = "org_owner"
+	RoleAdmin    = "admin"
+)
+
+// Account statuses of a user. Couriers stay pending until an admin approves them.
+const (
+	UserStatusPending  = "pending"
+	UserStatusApproved = "approved"
+	UserStatusCanceled = "canceled"
+)
+
+// User is a user account.
+type User struct {
+	ID                    string     `json:"id"`
+	Username              string     `json:"username"`
+	Email                 string     `json:"email"`
+	EmailVerifiedAt       *time.Time `json:"email_verified_at,omitempty"`
+	Phone                 *string    `json:"phone,omitempty"` // E.164
+	PhoneVerifiedAt       *time.Time `json:"phone_verified_at,omitempty"`
+	FullName              string     `json:"full_name"`
+	DateOfBirth           time.Time  `json:"date_of_birth"`
+	AgeVerified           bool       `json:"age_verified"`
+	AgeVerifiedAt         *time.Time `json:"age_verified_at,omitempty"`
+	Status                string     `json:"status"`
+	Role                  string     `json:"role"`
+	OrgID                 *string    `json:"org_id,omitempty"`
+	RoleSelfAssigned      bool       `json:"role_self_assigned"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+	DeletedAt             *time.Time `json:"deleted_at,omitempty"`
+}
+
+// RegisterRequest is the self-registration of a customer or courier
+// applicant. Either an email or a phone number is required.
+type RegisterRequest struct {
+	Username    string    `json:"username"`
+	Email       string    `json:"email,omitempty"`
+	Phone       string    `json:"phone,omitempty"` // E.164
+	FullName    string    `json:"full_name,omitempty"`
+	DateOfBirth time.Time `json:"date_of_birth"`
+	Role        string    `json:"role,omitempty"` // RoleUser (default) or RoleCourier
+}
+
+// VerifyOTPRequest verifies the email or phone number of a new account with
+// the code sent to it and sets the password.
+type VerifyOTPRequest struct {
+	Email    string `json:"email,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	OTP      string `json:"otp"`
+	Password string `json:"password"`
+}
+
+// LoginRequest signs in with an email or a verified phone number and a password.
+type LoginRequest struct {
+	Email    string `json:"email,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	Password string `json:"password"`
+}
+
+// Tokens are the tokens of a session.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time // When the access token expires
+}
+
+// tokenResponse is the body of a sign-in or refresh response.
+type tokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // Seconds
+}
+
+func (r tokenResponse) tokens(now time.Time) Tokens {
+	return Tokens{
+		AccessToken:  r.Token,
+		RefreshToken: r.RefreshToken,
+		ExpiresAt:    now.Add(time.Duration(r.ExpiresIn) * time.Second),
+	}
+}
+
+// TokenInfo describes a valid access token.
+type TokenInfo struct {
+	UserID      string `json:"id"`
+	Role        string `json:"role"`
+	AgeVerified bool   `json:"age_verified"`
+	AgeOver18   bool   `json:"age_over_18"`
+	ActorID     string `json:"actor_id,omitempty"` // Admin impersonating the user, if any
+}
+
+// UserUpdate is the update of a user's profile.
+type UserUpdate struct {
+	Username    string    `json:"username"`
+	FullName    string    `json:"full_name"`
+	DateOfBirth time.Time `json:"date_of_birth"`
+}
+
+// User list matching, sorting and ordering options.
+const (
+	MatchPartial = "partial"
+	MatchExact   = "exact"
+
+	SortByCreatedAt = "created_at"
+	SortByUsername  = "username"
+	SortByEmail     = "email"
+
+	SortAsc  = "asc"
+	SortDesc = "desc"
+
+	DeletedExclude = "exclude"
+	DeletedInclude = "include"
+	DeletedOnly    = "only"
+)
+
+// ListUsersParams filters and pages a user list. Zero values use the
+// defaults of the API.
+type ListUsersParams struct {
+	Email        string
+	FullName     string
+	Username     string
+	Status       string
+	Role         string
+	Match        string
+	CreatedFrom  *time.Time
+	CreatedTo    *time.Time
+	Sort         string
+	Order        string
+	Limit        int
+	Cursor       string // NextCursor of the previous page
+	IncludeTotal bool
+	Deleted      string // Admins only
+	SelfAssigned *bool  // Admins only; users whose elevated role awaits an admin review
+}
+
+func (p *ListUsersParams) values() url.Values {
+	q := url.Values{}
+	if p == nil {
+		return q
+	}
+	for key, value := range map[string]string{
+		"email":    p.Email,
+		"fullname": p.FullName,
+		"username": p.Username,
+		"status":   p.Status,
+		"role":     p.Role,
+		"match":    p.Match,
+		"sort":     p.Sort,
+		"order":    p.Order,
+		"cursor":   p.Cursor,
+		"deleted":  p.Deleted,
+	} {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	if p.CreatedFrom != nil {
+		q.Set("created_from", p.CreatedFrom.Format(time.RFC3339))
+	}
+	if p.CreatedTo != nil {
+		q.Set("created_to", p.CreatedTo.Format(time.RFC3339))
+	}
+	if p.Limit > 0 {
+		q.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.IncludeTotal {
+		q.Set("include_total", "true")
+	}
+	if p.SelfAssigned != nil {
+		q.Set("role_self_assigned", strconv.FormatBool(*p.SelfAssigned))
+	}
+	return q
+}
+
+// UserList is one page of users. NextCursor is empty on the last page.
+type UserList struct {
+	Items      []*User `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	TotalCount *int64  `json:"total_count,omitempty"`
+}
+
+// messageResponse is the body of responses that only carry a message.
+type messageResponse struct {
+	Message string `json:"message"`
+}
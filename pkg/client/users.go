@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// GetUser returns a user. Users can get their own account; admins can get any.
+func (c *Client) GetUser(ctx context.Context, userID string) (*User, error) {
+	var user User
+	if err := c.do(ctx, request{method: http.MethodGet, path: userPath(userID), auth: true}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListUsers returns a page of users matching params, which may be nil. Admins and support only.
+func (c *Client) ListUsers(ctx context.Context, params *ListUsersParams) (*UserList, error) {
+	var list UserList
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/users", query: params.values(), auth: true}, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// UpdateUser updates the profile of a user. Users can update their own account; admins can update any.
+func (c *Client) UpdateUser(ctx context.Context, userID string, update UserUpdate) error {
+	return c.do(ctx, request{method: http.MethodPut, path: userPath(userID), body: update, auth: true}, nil)
+}
+
+// DeleteUser deletes a user. Deleted users can be restored by an admin.
+func (c *Client) DeleteUser(ctx context.Context, userID string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: userPath(userID), auth: true}, nil)
+}
+
+// RestoreUser restores a deleted user. Admins only.
+func (c *Client) RestoreUser(ctx context.Context, userID string) (*User, error) {
+	var user User
+	if err := c.do(ctx, request{method: http.MethodPost, path: userPath(userID) + "/restore", auth: true}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func userPath(userID string) string {
+	return "/users/" + url.PathEscape(userID)
+}